@@ -0,0 +1,215 @@
+package actions
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+type ArchiveOpts struct {
+	// Source is a local file, or an http(s) URL that is fetched on the target
+	Source string
+	Dest   string
+	// SHA256 is the expected checksum of the archive
+	SHA256 string
+	// StripComponents drops this many leading directories from the extracted
+	// paths, like tar --strip-components
+	StripComponents int
+	Owner           string
+	Group           string
+}
+
+type ArchiveOptsFunc func(*ArchiveOpts)
+
+func WithStripComponents(n int) ArchiveOptsFunc {
+	return func(o *ArchiveOpts) {
+		o.StripComponents = n
+	}
+}
+
+func WithArchiveOwner(owner string, group string) ArchiveOptsFunc {
+	return func(o *ArchiveOpts) {
+		o.Owner = owner
+		o.Group = group
+	}
+}
+
+// Archive extracts a .tar.gz, .tar.xz or .zip archive into a directory on the
+// target after verifying its checksum. A marker file in the directory records
+// the deployed checksum, so the same archive is only extracted once.
+type Archive struct {
+	ArchiveOpts
+}
+
+func DefaultArchiveOpts() ArchiveOpts {
+	return ArchiveOpts{
+		StripComponents: 0,
+	}
+}
+
+func NewArchive(source string, dest string, sha256 string, opts ...ArchiveOptsFunc) *Archive {
+	o := DefaultArchiveOpts()
+	o.Source = source
+	o.Dest = dest
+	o.SHA256 = strings.ToLower(sha256)
+	for _, fn := range opts {
+		fn(&o)
+	}
+	return &Archive{
+		ArchiveOpts: o,
+	}
+}
+
+// archiveMarker is the file in Dest holding the checksum of the extracted
+// archive
+const archiveMarker = ".anvil-archive"
+
+func (a Archive) Handle(ctx context.Context, ex core.Executor, os core.OS, observer core.ActionObserver) error {
+	return core.WithObserver(observer, func() error {
+		format, err := a.format()
+		if err != nil {
+			return err
+		}
+		if _, err := hex.DecodeString(a.SHA256); err != nil || len(a.SHA256) != sha256.Size*2 {
+			return fmt.Errorf("invalid SHA-256 checksum %q for %s", a.SHA256, a.Source)
+		}
+
+		markerPath := path.Join(a.Dest, archiveMarker)
+		marker, exists, err := readFile(ctx, ex, markerPath, observer)
+		if err != nil {
+			return err
+		}
+		if exists && strings.TrimSpace(string(marker)) == a.SHA256 {
+			return core.ReportResult(observer, core.ActionResult{ID: "archive " + a.Dest, Changed: false})
+		}
+
+		var content []byte
+		if !a.isURL() {
+			content, err = a.readLocal()
+			if err != nil {
+				return err
+			}
+		}
+
+		dir, err := stagingDir(ctx, ex, observer)
+		if err != nil {
+			return err
+		}
+		staging := path.Join(dir, "archive."+format)
+		err = a.fetch(ctx, ex, content, staging, observer)
+		if err == nil {
+			err = a.extract(ctx, ex, staging, format, observer)
+		}
+		if _, cleanupErr := ex.Execute(ctx, fmt.Sprintf("rm -rf %s", core.ShellQuote(dir)), observer); cleanupErr != nil {
+			// Log error but report the extraction result
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := core.Upload(ctx, ex, []byte(a.SHA256+"\n"), markerPath, 0o644, observer); err != nil {
+			return err
+		}
+
+		return core.ReportResult(observer, core.ActionResult{ID: "archive " + a.Dest, Changed: true})
+	})
+}
+
+func (a Archive) isURL() bool {
+	return strings.HasPrefix(a.Source, "http://") || strings.HasPrefix(a.Source, "https://")
+}
+
+// format returns the archive format from the source's extension
+func (a Archive) format() (string, error) {
+	name := a.Source
+	if a.isURL() {
+		name, _, _ = strings.Cut(name, "?")
+	}
+	switch {
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return "tar.gz", nil
+	case strings.HasSuffix(name, ".tar.xz"), strings.HasSuffix(name, ".txz"):
+		return "tar.xz", nil
+	case strings.HasSuffix(name, ".zip"):
+		return "zip", nil
+	}
+	return "", fmt.Errorf("unsupported archive %s: expected .tar.gz, .tar.xz or .zip", a.Source)
+}
+
+// readLocal reads a local archive, failing before anything is uploaded if
+// its checksum is wrong
+func (a Archive) readLocal() ([]byte, error) {
+	content, err := os.ReadFile(a.Source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+	if sum := sha256.Sum256(content); hex.EncodeToString(sum[:]) != a.SHA256 {
+		return nil, fmt.Errorf("checksum mismatch for %s: expected %s, got %x", a.Source, a.SHA256, sum)
+	}
+	return content, nil
+}
+
+// fetch puts the archive at staging on the target, downloading it there or
+// uploading the local content, and verifies its checksum there. The caller
+// removes it whether or not it verifies.
+func (a Archive) fetch(ctx context.Context, ex core.Executor, content []byte, staging string, observer core.ActionObserver) error {
+	quotedStaging := core.ShellQuote(staging)
+
+	if a.isURL() {
+		url := core.ShellQuote(a.Source)
+		command := fmt.Sprintf("if command -v curl >/dev/null; then curl -fsSL -o %s %s; else wget -q -O %s %s; fi", quotedStaging, url, quotedStaging, url)
+		if _, err := ex.Execute(ctx, command, observer); err != nil {
+			return fmt.Errorf("failed to download %s: %w", a.Source, err)
+		}
+	} else if err := core.Upload(ctx, ex, content, staging, 0o600, observer); err != nil {
+		return err
+	}
+
+	output, err := ex.Execute(ctx, fmt.Sprintf("echo %s | sha256sum -c -", core.ShellQuote(a.SHA256+"  "+staging)), observer)
+	if err != nil {
+		return fmt.Errorf("checksum mismatch for %s: %w: %s", a.Source, err, strings.TrimSpace(output))
+	}
+	return nil
+}
+
+// extract unpacks the staged archive into Dest and sets its ownership
+func (a Archive) extract(ctx context.Context, ex core.Executor, staging string, format string, observer core.ActionObserver) error {
+	dest := core.ShellQuote(a.Dest)
+	quotedStaging := core.ShellQuote(staging)
+
+	var command string
+	if format == "zip" {
+		// unzip can't strip leading directories, so extract to a scratch
+		// directory and copy the contents of the stripped level across
+		level := `"$tmp"` + strings.Repeat("/*", a.StripComponents)
+		command = fmt.Sprintf(`mkdir -p %s && tmp=$(mktemp -d) && unzip -q -o %s -d "$tmp" && for d in %s/; do cp -a "$d". %s/; done; status=$?; rm -rf "$tmp"; exit $status`,
+			dest, quotedStaging, level, dest)
+	} else {
+		command = fmt.Sprintf("mkdir -p %s && tar -xf %s -C %s", dest, quotedStaging, dest)
+		if a.StripComponents > 0 {
+			command += fmt.Sprintf(" --strip-components=%d", a.StripComponents)
+		}
+	}
+	if _, err := ex.Execute(ctx, command, observer); err != nil {
+		return fmt.Errorf("failed to extract %s: %w", a.Source, err)
+	}
+
+	owner := a.Owner
+	if a.Group != "" {
+		owner += ":" + a.Group
+	}
+	if owner != "" {
+		if _, err := ex.Execute(ctx, fmt.Sprintf("chown -R %s %s", core.ShellQuote(owner), dest), observer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var _ core.Action = (*Archive)(nil)
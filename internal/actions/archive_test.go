@@ -0,0 +1,170 @@
+package actions
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+var releaseFiles = map[string]string{
+	"app-1.2.0/bin/app":   "#!/bin/sh\necho app\n",
+	"app-1.2.0/README.md": "# App\n",
+}
+
+func tarGz(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	gz := gzip.NewWriter(&b)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o755, Size: int64(len(content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func zipArchive(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func checksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func requireTools(t *testing.T, tools ...string) {
+	t.Helper()
+	for _, tool := range tools {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is not installed", tool)
+		}
+	}
+}
+
+func Test_Archive_FromURL(t *testing.T) {
+	requireTools(t, "curl", "tar", "sha256sum")
+	archive := tarGz(t, releaseFiles)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(archive)
+	}))
+	defer server.Close()
+
+	dest := filepath.Join(t.TempDir(), "app")
+	observer := &resultRecorder{}
+	action := NewArchive(server.URL+"/app-1.2.0.tar.gz", dest, checksum(archive), WithStripComponents(1))
+
+	if err := action.Handle(t.Context(), core.LocalExecutor{}, core.Ubuntu{}, observer); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if content, err := os.ReadFile(filepath.Join(dest, "bin/app")); err != nil || string(content) != releaseFiles["app-1.2.0/bin/app"] {
+		t.Errorf("archive not extracted with stripped components: %v", err)
+	}
+
+	if err := action.Handle(t.Context(), core.LocalExecutor{}, core.Ubuntu{}, observer); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(observer.Results) != 2 || !observer.Results[0].Changed || observer.Results[1].Changed {
+		t.Errorf("expected changed then unchanged, got %v", observer.Results)
+	}
+}
+
+func Test_Archive_LocalZip(t *testing.T) {
+	requireTools(t, "unzip", "sha256sum")
+	archive := zipArchive(t, releaseFiles)
+	source := filepath.Join(t.TempDir(), "app-1.2.0.zip")
+	if err := os.WriteFile(source, archive, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	dest := filepath.Join(t.TempDir(), "app")
+	action := NewArchive(source, dest, checksum(archive), WithStripComponents(1))
+
+	if err := action.Handle(t.Context(), core.LocalExecutor{}, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if content, err := os.ReadFile(filepath.Join(dest, "README.md")); err != nil || string(content) != "# App\n" {
+		t.Errorf("archive not extracted with stripped components: %v", err)
+	}
+}
+
+func Test_Archive_ChecksumMismatchOnTarget(t *testing.T) {
+	sum := strings.Repeat("ab", 32)
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			"mktemp -d /tmp/anvil.XXXXXXXXXX":                                           {Output: "/tmp/anvil.k3Fq9Zx0Lw\n"},
+			"echo '" + sum + "  /tmp/anvil.k3Fq9Zx0Lw/archive.tar.xz' | sha256sum -c -": {Output: "FAILED", Err: errors.New("exit status 1")},
+		},
+	}
+	action := NewArchive("https://example.com/node.tar.xz", "/opt/node", sum, WithArchiveOwner("node", "node"))
+
+	if err := action.Handle(t.Context(), ex, core.Ubuntu{}, nil); err == nil {
+		t.Fatal("expected error for a checksum mismatch")
+	}
+
+	for _, command := range ex.History {
+		if strings.Contains(command, "tar -xf") {
+			t.Fatalf("should not extract an archive that fails verification: %v", ex.History)
+		}
+	}
+
+	if !ex.Executed("rm -rf /tmp/anvil.k3Fq9Zx0Lw") {
+		t.Error("did not remove the rejected archive")
+	}
+}
+
+func Test_Archive_LocalChecksumMismatch(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "app.tar.gz")
+	if err := os.WriteFile(source, []byte("not the release"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ex := &core.FakeExecutor{}
+
+	if err := NewArchive(source, "/opt/app", strings.Repeat("0", 64)).Handle(t.Context(), ex, core.Ubuntu{}, nil); err == nil {
+		t.Fatal("expected error for a checksum mismatch")
+	}
+
+	if len(ex.History) != 0 {
+		t.Errorf("should not upload an archive that fails verification: %v", ex.History)
+	}
+}
@@ -0,0 +1,315 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+// KeyState is the desired state of the listed authorized keys
+type KeyState int
+
+const (
+	KeysPresent KeyState = iota
+	KeysAbsent
+)
+
+type AuthorizedKeysOpts struct {
+	Username string
+	Keys     []string
+	// KeyFiles are local files, such as id_ed25519.pub, holding one key per
+	// line
+	KeyFiles []string
+	// Options are prepended to every managed key, e.g. no-pty,from="10.0.0.0/8"
+	Options string
+	State   KeyState
+	// Exclusive removes every key that isn't listed
+	Exclusive bool
+}
+
+type AuthorizedKeysOptsFunc func(*AuthorizedKeysOpts)
+
+func WithKey(key string) AuthorizedKeysOptsFunc {
+	return func(o *AuthorizedKeysOpts) {
+		o.Keys = append(o.Keys, key)
+	}
+}
+
+func WithKeyFile(keyFile string) AuthorizedKeysOptsFunc {
+	return func(o *AuthorizedKeysOpts) {
+		o.KeyFiles = append(o.KeyFiles, keyFile)
+	}
+}
+
+func WithKeyOptions(options string) AuthorizedKeysOptsFunc {
+	return func(o *AuthorizedKeysOpts) {
+		o.Options = options
+	}
+}
+
+func WithKeysAbsent() AuthorizedKeysOptsFunc {
+	return func(o *AuthorizedKeysOpts) {
+		o.State = KeysAbsent
+	}
+}
+
+func WithExclusiveKeys() AuthorizedKeysOptsFunc {
+	return func(o *AuthorizedKeysOpts) {
+		o.Exclusive = true
+	}
+}
+
+// AuthorizedKeys manages the SSH public keys in a user's
+// ~/.ssh/authorized_keys. The user must already exist.
+type AuthorizedKeys struct {
+	AuthorizedKeysOpts
+}
+
+func DefaultAuthorizedKeysOpts() AuthorizedKeysOpts {
+	return AuthorizedKeysOpts{
+		State: KeysPresent,
+	}
+}
+
+func NewAuthorizedKeys(username string, opts ...AuthorizedKeysOptsFunc) *AuthorizedKeys {
+	o := DefaultAuthorizedKeysOpts()
+	o.Username = username
+	for _, fn := range opts {
+		fn(&o)
+	}
+	return &AuthorizedKeys{
+		AuthorizedKeysOpts: o,
+	}
+}
+
+func (a AuthorizedKeys) Handle(ctx context.Context, ex core.Executor, os core.OS, observer core.ActionObserver) error {
+	return core.WithObserver(observer, func() error {
+		keys, err := a.loadKeys()
+		if err != nil {
+			return err
+		}
+
+		output, err := ex.Execute(ctx, os.CheckUser(a.Username), observer)
+		user, exists := passwdEntry{}, false
+		if err == nil {
+			user, exists = parsePasswdEntry(a.Username, output)
+		}
+		owner := fmt.Sprintf("%d:%d", user.UID, user.GID)
+		switch {
+		case !exists && core.IsDryRun(ex):
+			// The user may be created earlier in the same run, so preview the
+			// changes in its home directory
+			user.Home = "~" + a.Username
+			owner = a.Username + ":"
+		case !exists:
+			return fmt.Errorf("user %s does not exist", a.Username)
+		}
+
+		sshDir := path.Join(user.Home, ".ssh")
+		keysPath := path.Join(sshDir, "authorized_keys")
+
+		// The user controls their home directory, and root must not write or
+		// chown through links they made, e.g. authorized_keys -> /etc/shadow
+		_, err = ex.Execute(ctx, fmt.Sprintf("test ! -L %s && test ! -L %s", core.ShellQuote(sshDir), core.ShellQuote(keysPath)), observer)
+		if err != nil {
+			return fmt.Errorf("refusing to manage authorized keys of %s through a symbolic link: %w", a.Username, err)
+		}
+
+		current, exists, err := readFile(ctx, ex, keysPath, observer)
+		if err != nil {
+			return err
+		}
+
+		content := a.render(string(current), keys)
+		if !exists && content == "" {
+			return core.ReportResult(observer, core.ActionResult{ID: "authorized keys " + a.Username, Changed: false})
+		}
+
+		changed, err := ensureFile(ctx, ex, keysPath, []byte(content), 0o600, observer)
+		if err != nil {
+			return err
+		}
+
+		permsChanged, err := a.ensurePermissions(ctx, ex, owner, sshDir, keysPath, changed, observer)
+		if err != nil {
+			return err
+		}
+
+		return core.ReportResult(observer, core.ActionResult{ID: "authorized keys " + a.Username, Changed: changed || permsChanged})
+	})
+}
+
+// loadKeys returns the inline keys followed by the keys read from local files
+func (a AuthorizedKeys) loadKeys() ([]string, error) {
+	keys := append([]string(nil), a.Keys...)
+	for _, keyFile := range a.KeyFiles {
+		content, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key file: %w", err)
+		}
+		for line := range strings.Lines(string(content)) {
+			line = strings.TrimSpace(line)
+			if line != "" && !strings.HasPrefix(line, "#") {
+				keys = append(keys, line)
+			}
+		}
+	}
+
+	for _, key := range keys {
+		if _, ok := parseAuthorizedKey(key); !ok {
+			return nil, fmt.Errorf("invalid SSH public key: %q", key)
+		}
+	}
+	return keys, nil
+}
+
+// render returns the authorized_keys content with the managed keys added,
+// updated or removed
+func (a AuthorizedKeys) render(current string, keys []string) string {
+	desired := make(map[string]string)
+	var order []string
+	for _, key := range keys {
+		parsed, _ := parseAuthorizedKey(key)
+		line := parsed.Line(a.Options)
+		if _, ok := desired[parsed.Blob]; !ok {
+			order = append(order, parsed.Blob)
+		}
+		desired[parsed.Blob] = line
+	}
+
+	var lines []string
+	seen := make(map[string]bool)
+	for line := range strings.Lines(current) {
+		line = strings.TrimRight(line, "\n")
+		parsed, ok := parseAuthorizedKey(line)
+		if !ok {
+			lines = append(lines, line)
+			continue
+		}
+
+		managed, listed := desired[parsed.Blob]
+		switch {
+		case a.State == KeysAbsent && listed:
+		case a.State == KeysAbsent:
+			lines = append(lines, line)
+		case listed && !seen[parsed.Blob]:
+			lines = append(lines, managed)
+			seen[parsed.Blob] = true
+		case listed:
+			// Drop duplicates of a managed key
+		case !a.Exclusive:
+			lines = append(lines, line)
+		}
+	}
+
+	if a.State == KeysPresent {
+		for _, blob := range order {
+			if !seen[blob] {
+				lines = append(lines, desired[blob])
+			}
+		}
+	}
+
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// ensurePermissions makes the .ssh directory and authorized_keys file private
+// to the user. They are always fixed after a write since uploads are owned by
+// the executing user.
+func (a AuthorizedKeys) ensurePermissions(ctx context.Context, ex core.Executor, owner string, sshDir string, keysPath string, written bool, observer core.ActionObserver) (bool, error) {
+	if !written {
+		output, err := ex.Execute(ctx, fmt.Sprintf("stat -c '%%a %%u:%%g' %s %s", core.ShellQuote(sshDir), core.ShellQuote(keysPath)), observer)
+		expected := fmt.Sprintf("700 %s\n600 %s", owner, owner)
+		if err == nil && strings.TrimSpace(output) == expected {
+			return false, nil
+		}
+	}
+
+	command := fmt.Sprintf("chmod 700 %s && chmod 600 %s && chown -h %s %s %s",
+		core.ShellQuote(sshDir), core.ShellQuote(keysPath), owner, core.ShellQuote(sshDir), core.ShellQuote(keysPath))
+	_, err := ex.Execute(ctx, command, observer)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// authorizedKey is a parsed authorized_keys line
+type authorizedKey struct {
+	Options string
+	Type    string
+	Blob    string
+	Comment string
+}
+
+// Line formats the key with the given options, falling back to the key's own
+// options when none are given
+func (k authorizedKey) Line(options string) string {
+	if options == "" {
+		options = k.Options
+	}
+	fields := []string{k.Type, k.Blob}
+	if options != "" {
+		fields = append([]string{options}, fields...)
+	}
+	if k.Comment != "" {
+		fields = append(fields, k.Comment)
+	}
+	return strings.Join(fields, " ")
+}
+
+func isKeyType(field string) bool {
+	for _, prefix := range []string{"ssh-", "ecdsa-sha2-", "sk-ssh-", "sk-ecdsa-sha2-"} {
+		if strings.HasPrefix(field, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAuthorizedKey parses a line of the form [options] type blob [comment],
+// where options may contain quoted spaces
+func parseAuthorizedKey(line string) (authorizedKey, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return authorizedKey{}, false
+	}
+
+	key := authorizedKey{}
+	rest := line
+	if first, _, _ := strings.Cut(rest, " "); !isKeyType(first) {
+		end, inQuotes := -1, false
+		for i, r := range rest {
+			if r == '"' {
+				inQuotes = !inQuotes
+			}
+			if (r == ' ' || r == '\t') && !inQuotes {
+				end = i
+				break
+			}
+		}
+		if end < 0 {
+			return authorizedKey{}, false
+		}
+		key.Options = rest[:end]
+		rest = strings.TrimSpace(rest[end:])
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) < 2 || !isKeyType(fields[0]) {
+		return authorizedKey{}, false
+	}
+	key.Type = fields[0]
+	key.Blob = fields[1]
+	key.Comment = strings.Join(fields[2:], " ")
+	return key, true
+}
+
+var _ core.Action = (*AuthorizedKeys)(nil)
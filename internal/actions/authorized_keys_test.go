@@ -0,0 +1,140 @@
+package actions
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+const (
+	aliceKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIAlice alice@laptop"
+	bobKey   = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIBob bob@desktop"
+	carolKey = "ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQCarol carol@ci"
+)
+
+func deployUserExecutor(os core.OS) *core.FakeExecutor {
+	return &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			os.CheckUser("deploy"): {Output: "deploy:x:1500:1500::/home/deploy:/bin/bash\n"},
+		},
+	}
+}
+
+func Test_AuthorizedKeys(t *testing.T) {
+	target := core.Ubuntu{}
+	ex := deployUserExecutor(target)
+	keyFile := filepath.Join(t.TempDir(), "bob.pub")
+	if err := os.WriteFile(keyFile, []byte(bobKey+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	action := NewAuthorizedKeys("deploy", WithKey(aliceKey), WithKeyFile(keyFile))
+
+	if err := action.Handle(t.Context(), ex, target, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := aliceKey + "\n" + bobKey + "\n"
+	if content := string(ex.Files["/home/deploy/.ssh/authorized_keys"]); content != expected {
+		t.Errorf("unexpected authorized_keys:\n%s", content)
+	}
+
+	if !ex.Executed("chmod 700 /home/deploy/.ssh && chmod 600 /home/deploy/.ssh/authorized_keys && chown -h 1500:1500 /home/deploy/.ssh /home/deploy/.ssh/authorized_keys") {
+		t.Errorf("did not fix permissions: %v", ex.History)
+	}
+}
+
+func Test_AuthorizedKeys_Unchanged(t *testing.T) {
+	target := core.Fedora{}
+	ex := deployUserExecutor(target)
+	ex.Files = map[string][]byte{"/home/deploy/.ssh/authorized_keys": []byte(aliceKey + "\n")}
+	ex.Responses["stat -c '%a %u:%g' /home/deploy/.ssh /home/deploy/.ssh/authorized_keys"] = core.FakeResponse{Output: "700 1500:1500\n600 1500:1500\n"}
+	observer := &resultRecorder{}
+	action := NewAuthorizedKeys("deploy", WithKey(aliceKey))
+
+	if err := action.Handle(t.Context(), ex, target, observer); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(observer.Results) != 1 || observer.Results[0].Changed {
+		t.Errorf("expected a single unchanged result, got %v", observer.Results)
+	}
+}
+
+func Test_AuthorizedKeys_ExclusiveWithOptions(t *testing.T) {
+	target := core.Ubuntu{}
+	ex := deployUserExecutor(target)
+	ex.Files = map[string][]byte{
+		"/home/deploy/.ssh/authorized_keys": []byte("# managed by hand\n" + carolKey + "\n" + aliceKey + "\n"),
+	}
+	action := NewAuthorizedKeys("deploy", WithKey(aliceKey), WithKeyOptions(`from="10.0.0.0/8",no-pty`), WithExclusiveKeys())
+
+	if err := action.Handle(t.Context(), ex, target, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "# managed by hand\n" + `from="10.0.0.0/8",no-pty ` + aliceKey + "\n"
+	if content := string(ex.Files["/home/deploy/.ssh/authorized_keys"]); content != expected {
+		t.Errorf("unexpected authorized_keys:\n%s", content)
+	}
+}
+
+func Test_AuthorizedKeys_Absent(t *testing.T) {
+	target := core.Ubuntu{}
+	ex := deployUserExecutor(target)
+	ex.Files = map[string][]byte{
+		"/home/deploy/.ssh/authorized_keys": []byte(`command="uptime" ` + aliceKey + "\n" + bobKey + "\n"),
+	}
+	action := NewAuthorizedKeys("deploy", WithKey(aliceKey), WithKeysAbsent())
+
+	if err := action.Handle(t.Context(), ex, target, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if content := string(ex.Files["/home/deploy/.ssh/authorized_keys"]); content != bobKey+"\n" {
+		t.Errorf("unexpected authorized_keys:\n%s", content)
+	}
+}
+
+func Test_AuthorizedKeys_UnknownUser(t *testing.T) {
+	action := NewAuthorizedKeys("ghost", WithKey(aliceKey))
+
+	if err := action.Handle(t.Context(), &core.FakeExecutor{}, core.Ubuntu{}, nil); err == nil {
+		t.Error("expected error for a user that doesn't exist")
+	}
+}
+
+func Test_AuthorizedKeys_Symlink(t *testing.T) {
+	target := core.Ubuntu{}
+	ex := deployUserExecutor(target)
+	ex.Responses["test ! -L /home/deploy/.ssh && test ! -L /home/deploy/.ssh/authorized_keys"] = core.FakeResponse{Err: errors.New("exit status 1")}
+	action := NewAuthorizedKeys("deploy", WithKey(aliceKey))
+
+	if err := action.Handle(t.Context(), ex, target, nil); err == nil {
+		t.Fatal("expected error when authorized_keys is a symbolic link")
+	}
+	if len(ex.Files) > 0 {
+		t.Errorf("should not write through the link, wrote %v", ex.Files)
+	}
+}
+
+func Test_AuthorizedKeys_DryRunNewUser(t *testing.T) {
+	ex := &core.DryRunExecutor{}
+	action := NewAuthorizedKeys("ghost", WithKey(aliceKey))
+
+	if err := action.Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("a user created in the same run should be previewed: %v", err)
+	}
+}
+
+func Test_ParseAuthorizedKey_QuotedOptions(t *testing.T) {
+	key, ok := parseAuthorizedKey(`command="echo hello world",no-pty ssh-ed25519 AAAAblob my key`)
+	if !ok {
+		t.Fatal("failed to parse key with quoted options")
+	}
+	if key.Options != `command="echo hello world",no-pty` || key.Blob != "AAAAblob" || key.Comment != "my key" {
+		t.Errorf("unexpected key: %+v", key)
+	}
+}
@@ -0,0 +1,193 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+type CommandOpts struct {
+	Command string
+	// Creates skips the command if this path exists
+	Creates string
+	// Removes skips the command unless this path exists
+	Removes string
+	// Unless skips the command if this probe command succeeds
+	Unless string
+	// OnlyIf skips the command unless this probe command succeeds
+	OnlyIf string
+	// Dir is the working directory of the command
+	Dir string
+	Env map[string]string
+	// ExitCodes are the exit codes that count as success
+	ExitCodes []int
+}
+
+type CommandOptsFunc func(*CommandOpts)
+
+func WithCreates(path string) CommandOptsFunc {
+	return func(o *CommandOpts) {
+		o.Creates = path
+	}
+}
+
+func WithRemoves(path string) CommandOptsFunc {
+	return func(o *CommandOpts) {
+		o.Removes = path
+	}
+}
+
+func WithUnless(command string) CommandOptsFunc {
+	return func(o *CommandOpts) {
+		o.Unless = command
+	}
+}
+
+func WithOnlyIf(command string) CommandOptsFunc {
+	return func(o *CommandOpts) {
+		o.OnlyIf = command
+	}
+}
+
+func WithDir(dir string) CommandOptsFunc {
+	return func(o *CommandOpts) {
+		o.Dir = dir
+	}
+}
+
+func WithEnv(key string, value string) CommandOptsFunc {
+	return func(o *CommandOpts) {
+		if o.Env == nil {
+			o.Env = make(map[string]string)
+		}
+		o.Env[key] = value
+	}
+}
+
+func WithExitCodes(codes ...int) CommandOptsFunc {
+	return func(o *CommandOpts) {
+		o.ExitCodes = codes
+	}
+}
+
+// Command runs a shell command on the target. Its guards make it idempotent:
+// it only runs, and only reports a change, when none of them say to skip it.
+type Command struct {
+	CommandOpts
+}
+
+func DefaultCommandOpts() CommandOpts {
+	return CommandOpts{
+		ExitCodes: []int{0},
+	}
+}
+
+func NewCommand(command string, opts ...CommandOptsFunc) *Command {
+	o := DefaultCommandOpts()
+	o.Command = command
+	for _, fn := range opts {
+		fn(&o)
+	}
+	return &Command{
+		CommandOpts: o,
+	}
+}
+
+var envName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func (a Command) Handle(ctx context.Context, ex core.Executor, os core.OS, observer core.ActionObserver) error {
+	return core.WithObserver(observer, func() error {
+		for key := range a.Env {
+			if !envName.MatchString(key) {
+				return fmt.Errorf("invalid environment variable name %q", key)
+			}
+		}
+
+		if a.skip(ctx, ex, observer) {
+			return core.ReportResult(observer, core.ActionResult{ID: "command " + a.Command, Changed: false})
+		}
+
+		_, err := ex.Execute(ctx, a.shellCommand(), observer)
+		code, ok := core.ExitCode(err)
+		if !ok {
+			return err
+		}
+		if !slices.Contains(a.ExitCodes, code) {
+			return fmt.Errorf("command %q exited with %d", a.Command, code)
+		}
+
+		return core.ReportResult(observer, core.ActionResult{ID: "command " + a.Command, Changed: true})
+	})
+}
+
+// skip runs the guards, reporting whether any of them says not to run the
+// command. They run in the command's directory and environment, so relative
+// paths and variables mean the same to them as to the command.
+func (a Command) skip(ctx context.Context, ex core.Executor, observer core.ActionObserver) bool {
+	guards := []struct {
+		probe    string
+		skipWhen bool
+	}{
+		{a.testExists(a.Creates), true},
+		{a.testExists(a.Removes), false},
+		{a.Unless, true},
+		{a.OnlyIf, false},
+	}
+
+	for _, guard := range guards {
+		if guard.probe == "" {
+			continue
+		}
+		_, err := ex.Execute(ctx, a.inContext(guard.probe), observer)
+		// A dry run can't know the outcome, so it shows the command running
+		if core.IsDryRun(ex) {
+			continue
+		}
+		if (err == nil) == guard.skipWhen {
+			return true
+		}
+	}
+	return false
+}
+
+func (a Command) testExists(path string) string {
+	if path == "" {
+		return ""
+	}
+	return fmt.Sprintf("test -e %s", core.ShellQuote(path))
+}
+
+func (a Command) shellCommand() string {
+	return a.inContext(a.Command)
+}
+
+// inContext prefixes command with the working directory and environment. The
+// command is grouped so that operators such as || in it can't bypass the
+// prefix, and on its own line so a trailing comment can't swallow the closing
+// brace.
+func (a Command) inContext(command string) string {
+	var parts []string
+	if a.Dir != "" {
+		parts = append(parts, "cd "+core.ShellQuote(a.Dir))
+	}
+
+	keys := make([]string, 0, len(a.Env))
+	for key := range a.Env {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		parts = append(parts, fmt.Sprintf("export %s=%s", key, core.ShellQuote(a.Env[key])))
+	}
+
+	if len(parts) == 0 {
+		return command
+	}
+	return strings.Join(parts, " && ") + " && {\n" + command + "\n}"
+}
+
+var _ core.Action = (*Command)(nil)
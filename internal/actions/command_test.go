@@ -0,0 +1,125 @@
+package actions
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+// exitError carries an exit status like *exec.ExitError
+type exitError struct {
+	code int
+}
+
+func (e exitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
+}
+
+func (e exitError) ExitCode() int {
+	return e.code
+}
+
+func Test_Command(t *testing.T) {
+	ex := &core.FakeExecutor{}
+	observer := &resultRecorder{}
+	action := NewCommand("./configure && make install", WithDir("/opt/app src"), WithEnv("PREFIX", "/usr/local"), WithEnv("CC", "gcc"))
+
+	if err := action.Handle(t.Context(), ex, core.Ubuntu{}, observer); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !ex.Executed("cd '/opt/app src' && export CC=gcc && export PREFIX=/usr/local && {\n./configure && make install\n}") {
+		t.Errorf("unexpected command: %v", ex.History)
+	}
+
+	if len(observer.Results) != 1 || !observer.Results[0].Changed {
+		t.Errorf("expected a single changed result, got %v", observer.Results)
+	}
+}
+
+func Test_Command_GuardsInContext(t *testing.T) {
+	ex := &core.FakeExecutor{}
+	action := NewCommand("make", WithDir("/srv/app"), WithEnv("TARGET", "out"), WithCreates("build/out"))
+
+	if err := action.Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !ex.Executed("cd /srv/app && export TARGET=out && {\ntest -e build/out\n}") {
+		t.Errorf("guard should run in the command's directory and environment: %v", ex.History)
+	}
+}
+
+func Test_Command_Guards(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      []CommandOptsFunc
+		responses map[string]core.FakeResponse
+		runs      bool
+	}{
+		{"creates exists", []CommandOptsFunc{WithCreates("/opt/app/bin")}, nil, false},
+		{"creates missing", []CommandOptsFunc{WithCreates("/opt/app/bin")}, map[string]core.FakeResponse{"test -e /opt/app/bin": {Err: exitError{1}}}, true},
+		{"removes exists", []CommandOptsFunc{WithRemoves("/tmp/build")}, nil, true},
+		{"removes missing", []CommandOptsFunc{WithRemoves("/tmp/build")}, map[string]core.FakeResponse{"test -e /tmp/build": {Err: exitError{1}}}, false},
+		{"unless succeeds", []CommandOptsFunc{WithUnless("app --version")}, nil, false},
+		{"onlyif fails", []CommandOptsFunc{WithOnlyIf("systemctl is-active app")}, map[string]core.FakeResponse{"systemctl is-active app": {Err: exitError{3}}}, false},
+		{"onlyif succeeds", []CommandOptsFunc{WithOnlyIf("systemctl is-active app")}, nil, true},
+	}
+
+	for _, tt := range tests {
+		ex := &core.FakeExecutor{Responses: tt.responses}
+		observer := &resultRecorder{}
+
+		if err := NewCommand("make install", tt.opts...).Handle(t.Context(), ex, core.Ubuntu{}, observer); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.name, err)
+		}
+
+		if ex.Executed("make install") != tt.runs {
+			t.Errorf("%s: expected command to run: %v, history %v", tt.name, tt.runs, ex.History)
+		}
+
+		if len(observer.Results) != 1 || observer.Results[0].Changed != tt.runs {
+			t.Errorf("%s: expected changed %v, got %v", tt.name, tt.runs, observer.Results)
+		}
+	}
+}
+
+func Test_Command_ExitCodes(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			"grep -q foo /etc/app.conf": {Err: exitError{1}},
+		},
+	}
+
+	if err := NewCommand("grep -q foo /etc/app.conf", WithExitCodes(0, 1)).Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Errorf("expected exit code 1 to be accepted: %v", err)
+	}
+
+	if err := NewCommand("grep -q foo /etc/app.conf").Handle(t.Context(), ex, core.Ubuntu{}, nil); err == nil {
+		t.Error("expected error for an unexpected exit code")
+	}
+}
+
+func Test_Command_DryRunShowsCommand(t *testing.T) {
+	ex := &core.DryRunExecutor{}
+
+	if err := NewCommand("make install", WithCreates("/opt/app/bin")).Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(ex.Commands) != 2 || ex.Commands[1] != "make install" {
+		t.Errorf("expected dry run to show the command: %v", ex.Commands)
+	}
+}
+
+func Test_ExitCode(t *testing.T) {
+	if code, ok := core.ExitCode(fmt.Errorf("wrapped: %w", exitError{2})); !ok || code != 2 {
+		t.Errorf("expected exit code 2, got %d %v", code, ok)
+	}
+
+	if _, ok := core.ExitCode(errors.New("ssh: connect to host")); ok {
+		t.Error("expected no exit code for an error without one")
+	}
+}
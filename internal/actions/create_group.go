@@ -0,0 +1,108 @@
+package actions
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+// GroupState is the desired state of a group
+type GroupState int
+
+const (
+	GroupPresent GroupState = iota
+	GroupAbsent
+)
+
+type CreateGroupOpts struct {
+	core.Group
+	State GroupState
+}
+
+type CreateGroupOptsFunc func(*CreateGroupOpts)
+
+func WithGID(gid int) CreateGroupOptsFunc {
+	return func(o *CreateGroupOpts) {
+		o.GID = &gid
+	}
+}
+
+func WithSystemGroup() CreateGroupOptsFunc {
+	return func(o *CreateGroupOpts) {
+		o.System = true
+	}
+}
+
+func WithGroupAbsent() CreateGroupOptsFunc {
+	return func(o *CreateGroupOpts) {
+		o.State = GroupAbsent
+	}
+}
+
+// CreateGroup ensures a local group exists, or is absent
+type CreateGroup struct {
+	CreateGroupOpts
+}
+
+func DefaultCreateGroupOpts() CreateGroupOpts {
+	return CreateGroupOpts{
+		State: GroupPresent,
+	}
+}
+
+func NewCreateGroup(name string, opts ...CreateGroupOptsFunc) *CreateGroup {
+	o := DefaultCreateGroupOpts()
+	o.Name = name
+	for _, fn := range opts {
+		fn(&o)
+	}
+	return &CreateGroup{
+		CreateGroupOpts: o,
+	}
+}
+
+// parseGroupGID returns the GID of a getent group line
+func parseGroupGID(name string, output string) (int, bool) {
+	fields := strings.Split(strings.TrimSpace(output), ":")
+	if len(fields) != 4 || fields[0] != name {
+		return 0, false
+	}
+	gid, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return 0, false
+	}
+	return gid, true
+}
+
+func (a CreateGroup) Handle(ctx context.Context, ex core.Executor, os core.OS, observer core.ActionObserver) error {
+	return core.WithObserver(observer, func() error {
+		output, err := ex.Execute(ctx, os.CheckGroup(a.Name), observer)
+		gid, exists := 0, false
+		if err == nil {
+			gid, exists = parseGroupGID(a.Name, output)
+		}
+
+		var command string
+		switch {
+		case a.State == GroupAbsent && exists:
+			command = os.RemoveGroup(a.Name)
+		case a.State == GroupPresent && !exists:
+			command = os.CreateGroup(a.Group)
+		case a.State == GroupPresent && a.GID != nil && *a.GID != gid:
+			command = os.ModifyGroup(a.Group)
+		}
+
+		if command != "" {
+			_, err = ex.Execute(ctx, command, observer)
+			if err != nil {
+				return err
+			}
+		}
+
+		return core.ReportResult(observer, core.ActionResult{ID: "group " + a.Name, Changed: command != ""})
+	})
+}
+
+var _ core.Action = (*CreateGroup)(nil)
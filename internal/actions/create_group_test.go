@@ -0,0 +1,85 @@
+package actions
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+func Test_CreateGroup(t *testing.T) {
+	os := core.Ubuntu{}
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			os.CheckGroup("deploy"): {Err: errors.New("exit status 2")},
+		},
+	}
+	action := NewCreateGroup("deploy", WithGID(2000), WithSystemGroup())
+
+	if err := action.Handle(t.Context(), ex, os, nil); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if !ex.Executed("groupadd -r -g 2000 deploy") {
+		t.Errorf("did not create group: %v", ex.History)
+	}
+}
+
+func Test_CreateGroup_Exists(t *testing.T) {
+	os := core.Fedora{}
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			os.CheckGroup("deploy"): {Output: "deploy:x:2000:alice,bob\n"},
+		},
+	}
+	observer := &resultRecorder{}
+	action := NewCreateGroup("deploy", WithGID(2000))
+
+	if err := action.Handle(t.Context(), ex, os, observer); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if len(ex.History) != 1 {
+		t.Errorf("should only check an existing group: %v", ex.History)
+	}
+
+	if len(observer.Results) != 1 || observer.Results[0].Changed {
+		t.Errorf("expected a single unchanged result, got %v", observer.Results)
+	}
+}
+
+func Test_CreateGroup_ChangesGID(t *testing.T) {
+	os := core.Debian{}
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			os.CheckGroup("deploy"): {Output: "deploy:x:1001:\n"},
+		},
+	}
+	action := NewCreateGroup("deploy", WithGID(2000))
+
+	if err := action.Handle(t.Context(), ex, os, nil); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if !ex.Executed("groupmod -g 2000 deploy") {
+		t.Errorf("did not change the group's GID: %v", ex.History)
+	}
+}
+
+func Test_CreateGroup_Absent(t *testing.T) {
+	os := core.Debian{}
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			os.CheckGroup("legacy"): {Output: "legacy:x:1005:\n"},
+		},
+	}
+	action := NewCreateGroup("legacy", WithGroupAbsent())
+
+	if err := action.Handle(t.Context(), ex, os, nil); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if !ex.Executed(os.RemoveGroup("legacy")) {
+		t.Errorf("did not remove the group: %v", ex.History)
+	}
+}
@@ -2,20 +2,133 @@ package actions
 
 import (
 	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/johnnyfreeman/anvil/internal/core"
 )
 
+// UserState is the desired state of a user account
+type UserState int
+
+const (
+	UserPresent UserState = iota
+	UserAbsent
+)
+
 type CreateUserOpts struct {
+	core.User
 	Username string
-	Group    *string
+	// Locked locks (true) or unlocks (false) the account's password. Nil
+	// leaves it as it is.
+	Locked     *bool
+	State      UserState
+	RemoveHome bool
+	// EnsureGroups creates the user's groups before the user if they don't
+	// exist
+	EnsureGroups bool
 }
 
 type CreateUserOptsFunc func(*CreateUserOpts)
 
+// WithGroup adds the user to group, leaving its other groups alone
 func WithGroup(group string) CreateUserOptsFunc {
 	return func(o *CreateUserOpts) {
-		o.Group = &group
+		o.Groups = append(o.Groups, group)
+		o.AppendGroups = true
+	}
+}
+
+// WithGroups sets the user's supplementary groups to exactly groups, unless
+// WithAppendGroups is also given
+func WithGroups(groups ...string) CreateUserOptsFunc {
+	return func(o *CreateUserOpts) {
+		o.Groups = append(o.Groups, groups...)
+	}
+}
+
+// WithAppendGroups adds the user to its groups without removing it from
+// others
+func WithAppendGroups() CreateUserOptsFunc {
+	return func(o *CreateUserOpts) {
+		o.AppendGroups = true
+	}
+}
+
+func WithPrimaryGroup(group string) CreateUserOptsFunc {
+	return func(o *CreateUserOpts) {
+		o.Group = group
+	}
+}
+
+func WithUID(uid int) CreateUserOptsFunc {
+	return func(o *CreateUserOpts) {
+		o.UID = &uid
+	}
+}
+
+func WithShell(shell string) CreateUserOptsFunc {
+	return func(o *CreateUserOpts) {
+		o.Shell = shell
+	}
+}
+
+func WithHome(home string) CreateUserOptsFunc {
+	return func(o *CreateUserOpts) {
+		o.Home = home
+	}
+}
+
+// WithSystemUser creates a system account, which only gets a home directory
+// when WithHome is given
+func WithSystemUser() CreateUserOptsFunc {
+	return func(o *CreateUserOpts) {
+		o.System = true
+	}
+}
+
+func WithComment(comment string) CreateUserOptsFunc {
+	return func(o *CreateUserOpts) {
+		o.Comment = comment
+	}
+}
+
+// WithPasswordHash sets the user's password to an already hashed value
+func WithPasswordHash(hash string) CreateUserOptsFunc {
+	return func(o *CreateUserOpts) {
+		o.Password = hash
+	}
+}
+
+func WithLocked(locked bool) CreateUserOptsFunc {
+	return func(o *CreateUserOpts) {
+		o.Locked = &locked
+	}
+}
+
+// WithExpires sets the date the account expires on as YYYY-MM-DD, or "never"
+func WithExpires(date string) CreateUserOptsFunc {
+	return func(o *CreateUserOpts) {
+		o.Expires = date
+	}
+}
+
+// WithEnsureGroups creates the user's primary and supplementary groups if
+// they don't exist yet
+func WithEnsureGroups() CreateUserOptsFunc {
+	return func(o *CreateUserOpts) {
+		o.EnsureGroups = true
+	}
+}
+
+// WithUserAbsent removes the user, and its home directory if removeHome is set
+func WithUserAbsent(removeHome bool) CreateUserOptsFunc {
+	return func(o *CreateUserOpts) {
+		o.State = UserAbsent
+		o.RemoveHome = removeHome
 	}
 }
 
@@ -26,6 +139,7 @@ type CreateUser struct {
 func DefaultCreateUserOpts() CreateUserOpts {
 	return CreateUserOpts{
 		Username: "",
+		State:    UserPresent,
 	}
 }
 
@@ -35,31 +149,276 @@ func NewCreateUser(username string, opts ...CreateUserOptsFunc) *CreateUser {
 	for _, fn := range opts {
 		fn(&o)
 	}
+	o.Name = o.Username
 	return &CreateUser{
 		CreateUserOpts: o,
 	}
 }
 
+// passwdEntry is a parsed line of getent passwd output
+type passwdEntry struct {
+	Name    string
+	UID     int
+	GID     int
+	Comment string
+	Home    string
+	Shell   string
+}
+
+func parsePasswdEntry(username string, output string) (passwdEntry, bool) {
+	fields := strings.Split(strings.TrimSpace(output), ":")
+	if len(fields) != 7 || fields[0] != username {
+		return passwdEntry{}, false
+	}
+	uid, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return passwdEntry{}, false
+	}
+	gid, err := strconv.Atoi(fields[3])
+	if err != nil {
+		return passwdEntry{}, false
+	}
+	return passwdEntry{
+		Name:    fields[0],
+		UID:     uid,
+		GID:     gid,
+		Comment: fields[4],
+		Home:    fields[5],
+		Shell:   fields[6],
+	}, true
+}
+
 func (a CreateUser) Handle(ctx context.Context, ex core.Executor, os core.OS, observer core.ActionObserver) error {
 	return core.WithObserver(observer, func() error {
-		_, err := ex.Execute(ctx, os.CheckUser(a.Username), observer)
+		if err := a.validate(); err != nil {
+			return err
+		}
 
-		if err != nil {
-			_, err = ex.Execute(ctx, os.CreateUser(a.Username), observer)
-			if err != nil {
+		if a.EnsureGroups && a.State == UserPresent {
+			if err := a.ensureGroups(ctx, ex, os, observer); err != nil {
 				return err
 			}
 		}
 
-		if a.CreateUserOpts.Group != nil {
-			_, err = ex.Execute(ctx, os.GroupUser(a.CreateUserOpts.Username, *a.CreateUserOpts.Group), observer)
-			if err != nil {
-				return err
-			}
+		output, err := ex.Execute(ctx, os.CheckUser(a.Username), observer)
+		current, exists := passwdEntry{}, false
+		if err == nil {
+			current, exists = parsePasswdEntry(a.Username, output)
 		}
 
-		return nil
+		var changed bool
+		switch {
+		case a.State == UserAbsent && !exists:
+			changed = false
+		case a.State == UserAbsent:
+			_, err = ex.Execute(ctx, os.RemoveUser(a.Username, a.RemoveHome), observer)
+			changed = true
+		case !exists:
+			changed, err = a.create(ctx, ex, os, observer)
+		default:
+			changed, err = a.update(ctx, ex, os, observer, current)
+		}
+		if err != nil {
+			return err
+		}
+
+		return core.ReportResult(observer, core.ActionResult{ID: "user " + a.Username, Changed: changed})
 	})
 }
 
+func (a CreateUser) ensureGroups(ctx context.Context, ex core.Executor, os core.OS, observer core.ActionObserver) error {
+	groups := a.Groups
+	if a.Group != "" {
+		groups = append([]string{a.Group}, groups...)
+	}
+	for _, group := range groups {
+		if err := NewCreateGroup(group).Handle(ctx, ex, os, observer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a CreateUser) validate() error {
+	if a.Expires != "" && a.Expires != "never" {
+		if _, err := time.Parse(time.DateOnly, a.Expires); err != nil {
+			return fmt.Errorf("invalid expiry date %q for user %s: expected YYYY-MM-DD or never", a.Expires, a.Username)
+		}
+	}
+	return nil
+}
+
+func (a CreateUser) create(ctx context.Context, ex core.Executor, os core.OS, observer core.ActionObserver) (bool, error) {
+	_, err := ex.Execute(ctx, os.CreateUser(a.User), observer)
+	if err != nil {
+		return false, err
+	}
+
+	if a.Locked != nil && *a.Locked {
+		_, err = ex.Execute(ctx, os.LockUser(a.Username), observer)
+		if err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// update modifies the attributes of an existing user that differ from the
+// desired ones
+func (a CreateUser) update(ctx context.Context, ex core.Executor, os core.OS, observer core.ActionObserver, current passwdEntry) (bool, error) {
+	diff := core.User{Name: a.Username}
+	modified := false
+
+	if a.UID != nil && *a.UID != current.UID {
+		diff.UID = a.UID
+		modified = true
+	}
+	if a.Shell != "" && a.Shell != current.Shell {
+		diff.Shell = a.Shell
+		modified = true
+	}
+	if a.Home != "" && a.Home != current.Home {
+		diff.Home = a.Home
+		modified = true
+	}
+	if a.Comment != "" && a.Comment != current.Comment {
+		diff.Comment = a.Comment
+		modified = true
+	}
+
+	if a.Group != "" || len(a.Groups) > 0 {
+		groupsDiff, err := a.groupsDiff(ctx, ex, os, observer)
+		if err != nil {
+			return false, err
+		}
+		if groupsDiff.Group != "" || len(groupsDiff.Groups) > 0 {
+			diff.Group = groupsDiff.Group
+			diff.Groups = groupsDiff.Groups
+			diff.AppendGroups = groupsDiff.AppendGroups
+			modified = true
+		}
+	}
+
+	lockChange := ""
+	if a.Password != "" || a.Expires != "" || a.Locked != nil {
+		shadow, err := ex.Execute(ctx, os.CheckUserPassword(a.Username), observer)
+		if err != nil {
+			return false, err
+		}
+		hash, locked, expires := parseShadowEntry(shadow)
+
+		if a.Password != "" && a.Password != hash {
+			diff.Password = a.Password
+			modified = true
+		}
+		if a.Expires != "" && a.Expires != expires {
+			diff.Expires = a.Expires
+			modified = true
+		}
+		if a.Locked != nil && *a.Locked != locked {
+			lockChange = "unlock"
+			if *a.Locked {
+				lockChange = "lock"
+			}
+		}
+	}
+
+	if modified {
+		_, err := ex.Execute(ctx, os.ModifyUser(diff), observer)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	switch lockChange {
+	case "lock":
+		_, err := ex.Execute(ctx, os.LockUser(a.Username), observer)
+		if err != nil {
+			return false, err
+		}
+	case "unlock":
+		_, err := ex.Execute(ctx, os.UnlockUser(a.Username), observer)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return modified || lockChange != "", nil
+}
+
+// groupsDiff compares the user's current groups with the desired ones and
+// returns the group fields that need to change
+func (a CreateUser) groupsDiff(ctx context.Context, ex core.Executor, os core.OS, observer core.ActionObserver) (core.User, error) {
+	output, err := ex.Execute(ctx, os.CheckUserGroups(a.Username), observer)
+	if err != nil {
+		return core.User{}, err
+	}
+
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	primary := strings.TrimSpace(lines[0])
+	var supplementary []string
+	if len(lines) > 1 {
+		for _, group := range strings.Fields(lines[1]) {
+			if group != primary {
+				supplementary = append(supplementary, group)
+			}
+		}
+	}
+
+	diff := core.User{}
+	if a.Group != "" && a.Group != primary {
+		diff.Group = a.Group
+	}
+
+	if a.AppendGroups {
+		for _, group := range a.Groups {
+			if !slices.Contains(supplementary, group) && group != primary {
+				diff.Groups = append(diff.Groups, group)
+			}
+		}
+		diff.AppendGroups = true
+		return diff, nil
+	}
+
+	if len(a.Groups) > 0 {
+		// id never lists the primary group as a supplementary one, so asking
+		// for it among the groups mustn't count as a difference
+		wantPrimary := primary
+		if a.Group != "" {
+			wantPrimary = a.Group
+		}
+		var desired []string
+		for _, group := range a.Groups {
+			if group != wantPrimary && !slices.Contains(desired, group) {
+				desired = append(desired, group)
+			}
+		}
+		sorted := slices.Sorted(slices.Values(desired))
+		slices.Sort(supplementary)
+		if !slices.Equal(sorted, supplementary) {
+			diff.Groups = desired
+		}
+	}
+	return diff, nil
+}
+
+// parseShadowEntry returns the password hash, lock state and expiry date of
+// a getent shadow line
+func parseShadowEntry(output string) (string, bool, string) {
+	fields := strings.Split(strings.TrimSpace(output), ":")
+	if len(fields) < 8 {
+		return "", false, ""
+	}
+
+	hash := fields[1]
+	locked := strings.HasPrefix(hash, "!")
+	hash = strings.TrimPrefix(hash, "!")
+
+	expires := "never"
+	if days, err := strconv.Atoi(fields[7]); err == nil {
+		expires = time.Unix(0, 0).UTC().AddDate(0, 0, days).Format(time.DateOnly)
+	}
+	return hash, locked, expires
+}
+
 var _ core.Action = (*CreateUser)(nil)
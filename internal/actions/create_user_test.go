@@ -2,6 +2,7 @@ package actions
 
 import (
 	"errors"
+	"strings"
 	"testing"
 
 	"github.com/johnnyfreeman/anvil/internal/core"
@@ -25,7 +26,7 @@ func Test_CreateUser(t *testing.T) {
 		t.Error("did not execute command to check if user exists")
 	}
 
-	if !ex.Executed(os.CreateUser(username)) {
+	if !ex.Executed(os.CreateUser(core.User{Name: username})) {
 		t.Error("did not execute command to create user")
 	}
 }
@@ -49,12 +50,8 @@ func Test_CreateUserWithGroup(t *testing.T) {
 		t.Error("did not execute command to check if user exists")
 	}
 
-	if !ex.Executed(os.CreateUser(username)) {
-		t.Error("did not execute command to create user")
-	}
-
-	if !ex.Executed(os.GroupUser(username, group)) {
-		t.Error("did not execute command to group user")
+	if !ex.Executed(os.CreateUser(core.User{Name: username, Groups: []string{group}})) {
+		t.Error("did not execute command to create user in group")
 	}
 }
 
@@ -63,7 +60,7 @@ func Test_CreateUser_UserExists(t *testing.T) {
 	os := core.Ubuntu{}
 	ex := &core.FakeExecutor{
 		Responses: map[string]core.FakeResponse{
-			os.CheckUser(username): {Output: "1002"},
+			os.CheckUser(username): {Output: "john:x:1002:1002::/home/john:/bin/sh\n"},
 		},
 	}
 	action := NewCreateUser(username)
@@ -79,7 +76,7 @@ func Test_CreateUser_UserExists(t *testing.T) {
 	}
 
 	// If the user exists, the command to create the user should not have been executed.
-	if ex.Executed(os.CreateUser(username)) {
+	if ex.Executed(os.CreateUser(core.User{Name: username})) {
 		t.Error("should not execute command to create user when user already exists")
 	}
 }
@@ -89,7 +86,7 @@ func Test_CreateUser_StreamOutput(t *testing.T) {
 	os := core.Ubuntu{}
 	ex := &core.FakeExecutor{
 		Responses: map[string]core.FakeResponse{
-			os.CheckUser(username): {Output: "1002"},
+			os.CheckUser(username): {Output: "john:x:1002:1002::/home/john:/bin/sh\n"},
 		},
 	}
 	action := NewCreateUser(username)
@@ -105,7 +102,151 @@ func Test_CreateUser_StreamOutput(t *testing.T) {
 	}
 
 	// If the user exists, the command to create the user should not have been executed.
-	if ex.Executed(os.CreateUser(username)) {
+	if ex.Executed(os.CreateUser(core.User{Name: username})) {
 		t.Error("should not execute command to create user when user already exists")
 	}
 }
+
+func Test_CreateUser_Unchanged(t *testing.T) {
+	username := "deploy"
+	os := core.Fedora{}
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			os.CheckUser(username):       {Output: "deploy:x:1500:1500:Deploy:/srv/deploy:/bin/bash\n"},
+			os.CheckUserGroups(username): {Output: "deploy\ndeploy wheel\n"},
+		},
+	}
+	observer := &resultRecorder{}
+	action := NewCreateUser(username, WithUID(1500), WithShell("/bin/bash"), WithHome("/srv/deploy"), WithGroups("wheel"))
+
+	if err := action.Handle(t.Context(), ex, os, observer); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	for _, command := range ex.History {
+		if strings.HasPrefix(command, "usermod") || strings.HasPrefix(command, "useradd") {
+			t.Errorf("should not modify a user that matches: %s", command)
+		}
+	}
+
+	if len(observer.Results) != 1 || observer.Results[0].Changed {
+		t.Errorf("expected a single unchanged result, got %v", observer.Results)
+	}
+}
+
+func Test_CreateUser_PrimaryGroupInGroups(t *testing.T) {
+	username := "deploy"
+	os := core.Ubuntu{}
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			os.CheckUser(username):       {Output: "deploy:x:1500:1500::/home/deploy:/bin/bash\n"},
+			os.CheckUserGroups(username): {Output: "deploy\ndeploy sudo\n"},
+		},
+	}
+	observer := &resultRecorder{}
+	action := NewCreateUser(username, WithPrimaryGroup("deploy"), WithGroups("deploy", "sudo"))
+
+	if err := action.Handle(t.Context(), ex, os, observer); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	for _, command := range ex.History {
+		if strings.HasPrefix(command, "usermod") {
+			t.Errorf("should not modify a user whose primary group is listed in its groups: %s", command)
+		}
+	}
+
+	if len(observer.Results) != 1 || observer.Results[0].Changed {
+		t.Errorf("expected a single unchanged result, got %v", observer.Results)
+	}
+}
+
+func Test_CreateUser_UpdatesDifferences(t *testing.T) {
+	username := "deploy"
+	os := core.Ubuntu{}
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			os.CheckUser(username):         {Output: "deploy:x:1500:1500::/home/deploy:/bin/sh\n"},
+			os.CheckUserGroups(username):   {Output: "deploy\ndeploy audio sudo\n"},
+			os.CheckUserPassword(username): {Output: "deploy:$6$old:19000:0:99999:7:::\n"},
+		},
+	}
+	action := NewCreateUser(username,
+		WithUID(1500),
+		WithShell("/bin/bash"),
+		WithGroups("sudo", "www-data"),
+		WithLocked(true),
+	)
+
+	if err := action.Handle(t.Context(), ex, os, nil); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	expected := os.ModifyUser(core.User{Name: username, Shell: "/bin/bash", Groups: []string{"sudo", "www-data"}})
+	if !ex.Executed(expected) {
+		t.Errorf("did not modify only the differing attributes: %v", ex.History)
+	}
+
+	if !ex.Executed(os.LockUser(username)) {
+		t.Error("did not lock the user")
+	}
+}
+
+func Test_CreateUser_Absent(t *testing.T) {
+	username := "olduser"
+	os := core.Debian{}
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			os.CheckUser(username): {Output: "olduser:x:1003:1003::/home/olduser:/bin/bash\n"},
+		},
+	}
+	action := NewCreateUser(username, WithUserAbsent(true))
+
+	if err := action.Handle(t.Context(), ex, os, nil); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if !ex.Executed("userdel -r olduser") {
+		t.Errorf("did not remove the user: %v", ex.History)
+	}
+}
+
+func Test_CreateUser_InvalidExpiry(t *testing.T) {
+	action := NewCreateUser("john", WithExpires("tomorrow"))
+
+	if err := action.Handle(t.Context(), &core.FakeExecutor{}, core.Ubuntu{}, nil); err == nil {
+		t.Error("expected error for an invalid expiry date")
+	}
+}
+
+func Test_ParseShadowEntry(t *testing.T) {
+	hash, locked, expires := parseShadowEntry("deploy:!$6$abc:19000:0:99999:7::19723:\n")
+	if hash != "$6$abc" || !locked || expires != "2024-01-01" {
+		t.Errorf("unexpected shadow entry: %s %v %s", hash, locked, expires)
+	}
+}
+
+func Test_CreateUser_EnsureGroups(t *testing.T) {
+	username := "john"
+	os := core.Ubuntu{}
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			os.CheckGroup("sudo"):   {Output: "sudo:x:27:\n"},
+			os.CheckGroup("deploy"): {Err: errors.New("exit status 2")},
+			os.CheckUser(username):  {Err: errors.New("exit status 2")},
+		},
+	}
+	action := NewCreateUser(username, WithGroups("sudo", "deploy"), WithEnsureGroups())
+
+	if err := action.Handle(t.Context(), ex, os, nil); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if ex.Executed(os.CreateGroup(core.Group{Name: "sudo"})) {
+		t.Error("should not create a group that exists")
+	}
+
+	if !ex.Executed(os.CreateGroup(core.Group{Name: "deploy"})) {
+		t.Error("did not create missing group")
+	}
+}
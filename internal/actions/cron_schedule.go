@@ -0,0 +1,166 @@
+package actions
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// cronMacros maps the @ schedules cron understands to systemd calendar
+// events. @reboot has no calendar event; timers use OnBootSec for it.
+var cronMacros = map[string]string{
+	"@reboot":   "",
+	"@yearly":   "yearly",
+	"@annually": "yearly",
+	"@monthly":  "monthly",
+	"@weekly":   "weekly",
+	"@daily":    "daily",
+	"@midnight": "daily",
+	"@hourly":   "hourly",
+}
+
+// cronField describes one of the five fields of a cron schedule
+type cronField struct {
+	Name  string
+	Min   int
+	Max   int
+	Names []string
+}
+
+var cronFields = []cronField{
+	{Name: "minute", Min: 0, Max: 59},
+	{Name: "hour", Min: 0, Max: 23},
+	{Name: "day of month", Min: 1, Max: 31},
+	{Name: "month", Min: 1, Max: 12, Names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	{Name: "day of week", Min: 0, Max: 7, Names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+// cronSchedule is a parsed cron schedule, either a macro such as @daily or
+// the values each of the five fields matches
+type cronSchedule struct {
+	Macro  string
+	Fields []string
+	Values [][]int
+}
+
+// parseCronSchedule validates a cron schedule such as "*/15 2 * * mon-fri"
+// or "@daily"
+func parseCronSchedule(schedule string) (cronSchedule, error) {
+	schedule = strings.TrimSpace(schedule)
+	if strings.HasPrefix(schedule, "@") {
+		if _, ok := cronMacros[schedule]; !ok {
+			return cronSchedule{}, fmt.Errorf("invalid schedule %q: unknown macro", schedule)
+		}
+		return cronSchedule{Macro: schedule}, nil
+	}
+
+	fields := strings.Fields(schedule)
+	if len(fields) != len(cronFields) {
+		return cronSchedule{}, fmt.Errorf("invalid schedule %q: expected 5 fields, got %d", schedule, len(fields))
+	}
+
+	parsed := cronSchedule{Fields: fields}
+	for i, field := range fields {
+		values, err := cronFields[i].parse(field)
+		if err != nil {
+			return cronSchedule{}, fmt.Errorf("invalid schedule %q: %w", schedule, err)
+		}
+		parsed.Values = append(parsed.Values, values)
+	}
+	return parsed, nil
+}
+
+// parse returns the sorted values a field such as 1,15 or 9-17/2 matches
+func (f cronField) parse(field string) ([]int, error) {
+	var values []int
+	for _, part := range strings.Split(field, ",") {
+		base, stepText, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepText)
+			if err != nil || step < 1 {
+				return nil, fmt.Errorf("invalid step %q in %s", stepText, f.Name)
+			}
+		}
+
+		low, high := f.Min, f.Max
+		if base != "*" {
+			lowText, highText, isRange := strings.Cut(base, "-")
+			var err error
+			if low, err = f.value(lowText); err != nil {
+				return nil, err
+			}
+			high = low
+			if isRange {
+				if high, err = f.value(highText); err != nil {
+					return nil, err
+				}
+			} else if hasStep {
+				// n/step runs from n to the end of the range
+				high = f.Max
+			}
+			if low > high {
+				return nil, fmt.Errorf("invalid range %q in %s", base, f.Name)
+			}
+		}
+
+		for v := low; v <= high; v += step {
+			// Sunday is both 0 and 7
+			if f.Max == 7 && v == 7 {
+				values = append(values, 0)
+				continue
+			}
+			values = append(values, v)
+		}
+	}
+	slices.Sort(values)
+	return slices.Compact(values), nil
+}
+
+func (f cronField) value(text string) (int, error) {
+	if i := slices.Index(f.Names, strings.ToLower(text)); i >= 0 {
+		return i + f.Min, nil
+	}
+	v, err := strconv.Atoi(text)
+	if err != nil || v < f.Min || v > f.Max {
+		return 0, fmt.Errorf("invalid %s %q: expected %d-%d", f.Name, text, f.Min, f.Max)
+	}
+	return v, nil
+}
+
+// onCalendar returns the schedule as a systemd calendar event, e.g.
+// "*/15 2 * * mon-fri" becomes "Mon,Tue,Wed,Thu,Fri *-*-* 2:0,15,30,45:00".
+// Cron runs a job when either the day of month or the day of week matches if
+// both are restricted, which a calendar event can't express.
+func (s cronSchedule) onCalendar() (string, error) {
+	if s.Macro != "" {
+		return cronMacros[s.Macro], nil
+	}
+	if s.Fields[2] != "*" && s.Fields[4] != "*" {
+		return "", fmt.Errorf("schedule %q restricts both day of month and day of week, which a timer can't express", strings.Join(s.Fields, " "))
+	}
+
+	list := func(i int) string {
+		if s.Fields[i] == "*" {
+			return "*"
+		}
+		values := make([]string, len(s.Values[i]))
+		for j, v := range s.Values[i] {
+			values[j] = strconv.Itoa(v)
+		}
+		return strings.Join(values, ",")
+	}
+
+	event := fmt.Sprintf("*-%s-%s %s:%s:00", list(3), list(2), list(1), list(0))
+	if s.Fields[4] != "*" {
+		days := []string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"}
+		var names []string
+		for _, v := range s.Values[4] {
+			names = append(names, days[v])
+		}
+		event = strings.Join(names, ",") + " " + event
+	}
+	return event, nil
+}
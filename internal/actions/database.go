@@ -0,0 +1,208 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+// DatabaseState is the desired state of a database or database user
+type DatabaseState int
+
+const (
+	DatabasePresent DatabaseState = iota
+	DatabaseAbsent
+)
+
+type DatabaseOpts struct {
+	Name   string
+	Engine DatabaseEngine
+	// Charset is the character set, or the encoding for PostgreSQL. MySQL
+	// databases are created as utf8mb4 unless it is set, PostgreSQL ones
+	// with the server's encoding.
+	Charset string
+	// Collation is the MySQL collation, the character set's default if
+	// empty
+	Collation string
+	// Owner is the role owning a PostgreSQL database
+	Owner string
+	State DatabaseState
+}
+
+type DatabaseOptsFunc func(*DatabaseOpts)
+
+func WithCharset(charset string) DatabaseOptsFunc {
+	return func(o *DatabaseOpts) {
+		o.Charset = charset
+	}
+}
+
+func WithCollation(collation string) DatabaseOptsFunc {
+	return func(o *DatabaseOpts) {
+		o.Collation = collation
+	}
+}
+
+func WithDatabaseOwner(owner string) DatabaseOptsFunc {
+	return func(o *DatabaseOpts) {
+		o.Owner = owner
+	}
+}
+
+func WithDatabaseAbsent() DatabaseOptsFunc {
+	return func(o *DatabaseOpts) {
+		o.State = DatabaseAbsent
+	}
+}
+
+// Database creates or drops a MySQL or PostgreSQL database, changing the
+// character set or owner of an existing one when they differ
+type Database struct {
+	DatabaseOpts
+}
+
+func DefaultDatabaseOpts() DatabaseOpts {
+	return DatabaseOpts{
+		State: DatabasePresent,
+	}
+}
+
+func NewMySQLDatabase(name string, opts ...DatabaseOptsFunc) *Database {
+	return newDatabase(name, MySQL, opts)
+}
+
+func NewPostgresDatabase(name string, opts ...DatabaseOptsFunc) *Database {
+	return newDatabase(name, PostgreSQL, opts)
+}
+
+func newDatabase(name string, engine DatabaseEngine, opts []DatabaseOptsFunc) *Database {
+	o := DefaultDatabaseOpts()
+	o.Name = name
+	o.Engine = engine
+	for _, fn := range opts {
+		fn(&o)
+	}
+	return &Database{
+		DatabaseOpts: o,
+	}
+}
+
+var charsetName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+func (a Database) Handle(ctx context.Context, ex core.Executor, os core.OS, observer core.ActionObserver) error {
+	return core.WithObserver(observer, func() error {
+		if a.Name == "" || len(a.Name) > 63 {
+			return fmt.Errorf("invalid database name %q", a.Name)
+		}
+		for _, value := range []string{a.Charset, a.Collation} {
+			if value != "" && !charsetName.MatchString(value) {
+				return fmt.Errorf("invalid character set or collation %q for database %s", value, a.Name)
+			}
+		}
+
+		var statements []string
+		var err error
+		if a.Engine == PostgreSQL {
+			statements, err = a.postgresStatements(ctx, ex, observer)
+		} else {
+			statements, err = a.mysqlStatements(ctx, ex, observer)
+		}
+		if err != nil {
+			return err
+		}
+
+		if len(statements) > 0 {
+			if err := sqlApply(ctx, ex, a.Engine, "database-"+a.Name, statements, observer); err != nil {
+				return err
+			}
+		}
+
+		return core.ReportResult(observer, core.ActionResult{ID: "database " + a.Name, Changed: len(statements) > 0})
+	})
+}
+
+func (a Database) mysqlStatements(ctx context.Context, ex core.Executor, observer core.ActionObserver) ([]string, error) {
+	rows, known, err := sqlQuery(ctx, ex, MySQL, "SELECT DEFAULT_CHARACTER_SET_NAME, DEFAULT_COLLATION_NAME FROM information_schema.SCHEMATA WHERE SCHEMA_NAME = "+MySQL.quoteString(a.Name), observer)
+	if err != nil {
+		return nil, err
+	}
+	name := MySQL.quoteIdent(a.Name)
+
+	if a.State == DatabaseAbsent {
+		if len(rows) == 0 && known {
+			return nil, nil
+		}
+		return []string{"DROP DATABASE IF EXISTS " + name}, nil
+	}
+
+	charset := a.Charset
+	if charset == "" {
+		charset = "utf8mb4"
+	}
+	spec := "CHARACTER SET " + charset
+	if a.Collation != "" {
+		spec += " COLLATE " + a.Collation
+	}
+
+	if len(rows) == 0 {
+		return []string{fmt.Sprintf("CREATE DATABASE %s %s", name, spec)}, nil
+	}
+	current := rows[0]
+	if len(current) < 2 {
+		return nil, fmt.Errorf("unexpected character set of database %s: %v", a.Name, current)
+	}
+	if (a.Charset != "" && !strings.EqualFold(current[0], a.Charset)) || (a.Collation != "" && !strings.EqualFold(current[1], a.Collation)) {
+		return []string{fmt.Sprintf("ALTER DATABASE %s %s", name, spec)}, nil
+	}
+	return nil, nil
+}
+
+func (a Database) postgresStatements(ctx context.Context, ex core.Executor, observer core.ActionObserver) ([]string, error) {
+	rows, known, err := sqlQuery(ctx, ex, PostgreSQL, "SELECT pg_get_userbyid(datdba), pg_encoding_to_char(encoding) FROM pg_database WHERE datname = "+PostgreSQL.quoteString(a.Name), observer)
+	if err != nil {
+		return nil, err
+	}
+	name := PostgreSQL.quoteIdent(a.Name)
+
+	if a.State == DatabaseAbsent {
+		if len(rows) == 0 && known {
+			return nil, nil
+		}
+		return []string{"DROP DATABASE IF EXISTS " + name}, nil
+	}
+
+	if len(rows) == 0 {
+		statement := "CREATE DATABASE " + name
+		if a.Owner != "" {
+			statement += " OWNER " + PostgreSQL.quoteIdent(a.Owner)
+		}
+		if a.Charset != "" {
+			// template1 may have been created with another encoding
+			statement += " ENCODING " + PostgreSQL.quoteString(a.Charset) + " TEMPLATE template0"
+		}
+		return []string{statement}, nil
+	}
+	current := rows[0]
+	if len(current) < 2 {
+		return nil, fmt.Errorf("unexpected owner and encoding of database %s: %v", a.Name, current)
+	}
+	if a.Charset != "" && !sameEncoding(current[1], a.Charset) {
+		return nil, fmt.Errorf("database %s has encoding %s, which PostgreSQL can't change to %s", a.Name, current[1], a.Charset)
+	}
+	if a.Owner != "" && current[0] != a.Owner {
+		return []string{fmt.Sprintf("ALTER DATABASE %s OWNER TO %s", name, PostgreSQL.quoteIdent(a.Owner))}, nil
+	}
+	return nil, nil
+}
+
+// sameEncoding compares PostgreSQL encoding names, which it accepts in any
+// case and with or without separators, e.g. UTF8 and utf-8
+func sameEncoding(a, b string) bool {
+	normalize := strings.NewReplacer("-", "", "_", "")
+	return strings.EqualFold(normalize.Replace(a), normalize.Replace(b))
+}
+
+var _ core.Action = (*Database)(nil)
@@ -0,0 +1,114 @@
+package actions
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+func Test_Database_MySQLCreate(t *testing.T) {
+	ex := &core.FakeExecutor{}
+	observer := &resultRecorder{}
+
+	if err := NewMySQLDatabase("app").Handle(t.Context(), ex, core.Ubuntu{}, observer); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "CREATE DATABASE `app` CHARACTER SET utf8mb4;\n"
+	if script := string(ex.Files["/run/anvil/database-app.sql"]); script != expected {
+		t.Errorf("unexpected script: %q", script)
+	}
+	if !ex.Executed("mysql < /run/anvil/database-app.sql; status=$?; rm -f /run/anvil/database-app.sql; exit $status") {
+		t.Errorf("did not run the script: %v", ex.History)
+	}
+	if len(observer.Results) != 1 || !observer.Results[0].Changed {
+		t.Errorf("expected a changed result, got %v", observer.Results)
+	}
+}
+
+func Test_Database_MySQLUnchanged(t *testing.T) {
+	query := MySQL.queryCommand("SELECT DEFAULT_CHARACTER_SET_NAME, DEFAULT_COLLATION_NAME FROM information_schema.SCHEMATA WHERE SCHEMA_NAME = 'app'")
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			query: {Output: "utf8mb4\tutf8mb4_0900_ai_ci\n"},
+		},
+	}
+	observer := &resultRecorder{}
+
+	if err := NewMySQLDatabase("app", WithCharset("utf8mb4")).Handle(t.Context(), ex, core.Ubuntu{}, observer); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(ex.Files) != 0 {
+		t.Errorf("expected no script, got %v", ex.Files)
+	}
+	if len(observer.Results) != 1 || observer.Results[0].Changed {
+		t.Errorf("expected an unchanged result, got %v", observer.Results)
+	}
+}
+
+func Test_Database_MySQLCollationChanged(t *testing.T) {
+	query := MySQL.queryCommand("SELECT DEFAULT_CHARACTER_SET_NAME, DEFAULT_COLLATION_NAME FROM information_schema.SCHEMATA WHERE SCHEMA_NAME = 'app'")
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			query: {Output: "utf8mb4\tutf8mb4_0900_ai_ci\n"},
+		},
+	}
+
+	if err := NewMySQLDatabase("app", WithCollation("utf8mb4_unicode_ci")).Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "ALTER DATABASE `app` CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;\n"
+	if script := string(ex.Files["/run/anvil/database-app.sql"]); script != expected {
+		t.Errorf("unexpected script: %q", script)
+	}
+}
+
+func Test_Database_PostgresOwner(t *testing.T) {
+	query := PostgreSQL.queryCommand("SELECT pg_get_userbyid(datdba), pg_encoding_to_char(encoding) FROM pg_database WHERE datname = 'app'")
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			query: {Output: "postgres\tUTF8\n"},
+		},
+	}
+
+	if err := NewPostgresDatabase("app", WithDatabaseOwner("app"), WithCharset("utf-8")).Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "ALTER DATABASE \"app\" OWNER TO \"app\";\n"
+	if script := string(ex.Files["/run/anvil/database-app.sql"]); script != expected {
+		t.Errorf("unexpected script: %q", script)
+	}
+	if !ex.Executed("cd / && runuser -u postgres -- psql -X -q -v ON_ERROR_STOP=1 -d postgres < /run/anvil/database-app.sql; status=$?; rm -f /run/anvil/database-app.sql; exit $status") {
+		t.Errorf("did not run the script through psql: %v", ex.History)
+	}
+}
+
+func Test_Database_PostgresEncodingMismatch(t *testing.T) {
+	query := PostgreSQL.queryCommand("SELECT pg_get_userbyid(datdba), pg_encoding_to_char(encoding) FROM pg_database WHERE datname = 'app'")
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			query: {Output: "app\tSQL_ASCII\n"},
+		},
+	}
+
+	err := NewPostgresDatabase("app", WithCharset("UTF8")).Handle(t.Context(), ex, core.Ubuntu{}, nil)
+	if err == nil || !strings.Contains(err.Error(), "SQL_ASCII") {
+		t.Fatalf("expected an encoding error, got %v", err)
+	}
+}
+
+func Test_Database_AbsentMissing(t *testing.T) {
+	ex := &core.FakeExecutor{}
+
+	if err := NewMySQLDatabase("app", WithDatabaseAbsent()).Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(ex.Files) != 0 {
+		t.Errorf("expected nothing to drop, got %v", ex.Files)
+	}
+}
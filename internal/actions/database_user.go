@@ -0,0 +1,356 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+// DatabaseGrant is a set of privileges on a database object
+type DatabaseGrant struct {
+	// On is db.* or db.table for MySQL, or a database for PostgreSQL
+	On         string
+	Privileges []string
+}
+
+type DatabaseUserOpts struct {
+	Name   string
+	Engine DatabaseEngine
+	// Host is the host MySQL accepts the user from, % for any
+	Host     string
+	Password string
+	// NoPassword creates the user without a password, for users that log in
+	// through the unix socket or peer authentication
+	NoPassword bool
+	// UpdatePassword sets the password of an existing user too. Servers only
+	// keep salted hashes, so the password can't be compared and the user is
+	// then reported as changed on every run.
+	UpdatePassword bool
+	// Grants are added to the privileges the user already has. Privileges
+	// that aren't listed are never revoked.
+	Grants []DatabaseGrant
+	State  DatabaseState
+}
+
+type DatabaseUserOptsFunc func(*DatabaseUserOpts)
+
+func WithUserHost(host string) DatabaseUserOptsFunc {
+	return func(o *DatabaseUserOpts) {
+		o.Host = host
+	}
+}
+
+// WithGrant grants privileges on db.* or db.table for MySQL, or on a
+// database for PostgreSQL, e.g. WithGrant("app.*", "ALL PRIVILEGES")
+func WithGrant(on string, privileges ...string) DatabaseUserOptsFunc {
+	return func(o *DatabaseUserOpts) {
+		o.Grants = append(o.Grants, DatabaseGrant{On: on, Privileges: privileges})
+	}
+}
+
+// WithoutPassword allows creating the user with an empty password
+func WithoutPassword() DatabaseUserOptsFunc {
+	return func(o *DatabaseUserOpts) {
+		o.NoPassword = true
+	}
+}
+
+func WithPasswordUpdate() DatabaseUserOptsFunc {
+	return func(o *DatabaseUserOpts) {
+		o.UpdatePassword = true
+	}
+}
+
+func WithDatabaseUserAbsent() DatabaseUserOptsFunc {
+	return func(o *DatabaseUserOpts) {
+		o.State = DatabaseAbsent
+	}
+}
+
+// DatabaseUser creates or drops a MySQL user or PostgreSQL login role and
+// grants it privileges. The password is only set when the user is created,
+// unless UpdatePassword is set.
+type DatabaseUser struct {
+	DatabaseUserOpts
+}
+
+func DefaultDatabaseUserOpts() DatabaseUserOpts {
+	return DatabaseUserOpts{
+		Host:  "localhost",
+		State: DatabasePresent,
+	}
+}
+
+func NewMySQLUser(name string, password string, opts ...DatabaseUserOptsFunc) *DatabaseUser {
+	return newDatabaseUser(name, password, MySQL, opts)
+}
+
+func NewPostgresUser(name string, password string, opts ...DatabaseUserOptsFunc) *DatabaseUser {
+	return newDatabaseUser(name, password, PostgreSQL, opts)
+}
+
+func newDatabaseUser(name string, password string, engine DatabaseEngine, opts []DatabaseUserOptsFunc) *DatabaseUser {
+	o := DefaultDatabaseUserOpts()
+	o.Name = name
+	o.Password = password
+	o.Engine = engine
+	for _, fn := range opts {
+		fn(&o)
+	}
+	return &DatabaseUser{
+		DatabaseUserOpts: o,
+	}
+}
+
+var (
+	// privilegeName matches privileges such as SELECT, ALL PRIVILEGES or
+	// UPDATE (email), which are written into statements as they are
+	privilegeName = regexp.MustCompile(`^[A-Za-z]+( [A-Za-z]+)*( ?\([A-Za-z0-9_, ]+\))?$`)
+	// mysqlGrantObject matches db.* and db.table, with optional backticks
+	mysqlGrantObject = regexp.MustCompile("^(\\*|`[^`]+`|[^.`*]+)\\.(\\*|`[^`]+`|[^.`*]+)$")
+	// mysqlGrant matches a line of SHOW GRANTS
+	mysqlGrant = regexp.MustCompile(`^GRANT (.+?) ON (.+?) TO `)
+)
+
+// postgresDatabasePrivileges are the privileges PostgreSQL has on databases
+var postgresDatabasePrivileges = []string{"CONNECT", "CREATE", "TEMPORARY"}
+
+func (a DatabaseUser) Handle(ctx context.Context, ex core.Executor, os core.OS, observer core.ActionObserver) error {
+	return core.WithObserver(observer, func() error {
+		if err := a.validate(); err != nil {
+			return err
+		}
+
+		var statements []string
+		var err error
+		if a.Engine == PostgreSQL {
+			statements, err = a.postgresStatements(ctx, ex, observer)
+		} else {
+			statements, err = a.mysqlStatements(ctx, ex, observer)
+		}
+		if err != nil {
+			return err
+		}
+
+		if len(statements) > 0 {
+			if err := sqlApply(ctx, ex, a.Engine, "user-"+a.Name, statements, observer, a.Password); err != nil {
+				return err
+			}
+		}
+
+		return core.ReportResult(observer, core.ActionResult{ID: "database user " + a.id(), Changed: len(statements) > 0})
+	})
+}
+
+func (a DatabaseUser) id() string {
+	if a.Engine == PostgreSQL {
+		return a.Name
+	}
+	return a.Name + "@" + a.Host
+}
+
+func (a DatabaseUser) validate() error {
+	if a.Name == "" || len(a.Name) > 63 {
+		return fmt.Errorf("invalid database user name %q", a.Name)
+	}
+	if a.Engine == MySQL && a.Host == "" {
+		return fmt.Errorf("database user %s needs a host", a.Name)
+	}
+	if a.State == DatabasePresent && a.Password == "" && !a.NoPassword {
+		return fmt.Errorf("database user %s needs a password, use WithoutPassword to create it without one", a.Name)
+	}
+	for _, grant := range a.Grants {
+		if grant.On == "" || (a.Engine == MySQL && !mysqlGrantObject.MatchString(grant.On)) {
+			return fmt.Errorf("invalid grant target %q for database user %s", grant.On, a.Name)
+		}
+		if len(grant.Privileges) == 0 {
+			return fmt.Errorf("grant on %s for database user %s has no privileges", grant.On, a.Name)
+		}
+		for _, privilege := range grant.Privileges {
+			if !privilegeName.MatchString(privilege) {
+				return fmt.Errorf("invalid privilege %q for database user %s", privilege, a.Name)
+			}
+			if a.Engine == PostgreSQL && len(postgresPrivileges(privilege)) == 0 {
+				return fmt.Errorf("invalid database privilege %q for PostgreSQL user %s", privilege, a.Name)
+			}
+		}
+	}
+	return nil
+}
+
+func (a DatabaseUser) mysqlStatements(ctx context.Context, ex core.Executor, observer core.ActionObserver) ([]string, error) {
+	rows, known, err := sqlQuery(ctx, ex, MySQL, fmt.Sprintf("SELECT 1 FROM mysql.user WHERE User = %s AND Host = %s", MySQL.quoteString(a.Name), MySQL.quoteString(a.Host)), observer)
+	if err != nil {
+		return nil, err
+	}
+	exists := len(rows) > 0
+	account := MySQL.quoteString(a.Name) + "@" + MySQL.quoteString(a.Host)
+
+	if a.State == DatabaseAbsent {
+		if !exists && known {
+			return nil, nil
+		}
+		return []string{"DROP USER IF EXISTS " + account}, nil
+	}
+
+	var statements []string
+	identified := ""
+	if a.Password != "" {
+		identified = " IDENTIFIED BY " + MySQL.quoteString(a.Password)
+	}
+	switch {
+	case !exists:
+		statements = append(statements, "CREATE USER "+account+identified)
+	case a.UpdatePassword && a.Password != "":
+		statements = append(statements, "ALTER USER "+account+identified)
+	}
+
+	current := map[string][]string{}
+	if exists {
+		rows, _, err := sqlQuery(ctx, ex, MySQL, "SHOW GRANTS FOR "+account, observer)
+		if err != nil {
+			return nil, err
+		}
+		current = parseMySQLGrants(rows)
+	}
+	for _, grant := range a.Grants {
+		object := mysqlGrantKey(grant.On)
+		if missingPrivileges(normalizePrivileges(grant.Privileges), current[object]) {
+			statements = append(statements, fmt.Sprintf("GRANT %s ON %s TO %s", strings.Join(grant.Privileges, ", "), mysqlQuoteObject(grant.On), account))
+		}
+	}
+	return statements, nil
+}
+
+// parseMySQLGrants returns the privileges of SHOW GRANTS rows by object
+func parseMySQLGrants(rows [][]string) map[string][]string {
+	grants := map[string][]string{}
+	for _, row := range rows {
+		match := mysqlGrant.FindStringSubmatch(row[0])
+		if match == nil {
+			continue
+		}
+		object := mysqlGrantKey(match[2])
+		grants[object] = append(grants[object], normalizePrivileges(strings.Split(match[1], ", "))...)
+	}
+	return grants
+}
+
+// mysqlGrantKey normalizes db.* for comparison with SHOW GRANTS, which quotes
+// names with backticks or not depending on the server version
+func mysqlGrantKey(object string) string {
+	return strings.ReplaceAll(object, "`", "")
+}
+
+// mysqlQuoteObject quotes the names in db.* or db.table
+func mysqlQuoteObject(object string) string {
+	match := mysqlGrantObject.FindStringSubmatch(object)
+	parts := match[1:]
+	for i, part := range parts {
+		if part != "*" && !strings.HasPrefix(part, "`") {
+			parts[i] = MySQL.quoteIdent(part)
+		}
+	}
+	return parts[0] + "." + parts[1]
+}
+
+func normalizePrivileges(privileges []string) []string {
+	var normalized []string
+	for _, privilege := range privileges {
+		privilege = strings.ToUpper(strings.Join(strings.Fields(privilege), " "))
+		if privilege == "ALL" {
+			privilege = "ALL PRIVILEGES"
+		}
+		normalized = append(normalized, privilege)
+	}
+	return normalized
+}
+
+// missingPrivileges reports whether any of desired isn't in current, where
+// ALL PRIVILEGES covers everything but GRANT OPTION
+func missingPrivileges(desired []string, current []string) bool {
+	for _, privilege := range desired {
+		if slices.Contains(current, privilege) {
+			continue
+		}
+		if privilege != "ALL PRIVILEGES" && privilege != "GRANT OPTION" && slices.Contains(current, "ALL PRIVILEGES") {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+func (a DatabaseUser) postgresStatements(ctx context.Context, ex core.Executor, observer core.ActionObserver) ([]string, error) {
+	rows, known, err := sqlQuery(ctx, ex, PostgreSQL, "SELECT 1 FROM pg_roles WHERE rolname = "+PostgreSQL.quoteString(a.Name), observer)
+	if err != nil {
+		return nil, err
+	}
+	exists := len(rows) > 0
+	role := PostgreSQL.quoteIdent(a.Name)
+
+	if a.State == DatabaseAbsent {
+		if !exists && known {
+			return nil, nil
+		}
+		return []string{"DROP ROLE IF EXISTS " + role}, nil
+	}
+
+	var statements []string
+	password := ""
+	if a.Password != "" {
+		password = " PASSWORD " + PostgreSQL.quoteString(a.Password)
+	}
+	switch {
+	case !exists:
+		statements = append(statements, "CREATE ROLE "+role+" LOGIN"+password)
+	case a.UpdatePassword && a.Password != "":
+		statements = append(statements, "ALTER ROLE "+role+" WITH"+password)
+	}
+
+	for _, grant := range a.Grants {
+		var privileges []string
+		for _, privilege := range grant.Privileges {
+			privileges = append(privileges, postgresPrivileges(privilege)...)
+		}
+
+		granted := false
+		if exists {
+			var checks []string
+			for _, privilege := range privileges {
+				checks = append(checks, fmt.Sprintf("has_database_privilege(%s, %s, %s)", PostgreSQL.quoteString(a.Name), PostgreSQL.quoteString(grant.On), PostgreSQL.quoteString(privilege)))
+			}
+			rows, known, err := sqlQuery(ctx, ex, PostgreSQL, "SELECT "+strings.Join(checks, ", "), observer)
+			if err != nil {
+				return nil, err
+			}
+			granted = known && len(rows) == 1 && !slices.Contains(rows[0], "f")
+		}
+		if !granted {
+			statements = append(statements, fmt.Sprintf("GRANT %s ON DATABASE %s TO %s", strings.Join(privileges, ", "), PostgreSQL.quoteIdent(grant.On), role))
+		}
+	}
+	return statements, nil
+}
+
+// postgresPrivileges expands a PostgreSQL database privilege, returning
+// nothing for privileges that don't apply to databases
+func postgresPrivileges(privilege string) []string {
+	switch normalized := normalizePrivileges([]string{privilege})[0]; normalized {
+	case "ALL PRIVILEGES":
+		return postgresDatabasePrivileges
+	case "TEMP":
+		return []string{"TEMPORARY"}
+	default:
+		if slices.Contains(postgresDatabasePrivileges, normalized) {
+			return []string{normalized}
+		}
+		return nil
+	}
+}
+
+var _ core.Action = (*DatabaseUser)(nil)
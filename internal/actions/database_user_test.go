@@ -0,0 +1,157 @@
+package actions
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+func Test_DatabaseUser_MySQLCreate(t *testing.T) {
+	ex := &core.FakeExecutor{}
+	observer := &resultRecorder{}
+
+	if err := NewMySQLUser("app", "s3cr'et", WithGrant("app.*", "ALL PRIVILEGES")).Handle(t.Context(), ex, core.Ubuntu{}, observer); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "CREATE USER 'app'@'localhost' IDENTIFIED BY 's3cr''et';\nGRANT ALL PRIVILEGES ON `app`.* TO 'app'@'localhost';\n"
+	if script := string(ex.Files["/run/anvil/user-app.sql"]); script != expected {
+		t.Errorf("unexpected script: %q", script)
+	}
+	for _, command := range ex.History {
+		if strings.Contains(command, "s3cr") {
+			t.Errorf("password exposed in command %q", command)
+		}
+	}
+	if len(observer.Results) != 1 || observer.Results[0].ID != "database user app@localhost" || !observer.Results[0].Changed {
+		t.Errorf("unexpected results: %v", observer.Results)
+	}
+}
+
+func Test_DatabaseUser_MySQLUnchanged(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			MySQL.queryCommand("SELECT 1 FROM mysql.user WHERE User = 'app' AND Host = 'localhost'"): {Output: "1\n"},
+			MySQL.queryCommand("SHOW GRANTS FOR 'app'@'localhost'"):                                  {Output: "GRANT USAGE ON *.* TO `app`@`localhost`\nGRANT ALL PRIVILEGES ON `app`.* TO `app`@`localhost`\n"},
+		},
+	}
+	observer := &resultRecorder{}
+
+	if err := NewMySQLUser("app", "secret", WithGrant("app.*", "SELECT", "insert")).Handle(t.Context(), ex, core.Ubuntu{}, observer); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(ex.Files) != 0 {
+		t.Errorf("expected no script, got %v", ex.Files)
+	}
+	if len(observer.Results) != 1 || observer.Results[0].Changed {
+		t.Errorf("expected an unchanged result, got %v", observer.Results)
+	}
+}
+
+func Test_DatabaseUser_MySQLMissingGrant(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			MySQL.queryCommand("SELECT 1 FROM mysql.user WHERE User = 'app' AND Host = '%'"): {Output: "1\n"},
+			MySQL.queryCommand("SHOW GRANTS FOR 'app'@'%'"):                                  {Output: "GRANT USAGE ON *.* TO 'app'@'%'\nGRANT SELECT ON app.* TO 'app'@'%'\n"},
+		},
+	}
+
+	if err := NewMySQLUser("app", "secret", WithUserHost("%"), WithPasswordUpdate(), WithGrant("app.*", "SELECT", "INSERT")).Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "ALTER USER 'app'@'%' IDENTIFIED BY 'secret';\nGRANT SELECT, INSERT ON `app`.* TO 'app'@'%';\n"
+	if script := string(ex.Files["/run/anvil/user-app.sql"]); script != expected {
+		t.Errorf("unexpected script: %q", script)
+	}
+}
+
+func Test_DatabaseUser_PostgresCreate(t *testing.T) {
+	ex := &core.FakeExecutor{}
+
+	if err := NewPostgresUser("app", "secret", WithGrant("app", "ALL")).Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "CREATE ROLE \"app\" LOGIN PASSWORD 'secret';\nGRANT CONNECT, CREATE, TEMPORARY ON DATABASE \"app\" TO \"app\";\n"
+	if script := string(ex.Files["/run/anvil/user-app.sql"]); script != expected {
+		t.Errorf("unexpected script: %q", script)
+	}
+}
+
+func Test_DatabaseUser_PostgresGranted(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			PostgreSQL.queryCommand("SELECT 1 FROM pg_roles WHERE rolname = 'app'"):             {Output: "1\n"},
+			PostgreSQL.queryCommand("SELECT has_database_privilege('app', 'app', 'CONNECT')"):   {Output: "t\n"},
+			PostgreSQL.queryCommand("SELECT has_database_privilege('app', 'app', 'TEMPORARY')"): {Output: "f\n"},
+		},
+	}
+	observer := &resultRecorder{}
+
+	if err := NewPostgresUser("app", "secret", WithGrant("app", "CONNECT")).Handle(t.Context(), ex, core.Ubuntu{}, observer); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(observer.Results) != 1 || observer.Results[0].Changed {
+		t.Errorf("expected an unchanged result, got %v", observer.Results)
+	}
+
+	if err := NewPostgresUser("app", "secret", WithGrant("app", "TEMP")).Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := "GRANT TEMPORARY ON DATABASE \"app\" TO \"app\";\n"
+	if script := string(ex.Files["/run/anvil/user-app.sql"]); script != expected {
+		t.Errorf("unexpected script: %q", script)
+	}
+}
+
+func Test_DatabaseUser_MasksPasswordInErrors(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			"mysql < /run/anvil/user-app.sql; status=$?; rm -f /run/anvil/user-app.sql; exit $status": {
+				Output: "ERROR 1064 (42000) at line 1: You have an error in your SQL syntax near 'IDENTIFIED BY 'hun''ter2''\n",
+				Err:    errors.New("exit status 1"),
+			},
+		},
+	}
+
+	err := NewMySQLUser("app", "hun'ter2").Handle(t.Context(), ex, core.Ubuntu{}, nil)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if strings.Contains(err.Error(), "ter2") {
+		t.Errorf("password exposed in error: %v", err)
+	}
+}
+
+func Test_DatabaseUser_EmptyPassword(t *testing.T) {
+	ex := &core.FakeExecutor{}
+	if err := NewMySQLUser("app", "").Handle(t.Context(), ex, core.Ubuntu{}, nil); err == nil {
+		t.Fatal("expected an error for a user without a password")
+	}
+	if len(ex.History) != 0 {
+		t.Errorf("should not touch the server: %v", ex.History)
+	}
+
+	if err := NewPostgresUser("app", "", WithoutPassword()).Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := NewMySQLUser("app", "", WithDatabaseUserAbsent()).Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error dropping a user: %v", err)
+	}
+}
+
+func Test_DatabaseUser_InvalidPrivilege(t *testing.T) {
+	err := NewMySQLUser("app", "secret", WithGrant("app.*", "ALL; DROP DATABASE app")).Handle(t.Context(), &core.FakeExecutor{}, core.Ubuntu{}, nil)
+	if err == nil {
+		t.Fatal("expected an error for an invalid privilege")
+	}
+
+	err = NewPostgresUser("app", "secret", WithGrant("app", "SELECT")).Handle(t.Context(), &core.FakeExecutor{}, core.Ubuntu{}, nil)
+	if err == nil {
+		t.Fatal("expected an error for a privilege databases don't have")
+	}
+}
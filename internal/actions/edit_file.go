@@ -0,0 +1,308 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+// EditState is whether edited content should be present in or absent from a
+// file
+type EditState int
+
+const (
+	ContentPresent EditState = iota
+	ContentAbsent
+)
+
+// FileEditOpts configures LineInFile and BlockInFile. Options that only apply
+// to one of them are ignored by the other.
+type FileEditOpts struct {
+	Path string
+	// Regexp selects the lines LineInFile replaces or removes. Without it,
+	// lines equal to Line are used.
+	Regexp string
+	// Marker is the comment around a managed block, with {mark} standing for
+	// BEGIN and END
+	Marker string
+	State  EditState
+	// Backup copies the file aside before it is changed
+	Backup bool
+	// Validate checks the edited file before it replaces the original, with
+	// %s standing for its path, e.g. sshd -t -f %s
+	Validate string
+	// Create creates the file with Mode if it doesn't exist
+	Create bool
+	Mode   fs.FileMode
+}
+
+type FileEditOptsFunc func(*FileEditOpts)
+
+func WithRegexp(pattern string) FileEditOptsFunc {
+	return func(o *FileEditOpts) {
+		o.Regexp = pattern
+	}
+}
+
+func WithMarker(marker string) FileEditOptsFunc {
+	return func(o *FileEditOpts) {
+		o.Marker = marker
+	}
+}
+
+func WithContentAbsent() FileEditOptsFunc {
+	return func(o *FileEditOpts) {
+		o.State = ContentAbsent
+	}
+}
+
+func WithBackup() FileEditOptsFunc {
+	return func(o *FileEditOpts) {
+		o.Backup = true
+	}
+}
+
+func WithValidate(command string) FileEditOptsFunc {
+	return func(o *FileEditOpts) {
+		o.Validate = command
+	}
+}
+
+func WithCreateFile(mode fs.FileMode) FileEditOptsFunc {
+	return func(o *FileEditOpts) {
+		o.Create = true
+		o.Mode = mode
+	}
+}
+
+func DefaultFileEditOpts() FileEditOpts {
+	return FileEditOpts{
+		Marker: "# {mark} ANVIL MANAGED BLOCK",
+		State:  ContentPresent,
+		Mode:   0o644,
+	}
+}
+
+// LineInFile ensures a single line is present in, or absent from, a file.
+// When present, the first line matching Regexp is replaced and any later
+// matches are removed, so the setting appears exactly once; without a match
+// the line is appended.
+type LineInFile struct {
+	FileEditOpts
+	Line string
+}
+
+func NewLineInFile(filePath string, line string, opts ...FileEditOptsFunc) *LineInFile {
+	o := DefaultFileEditOpts()
+	o.Path = filePath
+	for _, fn := range opts {
+		fn(&o)
+	}
+	return &LineInFile{
+		FileEditOpts: o,
+		Line:         line,
+	}
+}
+
+func (a LineInFile) Handle(ctx context.Context, ex core.Executor, os core.OS, observer core.ActionObserver) error {
+	return core.WithObserver(observer, func() error {
+		matches := func(line string) bool { return line == a.Line }
+		if a.Regexp != "" {
+			re, err := regexp.Compile(a.Regexp)
+			if err != nil {
+				return fmt.Errorf("invalid regexp for %s: %w", a.Path, err)
+			}
+			matches = re.MatchString
+		}
+
+		changed, err := editFile(ctx, ex, a.FileEditOpts, func(current string) string {
+			var lines []string
+			replaced := false
+			for _, line := range splitLines(current) {
+				switch {
+				case !matches(line):
+					lines = append(lines, line)
+				case a.State == ContentPresent && !replaced:
+					lines = append(lines, a.Line)
+					replaced = true
+				}
+			}
+			if a.State == ContentPresent && !replaced {
+				lines = append(lines, a.Line)
+			}
+			return joinLines(lines)
+		}, observer)
+		if err != nil {
+			return err
+		}
+
+		return core.ReportResult(observer, core.ActionResult{ID: "line in " + a.Path, Changed: changed})
+	})
+}
+
+// BlockInFile ensures a block of lines between marker comments is present
+// in, or absent from, a file
+type BlockInFile struct {
+	FileEditOpts
+	Block string
+}
+
+func NewBlockInFile(filePath string, block string, opts ...FileEditOptsFunc) *BlockInFile {
+	o := DefaultFileEditOpts()
+	o.Path = filePath
+	for _, fn := range opts {
+		fn(&o)
+	}
+	return &BlockInFile{
+		FileEditOpts: o,
+		Block:        block,
+	}
+}
+
+func (a BlockInFile) Handle(ctx context.Context, ex core.Executor, os core.OS, observer core.ActionObserver) error {
+	return core.WithObserver(observer, func() error {
+		if !strings.Contains(a.Marker, "{mark}") {
+			return fmt.Errorf("invalid marker %q for %s: must contain {mark}", a.Marker, a.Path)
+		}
+		begin := strings.ReplaceAll(a.Marker, "{mark}", "BEGIN")
+		end := strings.ReplaceAll(a.Marker, "{mark}", "END")
+
+		// A marker without its pair means the file was edited by hand, and
+		// where the block ends can only be guessed
+		var unbalanced error
+		changed, err := editFile(ctx, ex, a.FileEditOpts, func(current string) string {
+			var block []string
+			if a.State == ContentPresent {
+				block = append(append([]string{begin}, splitLines(a.Block)...), end)
+			}
+
+			lines := splitLines(current)
+			start, stop := -1, -1
+			for i, line := range lines {
+				switch {
+				case line == begin && (start >= 0 || stop >= 0):
+					unbalanced = fmt.Errorf("%s has a second %q marker", a.Path, begin)
+				case line == begin:
+					start = i
+				case line == end && (start < 0 || stop >= 0):
+					unbalanced = fmt.Errorf("%s has %q without %q before it", a.Path, end, begin)
+				case line == end:
+					stop = i
+				}
+			}
+			if start >= 0 && stop < 0 {
+				unbalanced = fmt.Errorf("%s has %q without %q after it", a.Path, begin, end)
+			}
+			if unbalanced != nil {
+				return current
+			}
+
+			if start < 0 {
+				return joinLines(append(lines, block...))
+			}
+			result := append(append(append([]string(nil), lines[:start]...), block...), lines[stop+1:]...)
+			return joinLines(result)
+		}, observer)
+		if err != nil {
+			return err
+		}
+		if unbalanced != nil {
+			return unbalanced
+		}
+
+		return core.ReportResult(observer, core.ActionResult{ID: "block in " + a.Path, Changed: changed})
+	})
+}
+
+func joinLines(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// editFile applies edit to the file's content and, if that changed it,
+// replaces the file. The new content is staged next to the file so it can be
+// validated first and then moved into place keeping the original's mode and
+// ownership. Dry runs show a diff of the change.
+func editFile(ctx context.Context, ex core.Executor, opts FileEditOpts, edit func(current string) string, observer core.ActionObserver) (bool, error) {
+	current, exists, err := readFile(ctx, ex, opts.Path, observer)
+	if err != nil {
+		return false, err
+	}
+	if !exists && opts.State == ContentAbsent {
+		return false, nil
+	}
+	if !exists && !opts.Create {
+		return false, fmt.Errorf("%s does not exist", opts.Path)
+	}
+
+	content := edit(string(current))
+	if exists && content == string(current) {
+		return false, nil
+	}
+
+	if core.IsDryRun(ex) && observer != nil {
+		if err := observer.OnExecutionOutput(unifiedDiff(opts.Path, string(current), content)); err != nil {
+			// Log error but continue
+		}
+	}
+
+	// Moving the edited copy over a symbolic link, such as /etc/resolv.conf
+	// on hosts running systemd-resolved, would replace the link with a
+	// regular file, so the file it points to is edited instead
+	target := opts.Path
+	if exists {
+		output, err := ex.Execute(ctx, "readlink -f "+core.ShellQuote(opts.Path), observer)
+		if err != nil {
+			return false, err
+		}
+		if resolved := strings.TrimSpace(output); path.IsAbs(resolved) && !core.IsDryRun(ex) {
+			target = resolved
+		}
+	}
+
+	quotedPath := core.ShellQuote(target)
+	if opts.Backup && exists {
+		backup := core.ShellQuote(fmt.Sprintf("%s.%s.bak", opts.Path, time.Now().Format("20060102T150405")))
+		if _, err := ex.Execute(ctx, fmt.Sprintf("cp -p %s %s", quotedPath, backup), observer); err != nil {
+			return false, err
+		}
+	}
+
+	// The staged copy is private until it has the mode of the file it
+	// replaces, which may hold secrets
+	staging := path.Join(path.Dir(target), "."+path.Base(target)+".anvil")
+	quotedStaging := core.ShellQuote(staging)
+	if err := core.Upload(ctx, ex, []byte(content), staging, 0o600, observer); err != nil {
+		return false, err
+	}
+
+	if opts.Validate != "" {
+		output, err := ex.Execute(ctx, strings.ReplaceAll(opts.Validate, "%s", quotedStaging), observer)
+		if err != nil {
+			if _, cleanupErr := ex.Execute(ctx, fmt.Sprintf("rm -f %s", quotedStaging), observer); cleanupErr != nil {
+				// Log error but report the validation failure
+			}
+			return false, fmt.Errorf("%s failed validation, not changed: %w: %s", opts.Path, err, strings.TrimSpace(output))
+		}
+	}
+
+	command := fmt.Sprintf("chmod %o %s && mv -f %s %s", opts.Mode.Perm(), quotedStaging, quotedStaging, quotedPath)
+	if exists {
+		command = fmt.Sprintf("chmod --reference=%s %s && chown --reference=%s %s && mv -f %s %s", quotedPath, quotedStaging, quotedPath, quotedStaging, quotedStaging, quotedPath)
+	}
+	if _, err := ex.Execute(ctx, command, observer); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+var _ core.Action = (*LineInFile)(nil)
+var _ core.Action = (*BlockInFile)(nil)
@@ -0,0 +1,221 @@
+package actions
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+const sshdConfig = "Port 22\n#PermitRootLogin prohibit-password\nPasswordAuthentication yes\nPermitRootLogin yes\n"
+
+func Test_LineInFile_ReplacesMatch(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Files: map[string][]byte{"/etc/ssh/sshd_config": []byte(sshdConfig)},
+	}
+	action := NewLineInFile("/etc/ssh/sshd_config", "PermitRootLogin no",
+		WithRegexp(`^#?PermitRootLogin\s`),
+		WithValidate("sshd -t -f %s"),
+		WithBackup(),
+	)
+
+	if err := action.Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "Port 22\nPermitRootLogin no\nPasswordAuthentication yes\n"
+	if content := string(ex.Files["/etc/ssh/.sshd_config.anvil"]); content != expected {
+		t.Errorf("unexpected content:\n%s", content)
+	}
+
+	if !ex.Executed("sshd -t -f /etc/ssh/.sshd_config.anvil") {
+		t.Error("did not validate the edited file")
+	}
+
+	if !ex.Executed("chmod --reference=/etc/ssh/sshd_config /etc/ssh/.sshd_config.anvil && chown --reference=/etc/ssh/sshd_config /etc/ssh/.sshd_config.anvil && mv -f /etc/ssh/.sshd_config.anvil /etc/ssh/sshd_config") {
+		t.Errorf("did not move the edited file into place: %v", ex.History)
+	}
+
+	backedUp := false
+	for _, command := range ex.History {
+		if strings.HasPrefix(command, "cp -p /etc/ssh/sshd_config /etc/ssh/sshd_config.") {
+			backedUp = true
+		}
+	}
+	if !backedUp {
+		t.Errorf("did not back up the file: %v", ex.History)
+	}
+}
+
+func Test_LineInFile_Unchanged(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Files: map[string][]byte{"/etc/sysctl.conf": []byte("vm.swappiness = 10\n")},
+	}
+	observer := &resultRecorder{}
+	action := NewLineInFile("/etc/sysctl.conf", "vm.swappiness = 10", WithRegexp(`^vm\.swappiness\s*=`))
+
+	if err := action.Handle(t.Context(), ex, core.Ubuntu{}, observer); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(ex.History) != 0 || ex.Uploaded("/etc/.sysctl.conf.anvil") {
+		t.Errorf("should only read an unchanged file: %v", ex.History)
+	}
+
+	if len(observer.Results) != 1 || observer.Results[0].Changed {
+		t.Errorf("expected a single unchanged result, got %v", observer.Results)
+	}
+}
+
+func Test_LineInFile_AppendsAndRemoves(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Files: map[string][]byte{"/etc/hosts": []byte("127.0.0.1 localhost\n")},
+	}
+
+	if err := NewLineInFile("/etc/hosts", "10.0.0.5 db").Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if content := string(ex.Files["/etc/.hosts.anvil"]); content != "127.0.0.1 localhost\n10.0.0.5 db\n" {
+		t.Errorf("unexpected content after append:\n%s", content)
+	}
+
+	ex.Files["/etc/hosts"] = ex.Files["/etc/.hosts.anvil"]
+	if err := NewLineInFile("/etc/hosts", "", WithRegexp(`\sdb$`), WithContentAbsent()).Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if content := string(ex.Files["/etc/.hosts.anvil"]); content != "127.0.0.1 localhost\n" {
+		t.Errorf("unexpected content after removal:\n%s", content)
+	}
+}
+
+func Test_LineInFile_InvalidNotApplied(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Files: map[string][]byte{"/etc/ssh/sshd_config": []byte(sshdConfig)},
+		Responses: map[string]core.FakeResponse{
+			"sshd -t -f /etc/ssh/.sshd_config.anvil": {Output: "Bad configuration option", Err: errors.New("exit status 255")},
+		},
+	}
+	action := NewLineInFile("/etc/ssh/sshd_config", "PermitRootLogin maybe", WithRegexp(`^PermitRootLogin`), WithValidate("sshd -t -f %s"))
+
+	if err := action.Handle(t.Context(), ex, core.Ubuntu{}, nil); err == nil {
+		t.Fatal("expected error for a file that fails validation")
+	}
+
+	for _, command := range ex.History {
+		if strings.Contains(command, "mv -f") {
+			t.Fatalf("should not apply a file that fails validation: %v", ex.History)
+		}
+	}
+
+	if !ex.Executed("rm -f /etc/ssh/.sshd_config.anvil") {
+		t.Error("did not clean up the rejected file")
+	}
+}
+
+func Test_LineInFile_Symlink(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			"readlink -f /etc/resolv.conf": {Output: "/run/systemd/resolve/resolv.conf\n"},
+		},
+		Files: map[string][]byte{"/etc/resolv.conf": []byte("nameserver 127.0.0.53\n")},
+	}
+
+	if err := NewLineInFile("/etc/resolv.conf", "options edns0").Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !ex.Uploaded("/run/systemd/resolve/.resolv.conf.anvil") {
+		t.Fatalf("should stage next to the file the link points to: %v", ex.History)
+	}
+	if !ex.Executed("chmod --reference=/run/systemd/resolve/resolv.conf /run/systemd/resolve/.resolv.conf.anvil && chown --reference=/run/systemd/resolve/resolv.conf /run/systemd/resolve/.resolv.conf.anvil && mv -f /run/systemd/resolve/.resolv.conf.anvil /run/systemd/resolve/resolv.conf") {
+		t.Errorf("should replace the file the link points to, not the link: %v", ex.History)
+	}
+}
+
+func Test_LineInFile_MissingFile(t *testing.T) {
+	ex := &core.FakeExecutor{}
+
+	if err := NewLineInFile("/etc/app.conf", "debug = false").Handle(t.Context(), ex, core.Ubuntu{}, nil); err == nil {
+		t.Error("expected error for a missing file without WithCreateFile")
+	}
+
+	if err := NewLineInFile("/etc/app.conf", "debug = false", WithCreateFile(0o600)).Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !ex.Executed("chmod 600 /etc/.app.conf.anvil && mv -f /etc/.app.conf.anvil /etc/app.conf") {
+		t.Errorf("did not create the file: %v", ex.History)
+	}
+}
+
+func Test_BlockInFile(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Files: map[string][]byte{"/etc/hosts": []byte("127.0.0.1 localhost\n# BEGIN ANVIL MANAGED BLOCK\n10.0.0.4 old\n# END ANVIL MANAGED BLOCK\n::1 localhost\n")},
+	}
+	action := NewBlockInFile("/etc/hosts", "10.0.0.5 db\n10.0.0.6 cache\n")
+
+	if err := action.Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "127.0.0.1 localhost\n# BEGIN ANVIL MANAGED BLOCK\n10.0.0.5 db\n10.0.0.6 cache\n# END ANVIL MANAGED BLOCK\n::1 localhost\n"
+	if content := string(ex.Files["/etc/.hosts.anvil"]); content != expected {
+		t.Errorf("unexpected content:\n%s", content)
+	}
+
+	ex.Files["/etc/hosts"] = ex.Files["/etc/.hosts.anvil"]
+	if err := NewBlockInFile("/etc/hosts", "", WithContentAbsent()).Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if content := string(ex.Files["/etc/.hosts.anvil"]); content != "127.0.0.1 localhost\n::1 localhost\n" {
+		t.Errorf("unexpected content after removal:\n%s", content)
+	}
+}
+
+func Test_BlockInFile_UnbalancedMarkers(t *testing.T) {
+	for _, content := range []string{
+		"127.0.0.1 localhost\n# BEGIN ANVIL MANAGED BLOCK\n10.0.0.4 old\n",
+		"10.0.0.4 old\n# END ANVIL MANAGED BLOCK\n127.0.0.1 localhost\n",
+	} {
+		ex := &core.FakeExecutor{
+			Files: map[string][]byte{"/etc/hosts": []byte(content)},
+		}
+
+		if err := NewBlockInFile("/etc/hosts", "10.0.0.5 db\n").Handle(t.Context(), ex, core.Ubuntu{}, nil); err == nil {
+			t.Errorf("expected error for unbalanced markers in %q", content)
+		}
+		if _, ok := ex.Files["/etc/.hosts.anvil"]; ok {
+			t.Error("should not write a file with unbalanced markers")
+		}
+	}
+}
+
+func Test_LineInFile_DryRunDiff(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "sysctl.conf")
+	if err := os.WriteFile(file, []byte("kernel.panic = 10\nvm.swappiness = 60\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ex := &core.DryRunExecutor{}
+	observer := &resultRecorder{}
+
+	if err := NewLineInFile(file, "vm.swappiness = 10", WithRegexp(`^vm\.swappiness`)).Handle(t.Context(), ex, core.Ubuntu{}, observer); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "--- " + file + "\n+++ " + file + "\n@@ -1,2 +1,2 @@\n kernel.panic = 10\n-vm.swappiness = 60\n+vm.swappiness = 10\n"
+	found := false
+	for _, output := range observer.Outputs {
+		if output == expected {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("did not show diff, got %q", observer.Outputs)
+	}
+
+	if content, _ := os.ReadFile(file); string(content) != "kernel.panic = 10\nvm.swappiness = 60\n" {
+		t.Error("dry run should not change the file")
+	}
+}
@@ -0,0 +1,87 @@
+package actions
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+// readFile downloads the file at path from the target, reporting false if it
+// doesn't exist
+func readFile(ctx context.Context, ex core.Executor, filePath string, observer core.ActionObserver) ([]byte, bool, error) {
+	content, err := core.Download(ctx, ex, filePath, observer)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return content, true, nil
+}
+
+// ensureFile uploads content to path on the target unless the file already
+// holds exactly that content, reporting whether it changed
+func ensureFile(ctx context.Context, ex core.Executor, filePath string, content []byte, mode fs.FileMode, observer core.ActionObserver) (bool, error) {
+	current, exists, err := readFile(ctx, ex, filePath, observer)
+	if err != nil {
+		return false, err
+	}
+	if exists && bytes.Equal(current, content) {
+		return false, nil
+	}
+
+	if !exists {
+		_, err := ex.Execute(ctx, fmt.Sprintf("mkdir -p %s", core.ShellQuote(path.Dir(filePath))), observer)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if err := core.Upload(ctx, ex, content, filePath, mode, observer); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// removeFile removes path from the target if it exists, reporting whether it
+// changed
+func removeFile(ctx context.Context, ex core.Executor, filePath string, observer core.ActionObserver) (bool, error) {
+	_, exists, err := readFile(ctx, ex, filePath, observer)
+	if err != nil || !exists {
+		return false, err
+	}
+
+	_, err = ex.Execute(ctx, fmt.Sprintf("rm -f %s", core.ShellQuote(filePath)), observer)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// stagingTemplate is the mktemp template of staging directories
+const stagingTemplate = "/tmp/anvil.XXXXXXXXXX"
+
+// stagingDir creates a directory on the target that only its owner can
+// access, for files that are verified or installed after they are staged.
+// Unlike a fixed path in /tmp, other users can't create or swap files in it.
+// The caller removes it with rm -rf.
+func stagingDir(ctx context.Context, ex core.Executor, observer core.ActionObserver) (string, error) {
+	output, err := ex.Execute(ctx, "mktemp -d "+stagingTemplate, observer)
+	if err != nil {
+		return "", fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	if core.IsDryRun(ex) {
+		return stagingTemplate, nil
+	}
+	dir := strings.TrimSpace(output)
+	if !strings.HasPrefix(dir, "/tmp/anvil.") || strings.ContainsAny(dir, " \n") {
+		return "", fmt.Errorf("unexpected staging directory %q", dir)
+	}
+	return dir, nil
+}
@@ -0,0 +1,307 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+type FirewallOpts struct {
+	Rules []core.FirewallRule
+	// AbsentRules are removed if they exist
+	AbsentRules []core.FirewallRule
+	// Zone is used for rules without a zone of their own
+	Zone string
+	// Backend overrides the OS family's firewall
+	Backend core.Firewall
+	// Enable turns the firewall on once the rules are in place
+	Enable bool
+	// SafeApply keeps the SSH port open: rules that would close it are
+	// refused, an allow rule is added for it, and the firewall isn't enabled
+	// if the port can't be found
+	SafeApply bool
+}
+
+type FirewallOptsFunc func(*FirewallOpts)
+
+func WithAllowPort(port int, protocol string) FirewallOptsFunc {
+	return WithFirewallRule(core.FirewallRule{Policy: core.FirewallAllow, Port: port, Protocol: protocol})
+}
+
+func WithAllowPortFrom(port int, protocol string, source string) FirewallOptsFunc {
+	return WithFirewallRule(core.FirewallRule{Policy: core.FirewallAllow, Port: port, Protocol: protocol, Source: source})
+}
+
+func WithDenyPort(port int, protocol string) FirewallOptsFunc {
+	return WithFirewallRule(core.FirewallRule{Policy: core.FirewallDeny, Port: port, Protocol: protocol})
+}
+
+func WithFirewallRule(rule core.FirewallRule) FirewallOptsFunc {
+	return func(o *FirewallOpts) {
+		o.Rules = append(o.Rules, rule)
+	}
+}
+
+func WithFirewallRuleAbsent(rule core.FirewallRule) FirewallOptsFunc {
+	return func(o *FirewallOpts) {
+		o.AbsentRules = append(o.AbsentRules, rule)
+	}
+}
+
+func WithFirewallZone(zone string) FirewallOptsFunc {
+	return func(o *FirewallOpts) {
+		o.Zone = zone
+	}
+}
+
+func WithFirewallBackend(backend core.Firewall) FirewallOptsFunc {
+	return func(o *FirewallOpts) {
+		o.Backend = backend
+	}
+}
+
+// WithoutFirewallEnable manages the rules without turning the firewall on
+func WithoutFirewallEnable() FirewallOptsFunc {
+	return func(o *FirewallOpts) {
+		o.Enable = false
+	}
+}
+
+// WithUnsafeApply applies the rules even if they close the SSH port, and
+// enables the firewall without knowing that port
+func WithUnsafeApply() FirewallOptsFunc {
+	return func(o *FirewallOpts) {
+		o.SafeApply = false
+	}
+}
+
+// Firewall ensures rules are present in, or absent from, the host firewall:
+// ufw on Debian-family hosts and firewalld on Fedora-family hosts, falling
+// back to nftables where those aren't installed. Only the rules that differ
+// from the current rule set are changed.
+type Firewall struct {
+	FirewallOpts
+}
+
+func DefaultFirewallOpts() FirewallOpts {
+	return FirewallOpts{
+		Enable:    true,
+		SafeApply: true,
+	}
+}
+
+func NewFirewall(opts ...FirewallOptsFunc) *Firewall {
+	o := DefaultFirewallOpts()
+	for _, fn := range opts {
+		fn(&o)
+	}
+	return &Firewall{
+		FirewallOpts: o,
+	}
+}
+
+func (a Firewall) Handle(ctx context.Context, ex core.Executor, os core.OS, observer core.ActionObserver) error {
+	return core.WithObserver(observer, func() error {
+		rules, err := a.normalize(a.Rules)
+		if err != nil {
+			return err
+		}
+		absent, err := a.normalize(a.AbsentRules)
+		if err != nil {
+			return err
+		}
+
+		var sshPorts []int
+		if a.SafeApply {
+			sshPorts = a.sshPorts(ctx, ex, observer)
+			if rules, err = a.keepSSHOpen(rules, absent, sshPorts); err != nil {
+				return err
+			}
+		}
+
+		backend, err := a.backend(ctx, ex, os, observer)
+		if err != nil {
+			return err
+		}
+
+		var commands []string
+		for _, zone := range firewallZones(append(slices.Clone(rules), absent...), a.Zone) {
+			output, err := ex.Execute(ctx, backend.ListRules(zone), observer)
+			if err != nil {
+				return fmt.Errorf("failed to list %s rules: %w: %s", backend.Name(), err, strings.TrimSpace(output))
+			}
+			current := backend.ParseRules(output, zone)
+
+			for _, rule := range rules {
+				if rule.Zone == zone && !slices.Contains(current, rule) {
+					commands = append(commands, backend.AddRule(rule))
+				}
+			}
+			for _, rule := range absent {
+				if rule.Zone == zone && slices.Contains(current, rule) {
+					commands = append(commands, backend.RemoveRule(rule))
+				}
+			}
+		}
+		if a.Enable {
+			if _, err := ex.Execute(ctx, backend.Active(), observer); err != nil {
+				if a.SafeApply && len(sshPorts) == 0 {
+					return fmt.Errorf("refusing to enable %s: the port SSH listens on is unknown, allow it with a rule or use WithUnsafeApply", backend.Name())
+				}
+				commands = append(commands, backend.Enable())
+			}
+		}
+		// Saving goes last so the saved rule set includes enabling it
+		if len(commands) > 0 && backend.Apply() != "" {
+			commands = append(commands, backend.Apply())
+		}
+
+		for _, command := range commands {
+			if _, err := ex.Execute(ctx, command, observer); err != nil {
+				return err
+			}
+		}
+
+		return core.ReportResult(observer, core.ActionResult{ID: "firewall " + backend.Name(), Changed: len(commands) > 0})
+	})
+}
+
+// normalize validates the rules and fills in the default protocol and zone
+func (a Firewall) normalize(rules []core.FirewallRule) ([]core.FirewallRule, error) {
+	normalized := make([]core.FirewallRule, 0, len(rules))
+	for _, rule := range rules {
+		if rule.Protocol == "" {
+			rule.Protocol = "tcp"
+		}
+		if rule.Zone == "" {
+			rule.Zone = a.Zone
+		}
+		if rule.Port < 1 || rule.Port > 65535 {
+			return nil, fmt.Errorf("invalid firewall rule %q: port must be 1-65535", rule)
+		}
+		if rule.Protocol != "tcp" && rule.Protocol != "udp" {
+			return nil, fmt.Errorf("invalid firewall rule %q: protocol must be tcp or udp", rule)
+		}
+		if rule.Source != "" && net.ParseIP(rule.Source) == nil {
+			if _, _, err := net.ParseCIDR(rule.Source); err != nil {
+				return nil, fmt.Errorf("invalid firewall rule %q: source must be an address or CIDR", rule)
+			}
+		}
+		normalized = append(normalized, rule)
+	}
+	return normalized, nil
+}
+
+// keepSSHOpen refuses rules that would close the SSH ports and adds rules
+// allowing them to every zone the rules touch
+func (a Firewall) keepSSHOpen(rules []core.FirewallRule, absent []core.FirewallRule, ports []int) ([]core.FirewallRule, error) {
+	var guards []core.FirewallRule
+	for _, port := range ports {
+		for _, rule := range rules {
+			if rule.Policy == core.FirewallDeny && rule.Port == port && rule.Protocol == "tcp" {
+				return nil, fmt.Errorf("refusing firewall rule %q: it would close SSH port %d", rule, port)
+			}
+		}
+		for _, rule := range absent {
+			if rule.Policy == core.FirewallAllow && rule.Port == port && rule.Protocol == "tcp" && rule.Source == "" {
+				return nil, fmt.Errorf("refusing to remove firewall rule %q: it would close SSH port %d", rule, port)
+			}
+		}
+
+		for _, zone := range firewallZones(append(slices.Clone(rules), absent...), a.Zone) {
+			guard := core.FirewallRule{Policy: core.FirewallAllow, Port: port, Protocol: "tcp", Zone: zone}
+			if !slices.Contains(rules, guard) {
+				guards = append(guards, guard)
+			}
+		}
+	}
+	// The SSH rules go first so they are in place before anything else changes
+	return append(guards, rules...), nil
+}
+
+// sshPortProbes find the SSH port, in order: the connection commands run
+// through, then the ports sshd is configured with, then the ports it listens
+// on. SSH_CONNECTION is empty under sudo and for local commands.
+var sshPortProbes = []string{
+	`echo "$SSH_CONNECTION" | awk '{print $4}'`,
+	`sshd -T 2>/dev/null | awk '$1 == "port" {print $2}'`,
+	`ss -Htlnp 2>/dev/null | awk '/"sshd"/ {n = split($4, a, ":"); print a[n]}'`,
+}
+
+// sshPorts returns the ports SSH is reached through on the target, or none if
+// they can't be found. Dry runs assume the default port.
+func (a Firewall) sshPorts(ctx context.Context, ex core.Executor, observer core.ActionObserver) []int {
+	if core.IsDryRun(ex) {
+		return []int{22}
+	}
+	for _, probe := range sshPortProbes {
+		output, err := ex.Execute(ctx, probe, observer)
+		if err != nil {
+			continue
+		}
+		if ports := parsePorts(output); len(ports) > 0 {
+			return ports
+		}
+	}
+	return nil
+}
+
+// parsePorts returns the distinct ports printed one per line, ignoring the
+// [host] prefix of parallel executors
+func parsePorts(output string) []int {
+	var ports []int
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		port, err := strconv.Atoi(fields[len(fields)-1])
+		if err != nil || port < 1 || port > 65535 {
+			continue
+		}
+		if !slices.Contains(ports, port) {
+			ports = append(ports, port)
+		}
+	}
+	return ports
+}
+
+// backend returns the firewall to manage, falling back to nftables if the OS
+// family's firewall isn't installed
+func (a Firewall) backend(ctx context.Context, ex core.Executor, os core.OS, observer core.ActionObserver) (core.Firewall, error) {
+	if a.Backend != nil {
+		return a.Backend, nil
+	}
+
+	backend := os.Firewall()
+	if _, err := ex.Execute(ctx, backend.Installed(), observer); err == nil {
+		return backend, nil
+	}
+	fallback := core.NftablesFirewall{}
+	if _, err := ex.Execute(ctx, fallback.Installed(), observer); err == nil {
+		return fallback, nil
+	}
+	return nil, fmt.Errorf("neither %s nor %s is installed", backend.Name(), fallback.Name())
+}
+
+// firewallZones returns the zones of the rules in order, or the default zone
+// if there are no rules
+func firewallZones(rules []core.FirewallRule, defaultZone string) []string {
+	var zones []string
+	for _, rule := range rules {
+		if !slices.Contains(zones, rule.Zone) {
+			zones = append(zones, rule.Zone)
+		}
+	}
+	if len(zones) == 0 {
+		zones = append(zones, defaultZone)
+	}
+	return zones
+}
+
+var _ core.Action = (*Firewall)(nil)
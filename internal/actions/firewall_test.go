@@ -0,0 +1,184 @@
+package actions
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+func Test_Firewall_Ufw(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			sshPortProbes[0]:                         {Output: "2222\n"},
+			"ufw show added":                         {Output: "Added user rules (see 'ufw status' for running firewall):\nufw allow 80/tcp\nufw deny from 192.0.2.0/24 to any port 3306 proto tcp\n"},
+			"ufw status | grep -q '^Status: active'": {Err: errors.New("exit status 1")},
+		},
+	}
+	action := NewFirewall(
+		WithAllowPort(80, "tcp"),
+		WithAllowPort(443, ""),
+		WithFirewallRuleAbsent(core.FirewallRule{Policy: core.FirewallDeny, Port: 3306, Source: "192.0.2.0/24"}),
+	)
+
+	if err := action.Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{
+		"ufw allow proto tcp from any to any port 2222",
+		"ufw allow proto tcp from any to any port 443",
+		"ufw delete deny proto tcp from 192.0.2.0/24 to any port 3306",
+		"ufw --force enable",
+	}
+	changes := ex.History[len(ex.History)-len(expected):]
+	for i, command := range expected {
+		if changes[i] != command {
+			t.Errorf("command %d: expected %q, got %q", i, command, changes[i])
+		}
+	}
+	if ex.Executed("ufw allow proto tcp from any to any port 80") {
+		t.Error("should not add a rule that exists")
+	}
+}
+
+func Test_Firewall_RefusesClosingSSH(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			sshPortProbes[0]: {Output: "22\n"},
+		},
+	}
+
+	if err := NewFirewall(WithDenyPort(22, "tcp")).Handle(t.Context(), ex, core.Ubuntu{}, nil); err == nil {
+		t.Error("expected error for a rule denying the SSH port")
+	}
+
+	ex.History = nil
+	if err := NewFirewall(WithDenyPort(22, "tcp"), WithUnsafeApply()).Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !ex.Executed("ufw deny proto tcp from any to any port 22") {
+		t.Errorf("expected the rule to be applied without safe apply: %v", ex.History)
+	}
+}
+
+func Test_Firewall_SSHPortWithoutConnection(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			sshPortProbes[0]: {Output: "\n"},
+			sshPortProbes[1]: {Output: "22\n2222\n"},
+		},
+	}
+
+	if err := NewFirewall(WithAllowPort(80, "tcp")).Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, port := range []string{"22", "2222"} {
+		if !ex.Executed("ufw allow proto tcp from any to any port " + port) {
+			t.Errorf("did not keep SSH port %s open: %v", port, ex.History)
+		}
+	}
+}
+
+func Test_Firewall_UnknownSSHPort(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			"ufw status | grep -q '^Status: active'": {Err: errors.New("exit status 1")},
+		},
+	}
+
+	if err := NewFirewall(WithAllowPort(80, "tcp")).Handle(t.Context(), ex, core.Ubuntu{}, nil); err == nil {
+		t.Fatal("expected error enabling the firewall without knowing the SSH port")
+	}
+	if ex.Executed("ufw --force enable") {
+		t.Error("should not enable the firewall without knowing the SSH port")
+	}
+
+	if err := NewFirewall(WithAllowPort(80, "tcp"), WithUnsafeApply()).Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !ex.Executed("ufw --force enable") {
+		t.Errorf("expected the firewall to be enabled without safe apply: %v", ex.History)
+	}
+}
+
+func Test_Firewall_FirewalldUnchanged(t *testing.T) {
+	list := core.FirewalldFirewall{}.ListRules("internal")
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			list: {Output: "80/tcp 443/tcp\nrule family=\"ipv4\" source address=\"10.0.0.0/8\" port port=\"5432\" protocol=\"tcp\" accept\n"},
+		},
+	}
+	observer := &resultRecorder{}
+	action := NewFirewall(
+		WithFirewallZone("internal"),
+		WithAllowPort(443, "tcp"),
+		WithAllowPortFrom(5432, "tcp", "10.0.0.0/8"),
+	)
+
+	if err := action.Handle(t.Context(), ex, core.Fedora{}, observer); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(observer.Results) != 1 || observer.Results[0].Changed {
+		t.Errorf("expected a single unchanged result, got %v", observer.Results)
+	}
+}
+
+func Test_Firewall_FallsBackToNftables(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			"command -v ufw": {Err: errors.New("exit status 1")},
+		},
+	}
+	observer := &resultRecorder{}
+
+	if err := NewFirewall(WithAllowPort(80, "tcp")).Handle(t.Context(), ex, core.Ubuntu{}, observer); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rule := core.FirewallRule{Policy: core.FirewallAllow, Port: 80, Protocol: "tcp"}
+	if !ex.Executed(core.NftablesFirewall{}.AddRule(rule)) {
+		t.Errorf("expected nftables rule: %v", ex.History)
+	}
+	if len(observer.Results) != 1 || observer.Results[0].ID != "firewall nftables" {
+		t.Errorf("expected a result for nftables, got %v", observer.Results)
+	}
+}
+
+func Test_Firewall_NftablesSavesAfterEnable(t *testing.T) {
+	nft := core.NftablesFirewall{}
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			sshPortProbes[0]:  {Output: "22\n"},
+			nft.ListRules(""): {Output: "tcp dport 22 accept\n"},
+			nft.Active():      {Err: errors.New("exit status 1")},
+		},
+	}
+
+	if err := NewFirewall(WithFirewallBackend(nft)).Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{nft.Enable(), nft.Apply()}
+	changes := ex.History[len(ex.History)-len(expected):]
+	for i, command := range expected {
+		if changes[i] != command {
+			t.Errorf("command %d: expected %q, got %q", i, command, changes[i])
+		}
+	}
+}
+
+func Test_Firewall_InvalidRule(t *testing.T) {
+	for _, opt := range []FirewallOptsFunc{
+		WithAllowPort(0, "tcp"),
+		WithAllowPort(80, "icmp"),
+		WithAllowPortFrom(80, "tcp", "10.0.0.0/33"),
+	} {
+		ex := &core.FakeExecutor{}
+		if err := NewFirewall(opt).Handle(t.Context(), ex, core.Ubuntu{}, nil); err == nil {
+			t.Errorf("expected error for invalid rule %v", NewFirewall(opt).Rules)
+		}
+	}
+}
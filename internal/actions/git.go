@@ -0,0 +1,225 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+type GitCheckoutOpts struct {
+	Repo string
+	Dest string
+	// Ref is the branch, tag or commit to check out
+	Ref string
+	// DeployKey is the path of an SSH private key on the target used to
+	// fetch the repository
+	DeployKey string
+	// Depth makes a shallow clone with this much history. Zero fetches all
+	// of it.
+	Depth      int
+	Submodules bool
+	// Force discards local changes in the checkout instead of failing
+	Force bool
+}
+
+type GitCheckoutOptsFunc func(*GitCheckoutOpts)
+
+func WithRef(ref string) GitCheckoutOptsFunc {
+	return func(o *GitCheckoutOpts) {
+		o.Ref = ref
+	}
+}
+
+func WithDeployKey(keyPath string) GitCheckoutOptsFunc {
+	return func(o *GitCheckoutOpts) {
+		o.DeployKey = keyPath
+	}
+}
+
+func WithDepth(depth int) GitCheckoutOptsFunc {
+	return func(o *GitCheckoutOpts) {
+		o.Depth = depth
+	}
+}
+
+func WithSubmodules() GitCheckoutOptsFunc {
+	return func(o *GitCheckoutOpts) {
+		o.Submodules = true
+	}
+}
+
+func WithForce() GitCheckoutOptsFunc {
+	return func(o *GitCheckoutOpts) {
+		o.Force = true
+	}
+}
+
+// GitCheckout clones a repository on the target, or updates an existing
+// clone, and checks out a ref as a detached HEAD. It reports a change when
+// HEAD moves, with the old and new commits.
+type GitCheckout struct {
+	GitCheckoutOpts
+}
+
+func DefaultGitCheckoutOpts() GitCheckoutOpts {
+	return GitCheckoutOpts{
+		Ref: "HEAD",
+	}
+}
+
+func NewGitCheckout(repo string, dest string, opts ...GitCheckoutOptsFunc) *GitCheckout {
+	o := DefaultGitCheckoutOpts()
+	o.Repo = repo
+	o.Dest = dest
+	for _, fn := range opts {
+		fn(&o)
+	}
+	return &GitCheckout{
+		GitCheckoutOpts: o,
+	}
+}
+
+var commitSHA = regexp.MustCompile(`^[0-9a-f]{40}([0-9a-f]{24})?$`)
+
+func (a GitCheckout) Handle(ctx context.Context, ex core.Executor, os core.OS, observer core.ActionObserver) error {
+	return core.WithObserver(observer, func() error {
+		before := a.revParse(ctx, ex, "HEAD", observer)
+		cloned := before != ""
+		if !cloned && core.IsDryRun(ex) {
+			// A dry run can't resolve HEAD, so preview an update of an
+			// existing clone rather than a new one
+			_, exists, err := readFile(ctx, ex, path.Join(a.Dest, ".git", "HEAD"), observer)
+			if err != nil {
+				return err
+			}
+			cloned = exists
+		}
+
+		discarded := false
+		if !cloned {
+			if err := a.init(ctx, ex, observer); err != nil {
+				return err
+			}
+		} else {
+			var err error
+			discarded, err = a.prepare(ctx, ex, observer)
+			if err != nil {
+				return err
+			}
+		}
+
+		fetch := "fetch -q"
+		if a.Depth > 0 {
+			fetch += fmt.Sprintf(" --depth %d", a.Depth)
+		}
+		_, err := ex.Execute(ctx, a.git(fmt.Sprintf("%s origin %s", fetch, core.ShellQuote(a.Ref))), observer)
+		if err != nil {
+			return fmt.Errorf("failed to fetch %s from %s: %w", a.Ref, a.Repo, err)
+		}
+
+		after := a.revParse(ctx, ex, "FETCH_HEAD^{commit}", observer)
+		if after == "" && core.IsDryRun(ex) {
+			// Nothing was fetched, so show the checkout as pending
+			_, err = ex.Execute(ctx, a.git("checkout -q --detach FETCH_HEAD"), observer)
+			if err != nil {
+				return err
+			}
+			return core.ReportResult(observer, core.ActionResult{ID: "git " + a.Dest, Changed: true, Before: before})
+		}
+		if after == "" {
+			return fmt.Errorf("failed to resolve %s in %s", a.Ref, a.Repo)
+		}
+
+		changed := after != before
+		if changed {
+			_, err = ex.Execute(ctx, a.git("checkout -q --detach "+after), observer)
+			if err != nil {
+				return err
+			}
+		}
+
+		if a.Submodules {
+			update := "submodule update -q --init --recursive"
+			if a.Depth > 0 {
+				update += fmt.Sprintf(" --depth %d", a.Depth)
+			}
+			if _, err := ex.Execute(ctx, a.git(update), observer); err != nil {
+				return err
+			}
+		}
+
+		return core.ReportResult(observer, core.ActionResult{ID: "git " + a.Dest, Changed: changed || discarded, Before: before, After: after})
+	})
+}
+
+// git returns a git command run in Dest, using the deploy key if there is one
+func (a GitCheckout) git(args string) string {
+	command := fmt.Sprintf("git -C %s %s", core.ShellQuote(a.Dest), args)
+	if a.DeployKey == "" {
+		return command
+	}
+	ssh := fmt.Sprintf("ssh -i %s -o IdentitiesOnly=yes -o StrictHostKeyChecking=accept-new", core.ShellQuote(a.DeployKey))
+	return fmt.Sprintf("GIT_SSH_COMMAND=%s %s", core.ShellQuote(ssh), command)
+}
+
+// revParse returns the commit rev resolves to in Dest, or "" if it doesn't
+// resolve, e.g. because Dest isn't a clone yet
+func (a GitCheckout) revParse(ctx context.Context, ex core.Executor, rev string, observer core.ActionObserver) string {
+	output, err := ex.Execute(ctx, a.git("rev-parse -q --verify "+core.ShellQuote(rev)), observer)
+	sha := strings.TrimSpace(output)
+	if err != nil || !commitSHA.MatchString(sha) {
+		return ""
+	}
+	return sha
+}
+
+// init creates an empty repository in Dest to fetch into, so that clones and
+// updates work the same way for any kind of ref
+func (a GitCheckout) init(ctx context.Context, ex core.Executor, observer core.ActionObserver) error {
+	dest := core.ShellQuote(a.Dest)
+	command := fmt.Sprintf("git init -q %s && git -C %s remote add origin %s", dest, dest, core.ShellQuote(a.Repo))
+	_, err := ex.Execute(ctx, command, observer)
+	return err
+}
+
+// prepare points an existing clone at Repo and makes sure local changes
+// won't be overwritten, unless Force discards them. It reports whether
+// changes were discarded.
+func (a GitCheckout) prepare(ctx context.Context, ex core.Executor, observer core.ActionObserver) (bool, error) {
+	_, err := ex.Execute(ctx, a.git("remote set-url origin "+core.ShellQuote(a.Repo)), observer)
+	if err != nil {
+		return false, err
+	}
+
+	// Force also removes untracked files, so they count as changes then
+	status := "status --porcelain --untracked-files=no"
+	if a.Force {
+		status = "status --porcelain"
+	}
+	output, err := ex.Execute(ctx, a.git(status), observer)
+	if err != nil {
+		return false, err
+	}
+	if strings.TrimSpace(output) == "" {
+		return false, nil
+	}
+	if !a.Force {
+		// A dry run can't tell whether there are changes
+		if core.IsDryRun(ex) {
+			return false, nil
+		}
+		return false, fmt.Errorf("%s has local changes, use WithForce to discard them:\n%s", a.Dest, output)
+	}
+
+	_, err = ex.Execute(ctx, a.git("reset -q --hard")+" && "+a.git("clean -q -fd"), observer)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+var _ core.Action = (*GitCheckout)(nil)
@@ -0,0 +1,193 @@
+package actions
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+// gitRepo is a bare repository with a work tree used to push commits to it
+type gitRepo struct {
+	t    *testing.T
+	Bare string
+	work string
+}
+
+func newGitRepo(t *testing.T) *gitRepo {
+	t.Helper()
+	requireTools(t, "git")
+	dir := t.TempDir()
+	r := &gitRepo{t: t, Bare: filepath.Join(dir, "app.git"), work: filepath.Join(dir, "work")}
+	r.run("", "init", "-q", "--bare", "-b", "main", r.Bare)
+	r.run("", "clone", "-q", r.Bare, r.work)
+	return r
+}
+
+func (r *gitRepo) run(dir string, args ...string) string {
+	r.t.Helper()
+	cmd := exec.Command("git", append([]string{"-c", "user.name=Test", "-c", "user.email=test@example.com"}, args...)...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		r.t.Fatalf("git %v: %v: %s", args, err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// commit commits content to file on main and pushes it, returning the commit
+func (r *gitRepo) commit(file string, content string) string {
+	r.t.Helper()
+	if err := os.WriteFile(filepath.Join(r.work, file), []byte(content), 0o644); err != nil {
+		r.t.Fatal(err)
+	}
+	r.run(r.work, "add", file)
+	r.run(r.work, "commit", "-q", "-m", "update "+file)
+	r.run(r.work, "push", "-q", "origin", "HEAD:main")
+	return r.run(r.work, "rev-parse", "HEAD")
+}
+
+func Test_GitCheckout_CloneAndUpdate(t *testing.T) {
+	repo := newGitRepo(t)
+	first := repo.commit("index.html", "v1\n")
+	dest := filepath.Join(t.TempDir(), "app")
+	observer := &resultRecorder{}
+	action := NewGitCheckout(repo.Bare, dest, WithRef("main"))
+
+	if err := action.Handle(t.Context(), core.LocalExecutor{}, core.Ubuntu{}, observer); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	second := repo.commit("index.html", "v2\n")
+	for range 2 {
+		if err := action.Handle(t.Context(), core.LocalExecutor{}, core.Ubuntu{}, observer); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if content, _ := os.ReadFile(filepath.Join(dest, "index.html")); string(content) != "v2\n" {
+		t.Errorf("checkout not updated, got %q", content)
+	}
+
+	expected := []core.ActionResult{
+		{ID: "git " + dest, Changed: true, After: first},
+		{ID: "git " + dest, Changed: true, Before: first, After: second},
+		{ID: "git " + dest, Changed: false, Before: second, After: second},
+	}
+	if len(observer.Results) != len(expected) {
+		t.Fatalf("expected %d results, got %v", len(expected), observer.Results)
+	}
+	for i, result := range expected {
+		if observer.Results[i] != result {
+			t.Errorf("result %d: expected %v, got %v", i, result, observer.Results[i])
+		}
+	}
+}
+
+func Test_GitCheckout_TagAndCommit(t *testing.T) {
+	repo := newGitRepo(t)
+	first := repo.commit("VERSION", "1.0\n")
+	repo.run(repo.work, "tag", "v1.0")
+	repo.run(repo.work, "push", "-q", "origin", "v1.0")
+	repo.commit("VERSION", "2.0\n")
+	dest := filepath.Join(t.TempDir(), "app")
+
+	if err := NewGitCheckout(repo.Bare, dest, WithRef("v1.0"), WithDepth(1)).Handle(t.Context(), core.LocalExecutor{}, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if content, _ := os.ReadFile(filepath.Join(dest, "VERSION")); string(content) != "1.0\n" {
+		t.Errorf("tag not checked out, got %q", content)
+	}
+
+	if err := NewGitCheckout(repo.Bare, dest, WithRef(first)).Handle(t.Context(), core.LocalExecutor{}, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if head := repo.run(dest, "rev-parse", "HEAD"); head != first {
+		t.Errorf("expected HEAD at %s, got %s", first, head)
+	}
+}
+
+func Test_GitCheckout_LocalChanges(t *testing.T) {
+	repo := newGitRepo(t)
+	repo.commit("config.php", "<?php\n")
+	dest := filepath.Join(t.TempDir(), "app")
+	action := NewGitCheckout(repo.Bare, dest, WithRef("main"))
+	if err := action.Handle(t.Context(), core.LocalExecutor{}, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dest, "config.php"), []byte("edited\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := action.Handle(t.Context(), core.LocalExecutor{}, core.Ubuntu{}, nil); err == nil {
+		t.Fatal("expected error for a checkout with local changes")
+	}
+
+	observer := &resultRecorder{}
+	if err := NewGitCheckout(repo.Bare, dest, WithRef("main"), WithForce()).Handle(t.Context(), core.LocalExecutor{}, core.Ubuntu{}, observer); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if content, _ := os.ReadFile(filepath.Join(dest, "config.php")); string(content) != "<?php\n" {
+		t.Errorf("local changes not discarded, got %q", content)
+	}
+	if len(observer.Results) != 1 || !observer.Results[0].Changed {
+		t.Errorf("discarding local changes should be reported as a change, got %v", observer.Results)
+	}
+}
+
+func Test_GitCheckout_DryRun(t *testing.T) {
+	ex := &core.DryRunExecutor{}
+	observer := &resultRecorder{}
+
+	if err := NewGitCheckout("https://github.com/acme/app.git", "/srv/app").Handle(t.Context(), ex, core.Ubuntu{}, observer); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(observer.Results) != 1 || !observer.Results[0].Changed {
+		t.Errorf("expected a pending change, got %v", observer.Results)
+	}
+}
+
+func Test_GitCheckout_DryRunExistingClone(t *testing.T) {
+	dest := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dest, ".git"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dest, ".git", "HEAD"), []byte("ref: refs/heads/main\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ex := &core.DryRunExecutor{}
+
+	if err := NewGitCheckout("https://github.com/acme/app.git", dest).Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, command := range ex.Commands {
+		if strings.Contains(command, "git init") {
+			t.Errorf("should preview an update of the existing clone, got %v", ex.Commands)
+		}
+	}
+	if !slices.Contains(ex.Commands, "git -C "+dest+" remote set-url origin https://github.com/acme/app.git") {
+		t.Errorf("expected the clone to be pointed at the repository, got %v", ex.Commands)
+	}
+}
+
+func Test_GitCheckout_DeployKey(t *testing.T) {
+	ex := &core.FakeExecutor{}
+	action := NewGitCheckout("git@github.com:acme/app.git", "/srv/app", WithDeployKey("/root/.ssh/deploy_key"))
+
+	// The fake fetch never resolves to a commit
+	if err := action.Handle(t.Context(), ex, core.Ubuntu{}, nil); err == nil {
+		t.Fatal("expected error when the ref can't be resolved")
+	}
+
+	expected := "GIT_SSH_COMMAND='ssh -i /root/.ssh/deploy_key -o IdentitiesOnly=yes -o StrictHostKeyChecking=accept-new' git -C /srv/app fetch -q origin HEAD"
+	if !ex.Executed(expected) {
+		t.Errorf("did not fetch with deploy key: %v", ex.History)
+	}
+}
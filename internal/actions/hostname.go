@@ -0,0 +1,170 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+type HostnameOpts struct {
+	// Name is the hostname, either short or fully qualified
+	Name string
+	// HostsAddress is the address the name resolves to in /etc/hosts. Empty
+	// leaves /etc/hosts alone.
+	HostsAddress string
+}
+
+type HostnameOptsFunc func(*HostnameOpts)
+
+func WithHostsAddress(address string) HostnameOptsFunc {
+	return func(o *HostnameOpts) {
+		o.HostsAddress = address
+	}
+}
+
+func WithoutHostsEntry() HostnameOptsFunc {
+	return WithHostsAddress("")
+}
+
+// Hostname sets the hostname and makes it resolve locally through an
+// /etc/hosts entry such as "127.0.1.1 web1.example.com web1"
+type Hostname struct {
+	HostnameOpts
+}
+
+func DefaultHostnameOpts() HostnameOpts {
+	return HostnameOpts{
+		HostsAddress: "127.0.1.1",
+	}
+}
+
+func NewHostname(name string, opts ...HostnameOptsFunc) *Hostname {
+	o := DefaultHostnameOpts()
+	o.Name = name
+	for _, fn := range opts {
+		fn(&o)
+	}
+	return &Hostname{
+		HostnameOpts: o,
+	}
+}
+
+var hostname = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?(\.[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?)*$`)
+
+func (a Hostname) Handle(ctx context.Context, ex core.Executor, os core.OS, observer core.ActionObserver) error {
+	return core.WithObserver(observer, func() error {
+		if len(a.Name) > 253 || !hostname.MatchString(a.Name) {
+			return fmt.Errorf("invalid hostname %q", a.Name)
+		}
+
+		current, err := ex.Execute(ctx, os.Hostname(), observer)
+		if err != nil {
+			return err
+		}
+		current = strings.TrimSpace(current)
+		if core.IsDryRun(ex) {
+			current = ""
+		}
+
+		changed := false
+		if current != a.Name {
+			if _, err := ex.Execute(ctx, os.SetHostname(a.Name), observer); err != nil {
+				return err
+			}
+			changed = true
+		}
+
+		if a.HostsAddress != "" {
+			hostsChanged, err := a.ensureHostsEntry(ctx, ex, current, observer)
+			if err != nil {
+				return err
+			}
+			changed = changed || hostsChanged
+		}
+
+		return core.ReportResult(observer, core.ActionResult{ID: "hostname " + a.Name, Changed: changed, Before: current, After: a.Name})
+	})
+}
+
+// ensureHostsEntry puts the name first on the line for HostsAddress in
+// /etc/hosts, or adds a line for it. Only the names of the host, before and
+// after the change, are touched, so names such as localhost that share the
+// address stay. The file is rewritten in place, as containers bind mount it
+// and it can't be replaced.
+func (a Hostname) ensureHostsEntry(ctx context.Context, ex core.Executor, previous string, observer core.ActionObserver) (bool, error) {
+	names := hostNames(a.Name)
+	stale := names
+	if previous != "" && !strings.HasPrefix(previous, "localhost") {
+		stale = append(hostNames(previous), names...)
+	}
+
+	current, _, err := readFile(ctx, ex, "/etc/hosts", observer)
+	if err != nil {
+		return false, err
+	}
+
+	lines := splitLines(string(current))
+	var result []string
+	replaced := false
+	for _, line := range lines {
+		entry, comment, _ := strings.Cut(line, "#")
+		fields := strings.Fields(entry)
+		if len(fields) == 0 || fields[0] != a.HostsAddress {
+			result = append(result, line)
+			continue
+		}
+
+		var kept []string
+		for _, field := range fields[1:] {
+			if !slices.Contains(stale, field) {
+				kept = append(kept, field)
+			}
+		}
+		if !replaced {
+			kept = append(slices.Clone(names), kept...)
+			replaced = true
+		}
+		switch {
+		case slices.Equal(kept, fields[1:]):
+			result = append(result, line)
+		case len(kept) > 0:
+			updated := a.HostsAddress + "\t" + strings.Join(kept, " ")
+			if strings.Contains(line, "#") {
+				updated += " #" + comment
+			}
+			result = append(result, updated)
+		}
+	}
+	if !replaced {
+		result = append(result, a.HostsAddress+"\t"+strings.Join(names, " "))
+	}
+
+	content := joinLines(result)
+	if content == string(current) {
+		return false, nil
+	}
+
+	staging := "/etc/.hosts.anvil"
+	if err := core.Upload(ctx, ex, []byte(content), staging, 0o644, observer); err != nil {
+		return false, err
+	}
+	_, err = ex.Execute(ctx, fmt.Sprintf("cat %s > /etc/hosts && rm -f %s", staging, staging), observer)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// hostNames returns the name and, for a fully qualified one, its short form
+func hostNames(name string) []string {
+	if short, _, found := strings.Cut(name, "."); found {
+		return []string{name, short}
+	}
+	return []string{name}
+}
+
+var _ core.Action = (*Hostname)(nil)
@@ -0,0 +1,79 @@
+package actions
+
+import (
+	"testing"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+func Test_Hostname(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			core.Ubuntu{}.Hostname(): {Output: "ubuntu\n"},
+		},
+		Files: map[string][]byte{"/etc/hosts": []byte("127.0.0.1\tlocalhost\n127.0.1.1\tubuntu\n::1\tlocalhost ip6-localhost\n")},
+	}
+	observer := &resultRecorder{}
+
+	if err := NewHostname("web1.example.com").Handle(t.Context(), ex, core.Ubuntu{}, observer); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !ex.Executed(core.Ubuntu{}.SetHostname("web1.example.com")) {
+		t.Errorf("did not set hostname: %v", ex.History)
+	}
+	expected := "127.0.0.1\tlocalhost\n127.0.1.1\tweb1.example.com web1\n::1\tlocalhost ip6-localhost\n"
+	if content := string(ex.Files["/etc/.hosts.anvil"]); content != expected {
+		t.Errorf("unexpected hosts file:\n%s", content)
+	}
+	if !ex.Executed("cat /etc/.hosts.anvil > /etc/hosts && rm -f /etc/.hosts.anvil") {
+		t.Errorf("did not rewrite /etc/hosts in place: %v", ex.History)
+	}
+	if len(observer.Results) != 1 || observer.Results[0].Before != "ubuntu" || observer.Results[0].After != "web1.example.com" {
+		t.Errorf("unexpected result: %v", observer.Results)
+	}
+}
+
+func Test_Hostname_SharedAddress(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			core.Fedora{}.Hostname(): {Output: "fedora\n"},
+		},
+		Files: map[string][]byte{"/etc/hosts": []byte("127.0.0.1   localhost fedora localhost.localdomain # loopback\n::1         localhost fedora\n")},
+	}
+
+	if err := NewHostname("web1.example.com", WithHostsAddress("127.0.0.1")).Handle(t.Context(), ex, core.Fedora{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "127.0.0.1\tweb1.example.com web1 localhost localhost.localdomain # loopback\n::1         localhost fedora\n"
+	if content := string(ex.Files["/etc/.hosts.anvil"]); content != expected {
+		t.Errorf("unexpected hosts file:\n%s", content)
+	}
+}
+
+func Test_Hostname_Unchanged(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			core.Ubuntu{}.Hostname(): {Output: "db1\n"},
+		},
+		Files: map[string][]byte{"/etc/hosts": []byte("127.0.0.1\tlocalhost\n127.0.1.1\tdb1\n")},
+	}
+	observer := &resultRecorder{}
+
+	if err := NewHostname("db1").Handle(t.Context(), ex, core.Ubuntu{}, observer); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(observer.Results) != 1 || observer.Results[0].Changed {
+		t.Errorf("expected a single unchanged result, got %v", observer.Results)
+	}
+}
+
+func Test_Hostname_Invalid(t *testing.T) {
+	for _, name := range []string{"", "-web", "web_1", "web 1", "web1."} {
+		if err := NewHostname(name).Handle(t.Context(), &core.FakeExecutor{}, core.Ubuntu{}, nil); err == nil {
+			t.Errorf("expected error for hostname %q", name)
+		}
+	}
+}
@@ -9,16 +9,46 @@ import (
 type InstallPackageOpts struct {
 	PackageName string
 	Update      bool
+	// Version constrains the installed version, e.g. 1.24.* or 1.24.0
+	Version string
+	// Hold marks the package held (true) or not held (false) so the package
+	// manager won't upgrade it. Nil leaves it as it is.
+	Hold *bool
 }
 
 type InstallPackageOptsFunc func(*InstallPackageOpts)
 
+// WithUpdate refreshes the package cache before installing
 func WithUpdate() InstallPackageOptsFunc {
 	return func(o *InstallPackageOpts) {
 		o.Update = true
 	}
 }
 
+// WithVersion installs a specific version of the package. Trailing wildcards
+// are allowed, e.g. 1.24.*
+func WithVersion(version string) InstallPackageOptsFunc {
+	return func(o *InstallPackageOpts) {
+		o.Version = version
+	}
+}
+
+// WithHold holds the package at its installed version
+func WithHold() InstallPackageOptsFunc {
+	return func(o *InstallPackageOpts) {
+		hold := true
+		o.Hold = &hold
+	}
+}
+
+// WithUnhold releases a hold on the package
+func WithUnhold() InstallPackageOptsFunc {
+	return func(o *InstallPackageOpts) {
+		hold := false
+		o.Hold = &hold
+	}
+}
+
 type InstallPackage struct {
 	InstallPackageOpts
 }
@@ -42,17 +72,18 @@ func NewInstallPackage(packageName string, opts ...InstallPackageOptsFunc) *Inst
 }
 
 func (a InstallPackage) Handle(ctx context.Context, ex core.Executor, os core.OS, observer core.ActionObserver) error {
-	return core.WithObserver(observer, func() error {
-		if a.Update {
-			_, err := ex.Execute(ctx, os.UpdatePackages(), observer)
-			if err != nil {
-				return err
-			}
-		}
+	return InstallPackages{Packages: []InstallPackageOpts{a.InstallPackageOpts}}.Handle(ctx, ex, os, observer)
+}
+
+// Batch merges consecutive package installs into a single package manager
+// invocation
+func (a InstallPackage) Batch(others []core.Action) (core.Action, bool) {
+	return batchPackages([]InstallPackageOpts{a.InstallPackageOpts}, others)
+}
 
-		_, err := ex.Execute(ctx, os.InstallPackage(a.PackageName), observer)
-		return err
-	})
+func (a InstallPackage) BatchResults() int {
+	return 1
 }
 
-var _ core.Action = (*InstallPackage)(nil)
\ No newline at end of file
+var _ core.Action = (*InstallPackage)(nil)
+var _ core.Batchable = (*InstallPackage)(nil)
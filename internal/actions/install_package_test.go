@@ -0,0 +1,263 @@
+package actions
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+	"github.com/johnnyfreeman/anvil/internal/testutil"
+)
+
+func Test_InstallPackage(t *testing.T) {
+	os := core.Ubuntu{}
+	ex := &core.FakeExecutor{}
+	action := NewInstallPackage("nginx")
+
+	if err := action.Handle(t.Context(), ex, os, nil); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if !ex.Executed(os.InstallPackage("nginx")) {
+		t.Error("did not execute command to install package")
+	}
+}
+
+func Test_InstallPackage_LoopBatches(t *testing.T) {
+	os := core.Ubuntu{}
+	ex := &core.FakeExecutor{}
+	loop := core.ForEach("php", []string{"php-cli", "php-gd", "php-xml"}, func(name string) core.Action {
+		return NewInstallPackage(name)
+	})
+
+	if err := loop.Handle(t.Context(), ex, os, nil); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if !ex.Executed("apt-get install -y php-cli php-gd php-xml") {
+		t.Errorf("did not batch installs into one command: %v", ex.History)
+	}
+}
+
+func Test_InstallPackages_SkipsInstalled(t *testing.T) {
+	os := core.Ubuntu{}
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			os.CheckPackage("curl"): {Output: "8.5.0-2ubuntu10\n"},
+		},
+	}
+	observer := &resultRecorder{}
+	action := NewInstallPackages([]string{"nginx", "curl", "wget"})
+
+	if err := action.Handle(t.Context(), ex, os, observer); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if !ex.Executed(os.InstallPackages("nginx", "wget")) {
+		t.Errorf("did not install only the missing packages: %v", ex.History)
+	}
+
+	expected := map[string]bool{"package nginx": true, "package curl": false, "package wget": true}
+	if len(observer.Results) != len(expected) {
+		t.Fatalf("expected %d results, got %d", len(expected), len(observer.Results))
+	}
+	for _, result := range observer.Results {
+		if result.Changed != expected[result.ID] {
+			t.Errorf("unexpected changed status for %s: %v", result.ID, result.Changed)
+		}
+	}
+}
+
+func Test_InstallPackages_AllInstalled(t *testing.T) {
+	os := core.Fedora{}
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			os.CheckPackage("nginx"): {Output: "1.24.0-1.fc39\n"},
+		},
+	}
+	action := NewInstallPackages([]string{"nginx"})
+
+	if err := action.Handle(t.Context(), ex, os, nil); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if ex.Executed(os.InstallPackages("nginx")) {
+		t.Error("should not install a package that is already installed")
+	}
+}
+
+func Test_InstallPackage_RecipeCoalesces(t *testing.T) {
+	os := core.Ubuntu{}
+	ex := &core.FakeExecutor{}
+	recipe := core.NewBaseRecipe("test", "test", []core.Action{
+		NewInstallPackage("apache2"),
+		NewInstallPackage("curl"),
+		NewStartService("apache2"),
+		NewInstallPackage("wget"),
+	})
+
+	if err := recipe.Execute(t.Context(), ex, os, nil); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if !ex.Executed(os.InstallPackages("apache2", "curl")) {
+		t.Errorf("did not coalesce consecutive installs: %v", ex.History)
+	}
+
+	if !ex.Executed(os.InstallPackages("wget")) {
+		t.Errorf("should not coalesce installs across other actions: %v", ex.History)
+	}
+}
+
+// resultRecorder is an observer that records reported results
+type resultRecorder struct {
+	testutil.MockObserver
+	Results []core.ActionResult
+}
+
+func (o *resultRecorder) OnActionResult(result core.ActionResult) error {
+	o.Results = append(o.Results, result)
+	return nil
+}
+
+func Test_InstallPackage_Version(t *testing.T) {
+	os := core.Ubuntu{}
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			os.CheckPackage("nginx"): {Output: "1.22.1-9\n"},
+		},
+	}
+	action := NewInstallPackage("nginx", WithVersion("1.24.*"))
+
+	if err := action.Handle(t.Context(), ex, os, nil); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if !ex.Executed("apt-get install -y --allow-downgrades 'nginx=1.24.*'") {
+		t.Errorf("did not install the pinned version: %v", ex.History)
+	}
+}
+
+func Test_InstallPackage_VersionSatisfied(t *testing.T) {
+	os := core.Fedora{}
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			os.CheckPackage("nginx"): {Output: "1.24.0-1.fc39\n"},
+		},
+	}
+	action := NewInstallPackage("nginx", WithVersion("1.24.0"))
+
+	if err := action.Handle(t.Context(), ex, os, nil); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if ex.Executed(os.InstallPackages(os.PackageSpec("nginx", "1.24.0"))) {
+		t.Error("should not reinstall a package at the desired version")
+	}
+}
+
+func Test_InstallPackage_Hold(t *testing.T) {
+	os := core.Ubuntu{}
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			os.CheckPackage("postgresql-16"): {Output: "16.4-1\n"},
+			os.CheckPackage("nginx"):         {Output: "1.24.0-2\n"},
+			os.HeldPackages():                {Output: "nginx\n"},
+		},
+	}
+	observer := &resultRecorder{}
+	action := NewInstallPackages([]string{"postgresql-16", "nginx"}, WithHold())
+
+	if err := action.Handle(t.Context(), ex, os, observer); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if !ex.Executed(os.HoldPackages("postgresql-16")) {
+		t.Errorf("did not hold only the packages that aren't held: %v", ex.History)
+	}
+
+	expected := map[string]bool{"package postgresql-16": true, "package nginx": false}
+	for _, result := range observer.Results {
+		if result.Changed != expected[result.ID] {
+			t.Errorf("unexpected changed status for %s: %v", result.ID, result.Changed)
+		}
+	}
+}
+
+func Test_InstallPackage_HeldVersionChange(t *testing.T) {
+	os := core.Ubuntu{}
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			os.CheckPackage("nginx"): {Output: "1.22.1-9\n"},
+			os.HeldPackages():        {Output: "nginx\n"},
+		},
+	}
+	action := NewInstallPackages([]string{"nginx"}, WithVersion("1.24.*"), WithHold())
+
+	if err := action.Handle(t.Context(), ex, os, &resultRecorder{}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	expected := []string{
+		os.UnholdPackages("nginx"),
+		os.InstallPackages(os.PackageSpec("nginx", "1.24.*")),
+		os.HoldPackages("nginx"),
+	}
+	next := 0
+	for _, cmd := range ex.History {
+		if next < len(expected) && cmd == expected[next] {
+			next++
+		}
+	}
+	if next != len(expected) {
+		t.Errorf("expected the package to be released for the install and held again, got %v", ex.History)
+	}
+}
+
+func Test_VersionSatisfies(t *testing.T) {
+	cases := []struct {
+		installed string
+		desired   string
+		expected  bool
+	}{
+		{"1.24.0-1ubuntu1", "", true},
+		{"", "", false},
+		{"1.24.0-1ubuntu1", "1.24.*", true},
+		{"1.24.0-1ubuntu1", "1.24.0", true},
+		{"1.24.0-1ubuntu1", "1.24.0-1ubuntu1", true},
+		{"1.22.1-9", "1.24.*", false},
+		{"1:10.11.6-0+deb12u1", "10.11.*", true},
+		{"1.24.0-1.fc39", "1.24", false},
+	}
+	for _, c := range cases {
+		if versionSatisfies(c.installed, c.desired) != c.expected {
+			t.Errorf("versionSatisfies(%q, %q) should be %v", c.installed, c.desired, c.expected)
+		}
+	}
+}
+
+func Test_IsHeld(t *testing.T) {
+	if !isHeld("nginx-0:1.24.0-1.fc39.*\n", "nginx") {
+		t.Error("should recognise dnf versionlock entries")
+	}
+	if isHeld("nginx-module-njs\n", "nginx") {
+		t.Error("should not match packages that share a prefix")
+	}
+}
+
+func Test_InstallPackage_WithoutVersionlock(t *testing.T) {
+	os := core.Fedora{}
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			os.CheckPackage("nginx"): {Err: errors.New("package nginx is not installed")},
+			os.HeldPackages():        {Err: errors.New("No such command: versionlock")},
+		},
+	}
+
+	if err := NewInstallPackages([]string{"nginx"}).Handle(t.Context(), ex, os, &resultRecorder{}); err != nil {
+		t.Fatalf("installing without a hold should not need versionlock: %v", err)
+	}
+	if !slices.Contains(ex.History, os.InstallPackages(os.PackageSpec("nginx", ""))) {
+		t.Errorf("expected nginx to be installed, got %v", ex.History)
+	}
+}
@@ -0,0 +1,246 @@
+package actions
+
+import (
+	"context"
+	"path"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+// InstallPackages installs several packages with a single package manager
+// invocation, skipping the ones that are already installed at the desired
+// version
+type InstallPackages struct {
+	Packages []InstallPackageOpts
+}
+
+func NewInstallPackages(packageNames []string, opts ...InstallPackageOptsFunc) *InstallPackages {
+	packages := make([]InstallPackageOpts, 0, len(packageNames))
+	for _, name := range packageNames {
+		o := DefaultInstallPackageOpts()
+		o.PackageName = name
+		for _, fn := range opts {
+			fn(&o)
+		}
+		packages = append(packages, o)
+	}
+	return &InstallPackages{
+		Packages: packages,
+	}
+}
+
+func (a InstallPackages) Handle(ctx context.Context, ex core.Executor, os core.OS, observer core.ActionObserver) error {
+	return core.WithObserver(observer, func() error {
+		for _, p := range a.Packages {
+			if p.Update {
+				_, err := ex.Execute(ctx, os.RefreshPackageCache(), observer)
+				if err != nil {
+					return err
+				}
+				break
+			}
+		}
+
+		changed := make(map[string]bool)
+
+		var specs, installing []string
+		queued := make(map[string]bool)
+		for _, p := range a.Packages {
+			if queued[p.PackageName] {
+				continue
+			}
+			output, err := ex.Execute(ctx, os.CheckPackage(p.PackageName), observer)
+			if err == nil && versionSatisfies(installedVersion(output), p.Version) {
+				continue
+			}
+			specs = append(specs, os.PackageSpec(p.PackageName, p.Version))
+			installing = append(installing, p.PackageName)
+			queued[p.PackageName] = true
+			changed[p.PackageName] = true
+		}
+
+		hold, unhold, transient, err := a.holdChanges(ctx, ex, os, installing, observer)
+		if err != nil {
+			return err
+		}
+
+		// Held packages are released while their version changes, as apt and
+		// dnf versionlock refuse to change them, and held again afterwards
+		if release := slices.Concat(unhold, transient); len(release) > 0 {
+			_, err := ex.Execute(ctx, os.UnholdPackages(release...), observer)
+			if err != nil {
+				return err
+			}
+			for _, name := range unhold {
+				changed[name] = true
+			}
+		}
+
+		if len(specs) > 0 {
+			_, err := ex.Execute(ctx, os.InstallPackages(specs...), observer)
+			if err != nil {
+				if len(transient) > 0 {
+					if _, cleanupErr := ex.Execute(ctx, os.HoldPackages(transient...), observer); cleanupErr != nil {
+						// Log error but report the install failure
+					}
+				}
+				return err
+			}
+		}
+
+		if rehold := slices.Concat(hold, transient); len(rehold) > 0 {
+			_, err := ex.Execute(ctx, os.HoldPackages(rehold...), observer)
+			if err != nil {
+				return err
+			}
+			for _, name := range hold {
+				changed[name] = true
+			}
+		}
+
+		for _, p := range a.Packages {
+			if err := core.ReportResult(observer, core.ActionResult{ID: "package " + p.PackageName, Changed: changed[p.PackageName]}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// holdChanges returns the packages that need to be held and released to reach
+// the desired hold state, and the held packages among those being installed
+// that have to be released for the install only
+func (a InstallPackages) holdChanges(ctx context.Context, ex core.Executor, os core.OS, installing []string, observer core.ActionObserver) ([]string, []string, []string, error) {
+	requested := false
+	for _, p := range a.Packages {
+		if p.Hold != nil {
+			requested = true
+			break
+		}
+	}
+	if !requested && len(installing) == 0 {
+		return nil, nil, nil, nil
+	}
+
+	output, err := ex.Execute(ctx, os.HeldPackages(), observer)
+	if err != nil {
+		if requested {
+			return nil, nil, nil, err
+		}
+		// Listing holds fails where they aren't supported, e.g. without the
+		// dnf versionlock plugin, and then nothing can be held
+		return nil, nil, nil, nil
+	}
+
+	var hold, unhold, transient []string
+	seen := make(map[string]bool)
+	for _, p := range a.Packages {
+		if seen[p.PackageName] {
+			continue
+		}
+		seen[p.PackageName] = true
+		held := isHeld(output, p.PackageName)
+		switch {
+		case p.Hold != nil && *p.Hold && !held:
+			hold = append(hold, p.PackageName)
+		case p.Hold != nil && !*p.Hold && held:
+			unhold = append(unhold, p.PackageName)
+		case held && slices.Contains(installing, p.PackageName):
+			transient = append(transient, p.PackageName)
+		}
+	}
+	return hold, unhold, transient, nil
+}
+
+func (a InstallPackages) Batch(others []core.Action) (core.Action, bool) {
+	return batchPackages(a.Packages, others)
+}
+
+func (a InstallPackages) BatchResults() int {
+	return len(a.Packages)
+}
+
+// batchPackages merges the packages of other install actions into one
+// InstallPackages action, failing if any of them isn't a package install
+func batchPackages(packages []InstallPackageOpts, others []core.Action) (core.Action, bool) {
+	batch := &InstallPackages{
+		Packages: append([]InstallPackageOpts(nil), packages...),
+	}
+	for _, other := range others {
+		switch o := other.(type) {
+		case *InstallPackage:
+			batch.Packages = append(batch.Packages, o.InstallPackageOpts)
+		case InstallPackage:
+			batch.Packages = append(batch.Packages, o.InstallPackageOpts)
+		case *InstallPackages:
+			batch.Packages = append(batch.Packages, o.Packages...)
+		case InstallPackages:
+			batch.Packages = append(batch.Packages, o.Packages...)
+		default:
+			return nil, false
+		}
+	}
+	return batch, true
+}
+
+// installedVersion extracts the version printed by core.OS.CheckPackage,
+// returning an empty string if the output doesn't hold one
+func installedVersion(output string) string {
+	version := strings.TrimSpace(output)
+	if i := strings.IndexByte(version, '\n'); i >= 0 {
+		version = version[:i]
+	}
+	if version == "" || !unicode.IsDigit(rune(version[0])) {
+		return ""
+	}
+	return version
+}
+
+// versionSatisfies reports whether the installed version meets the desired
+// version constraint. An empty constraint accepts any installed version, and a
+// constraint without the packaging revision matches every revision of it.
+func versionSatisfies(installed string, desired string) bool {
+	if installed == "" {
+		return false
+	}
+	if desired == "" {
+		return true
+	}
+
+	candidates := []string{installed}
+	if _, version, ok := strings.Cut(installed, ":"); ok && !strings.Contains(desired, ":") {
+		candidates = append(candidates, version)
+	}
+
+	for _, candidate := range candidates {
+		if candidate == desired || strings.HasPrefix(candidate, desired+"-") {
+			return true
+		}
+		if matched, _ := path.Match(desired, candidate); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// isHeld reports whether the package appears in the output of
+// core.OS.HeldPackages, which lists either bare names or name-version entries
+func isHeld(output string, packageName string) bool {
+	for line := range strings.Lines(output) {
+		entry := strings.TrimSpace(line)
+		if entry == packageName {
+			return true
+		}
+		version, ok := strings.CutPrefix(entry, packageName+"-")
+		if ok && version != "" && unicode.IsDigit(rune(version[0])) {
+			return true
+		}
+	}
+	return false
+}
+
+var _ core.Action = (*InstallPackages)(nil)
+var _ core.Batchable = (*InstallPackages)(nil)
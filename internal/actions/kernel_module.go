@@ -0,0 +1,172 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+// ModuleState is the desired state of a kernel module
+type ModuleState int
+
+const (
+	ModuleLoaded ModuleState = iota
+	ModuleUnloaded
+)
+
+type KernelModuleOpts struct {
+	Name string
+	// Options are module parameters such as nf_conntrack_helper=1, written to
+	// /etc/modprobe.d. A module that is already loaded gets them the next
+	// time it is loaded.
+	Options []string
+	State   ModuleState
+}
+
+type KernelModuleOptsFunc func(*KernelModuleOpts)
+
+func WithModuleOptions(options ...string) KernelModuleOptsFunc {
+	return func(o *KernelModuleOpts) {
+		o.Options = append(o.Options, options...)
+	}
+}
+
+func WithModuleUnloaded() KernelModuleOptsFunc {
+	return func(o *KernelModuleOpts) {
+		o.State = ModuleUnloaded
+	}
+}
+
+// KernelModule loads a kernel module and loads it at boot through
+// /etc/modules-load.d, or unloads it and removes its configuration
+type KernelModule struct {
+	KernelModuleOpts
+}
+
+func DefaultKernelModuleOpts() KernelModuleOpts {
+	return KernelModuleOpts{
+		State: ModuleLoaded,
+	}
+}
+
+func NewKernelModule(name string, opts ...KernelModuleOptsFunc) *KernelModule {
+	o := DefaultKernelModuleOpts()
+	o.Name = name
+	for _, fn := range opts {
+		fn(&o)
+	}
+	return &KernelModule{
+		KernelModuleOpts: o,
+	}
+}
+
+func (a KernelModule) LoadPath() string {
+	return path.Join("/etc/modules-load.d", a.Name+".conf")
+}
+
+func (a KernelModule) OptionsPath() string {
+	return path.Join("/etc/modprobe.d", a.Name+".conf")
+}
+
+var (
+	moduleName   = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	moduleOption = regexp.MustCompile(`^[A-Za-z0-9_]+(=\S+)?$`)
+)
+
+func (a KernelModule) Handle(ctx context.Context, ex core.Executor, os core.OS, observer core.ActionObserver) error {
+	return core.WithObserver(observer, func() error {
+		if !moduleName.MatchString(a.Name) {
+			return fmt.Errorf("invalid kernel module name %q", a.Name)
+		}
+		for _, option := range a.Options {
+			if !moduleOption.MatchString(option) {
+				return fmt.Errorf("invalid option %q for kernel module %s", option, a.Name)
+			}
+		}
+
+		var changed bool
+		var err error
+		if a.State == ModuleUnloaded {
+			changed, err = a.unload(ctx, ex, observer)
+		} else {
+			changed, err = a.load(ctx, ex, observer)
+		}
+		if err != nil {
+			return err
+		}
+
+		return core.ReportResult(observer, core.ActionResult{ID: "kernel module " + a.Name, Changed: changed})
+	})
+}
+
+func (a KernelModule) load(ctx context.Context, ex core.Executor, observer core.ActionObserver) (bool, error) {
+	var changed bool
+	if len(a.Options) > 0 {
+		content := fmt.Sprintf("# Managed by anvil\noptions %s %s\n", a.Name, strings.Join(a.Options, " "))
+		optionsChanged, err := ensureFile(ctx, ex, a.OptionsPath(), []byte(content), 0o644, observer)
+		if err != nil {
+			return false, err
+		}
+		changed = optionsChanged
+	} else {
+		optionsRemoved, err := removeFile(ctx, ex, a.OptionsPath(), observer)
+		if err != nil {
+			return false, err
+		}
+		changed = optionsRemoved
+	}
+
+	loadChanged, err := ensureFile(ctx, ex, a.LoadPath(), []byte("# Managed by anvil\n"+a.Name+"\n"), 0o644, observer)
+	if err != nil {
+		return false, err
+	}
+	changed = changed || loadChanged
+
+	if !a.loaded(ctx, ex, observer) {
+		output, err := ex.Execute(ctx, fmt.Sprintf("modprobe %s", a.Name), observer)
+		if err != nil {
+			return false, fmt.Errorf("failed to load kernel module %s: %w: %s", a.Name, err, strings.TrimSpace(output))
+		}
+		changed = true
+	}
+	return changed, nil
+}
+
+func (a KernelModule) unload(ctx context.Context, ex core.Executor, observer core.ActionObserver) (bool, error) {
+	var changed bool
+	// A dry run can't tell whether the module is loaded, so it shows the
+	// module being unloaded
+	if a.loaded(ctx, ex, observer) || core.IsDryRun(ex) {
+		output, err := ex.Execute(ctx, fmt.Sprintf("modprobe -r %s", a.Name), observer)
+		if err != nil {
+			return false, fmt.Errorf("failed to unload kernel module %s: %w: %s", a.Name, err, strings.TrimSpace(output))
+		}
+		changed = true
+	}
+
+	for _, filePath := range []string{a.LoadPath(), a.OptionsPath()} {
+		removed, err := removeFile(ctx, ex, filePath, observer)
+		if err != nil {
+			return false, err
+		}
+		changed = changed || removed
+	}
+	return changed, nil
+}
+
+// loaded reports whether the module is loaded or built into the kernel.
+// /sys/module names modules with underscores whichever way they are
+// requested, while modules.builtin keeps the name of the module's file.
+func (a KernelModule) loaded(ctx context.Context, ex core.Executor, observer core.ActionObserver) bool {
+	name := strings.ReplaceAll(a.Name, "-", "_")
+	file := strings.ReplaceAll(name, "_", "[_-]")
+	command := fmt.Sprintf(`test -d /sys/module/%s || grep -q '/%s\.ko$' "/lib/modules/$(uname -r)/modules.builtin"`, name, file)
+	_, err := ex.Execute(ctx, command, observer)
+	return err == nil && !core.IsDryRun(ex)
+}
+
+var _ core.Action = (*KernelModule)(nil)
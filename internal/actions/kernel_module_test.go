@@ -0,0 +1,87 @@
+package actions
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+func Test_KernelModule(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			`test -d /sys/module/br_netfilter || grep -q '/br[_-]netfilter\.ko$' "/lib/modules/$(uname -r)/modules.builtin"`: {Err: errors.New("exit status 1")},
+		},
+	}
+	action := NewKernelModule("br_netfilter")
+
+	if err := action.Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if content := string(ex.Files["/etc/modules-load.d/br_netfilter.conf"]); content != "# Managed by anvil\nbr_netfilter\n" {
+		t.Errorf("unexpected modules-load.d content:\n%s", content)
+	}
+	if !ex.Executed("modprobe br_netfilter") {
+		t.Errorf("did not load the module: %v", ex.History)
+	}
+}
+
+func Test_KernelModule_Options(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Files: map[string][]byte{"/etc/modules-load.d/nf_conntrack.conf": []byte("# Managed by anvil\nnf_conntrack\n")},
+	}
+	observer := &resultRecorder{}
+
+	if err := NewKernelModule("nf_conntrack", WithModuleOptions("hashsize=262144")).Handle(t.Context(), ex, core.Ubuntu{}, observer); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if content := string(ex.Files["/etc/modprobe.d/nf_conntrack.conf"]); content != "# Managed by anvil\noptions nf_conntrack hashsize=262144\n" {
+		t.Errorf("unexpected modprobe.d content:\n%s", content)
+	}
+	if ex.Executed("modprobe nf_conntrack") {
+		t.Error("should not load a module that is loaded")
+	}
+	if len(observer.Results) != 1 || !observer.Results[0].Changed {
+		t.Errorf("expected a single changed result, got %v", observer.Results)
+	}
+}
+
+func Test_KernelModule_Unloaded(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Files: map[string][]byte{"/etc/modules-load.d/floppy.conf": []byte("floppy\n")},
+	}
+
+	if err := NewKernelModule("floppy", WithModuleUnloaded()).Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, command := range []string{"modprobe -r floppy", "rm -f /etc/modules-load.d/floppy.conf"} {
+		if !ex.Executed(command) {
+			t.Errorf("expected %q, got %v", command, ex.History)
+		}
+	}
+}
+
+func Test_KernelModule_Builtin(t *testing.T) {
+	probe := `test -d /sys/module/ip_tables || grep -q '/ip[_-]tables\.ko$' "/lib/modules/$(uname -r)/modules.builtin"`
+	ex := &core.FakeExecutor{
+		Files: map[string][]byte{"/etc/modules-load.d/ip-tables.conf": []byte("# Managed by anvil\nip-tables\n")},
+	}
+	observer := &resultRecorder{}
+
+	if err := NewKernelModule("ip-tables").Handle(t.Context(), ex, core.Ubuntu{}, observer); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !ex.Executed(probe) {
+		t.Errorf("did not look for the module in modules.builtin: %v", ex.History)
+	}
+	if ex.Executed("modprobe ip-tables") {
+		t.Error("should not load a module built into the kernel")
+	}
+	if len(observer.Results) != 1 || observer.Results[0].Changed {
+		t.Errorf("expected a single unchanged result, got %v", observer.Results)
+	}
+}
@@ -0,0 +1,63 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+// Locale sets the system locale, e.g. en_US.UTF-8, generating or installing
+// it first if the host doesn't have it
+type Locale struct {
+	Locale string
+}
+
+func NewLocale(locale string) *Locale {
+	return &Locale{
+		Locale: locale,
+	}
+}
+
+var localeName = regexp.MustCompile(`^[A-Za-z]+(_[A-Za-z]+)?(\.[A-Za-z0-9-]+)?(@[A-Za-z]+)?$`)
+
+func (a Locale) Handle(ctx context.Context, ex core.Executor, os core.OS, observer core.ActionObserver) error {
+	return core.WithObserver(observer, func() error {
+		if !localeName.MatchString(a.Locale) {
+			return fmt.Errorf("invalid locale %q", a.Locale)
+		}
+
+		changed := false
+		_, err := ex.Execute(ctx, os.LocaleAvailable(a.Locale), observer)
+		if err != nil || core.IsDryRun(ex) {
+			output, err := ex.Execute(ctx, os.GenerateLocale(a.Locale), observer)
+			if err != nil {
+				return fmt.Errorf("failed to generate locale %s: %w: %s", a.Locale, err, strings.TrimSpace(output))
+			}
+			changed = true
+		}
+
+		current, err := ex.Execute(ctx, os.Locale(), observer)
+		if err != nil {
+			return err
+		}
+		current = strings.TrimSpace(current)
+		if core.IsDryRun(ex) {
+			current = ""
+		}
+
+		if current != a.Locale {
+			output, err := ex.Execute(ctx, os.SetLocale(a.Locale), observer)
+			if err != nil {
+				return fmt.Errorf("failed to set locale %s: %w: %s", a.Locale, err, strings.TrimSpace(output))
+			}
+			changed = true
+		}
+
+		return core.ReportResult(observer, core.ActionResult{ID: "locale", Changed: changed, Before: current, After: a.Locale})
+	})
+}
+
+var _ core.Action = (*Locale)(nil)
@@ -0,0 +1,44 @@
+package actions
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+func Test_Locale_GeneratesMissing(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			core.Debian{}.LocaleAvailable("de_DE.UTF-8"): {Err: errors.New("exit status 1")},
+			core.Debian{}.Locale():                       {Output: "C.UTF-8\n"},
+		},
+	}
+
+	if err := NewLocale("de_DE.UTF-8").Handle(t.Context(), ex, core.Debian{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, command := range []string{core.Debian{}.GenerateLocale("de_DE.UTF-8"), core.Debian{}.SetLocale("de_DE.UTF-8")} {
+		if !ex.Executed(command) {
+			t.Errorf("expected %q, got %v", command, ex.History)
+		}
+	}
+}
+
+func Test_Locale_Unchanged(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			core.Fedora{}.Locale(): {Output: "en_US.UTF-8\n"},
+		},
+	}
+	observer := &resultRecorder{}
+
+	if err := NewLocale("en_US.UTF-8").Handle(t.Context(), ex, core.Fedora{}, observer); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(observer.Results) != 1 || observer.Results[0].Changed {
+		t.Errorf("expected a single unchanged result, got %v", observer.Results)
+	}
+}
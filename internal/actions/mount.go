@@ -0,0 +1,346 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+// MountState is the desired state of a filesystem
+type MountState int
+
+const (
+	// Mounted mounts the filesystem and persists it in /etc/fstab
+	Mounted MountState = iota
+	// MountPersisted only writes the /etc/fstab entry
+	MountPersisted
+	// Unmounted unmounts the filesystem but keeps its /etc/fstab entry
+	Unmounted
+	// MountAbsent unmounts the filesystem and removes its /etc/fstab entry
+	MountAbsent
+)
+
+type MountOpts struct {
+	Path string
+	// Source is what is mounted, e.g. UUID=..., LABEL=data or
+	// nfs.example.com:/export. Device paths are written to /etc/fstab by
+	// their filesystem UUID, as device names can change between boots.
+	Source  string
+	FSType  string
+	Options []string
+	Dump    int
+	Pass    int
+	State   MountState
+}
+
+type MountOptsFunc func(*MountOpts)
+
+func WithMountOptions(options ...string) MountOptsFunc {
+	return func(o *MountOpts) {
+		o.Options = options
+	}
+}
+
+// WithPass sets the fsck order, 1 for the root filesystem and 2 for others
+func WithPass(pass int) MountOptsFunc {
+	return func(o *MountOpts) {
+		o.Pass = pass
+	}
+}
+
+func WithMountPersistedOnly() MountOptsFunc {
+	return func(o *MountOpts) {
+		o.State = MountPersisted
+	}
+}
+
+func WithUnmounted() MountOptsFunc {
+	return func(o *MountOpts) {
+		o.State = Unmounted
+	}
+}
+
+func WithMountAbsent() MountOptsFunc {
+	return func(o *MountOpts) {
+		o.State = MountAbsent
+	}
+}
+
+// Mount ensures a filesystem is mounted with the given options and has an
+// /etc/fstab entry so it is mounted again at boot
+type Mount struct {
+	MountOpts
+}
+
+func DefaultMountOpts() MountOpts {
+	return MountOpts{
+		Options: []string{"defaults"},
+		State:   Mounted,
+	}
+}
+
+func NewMount(path string, source string, fsType string, opts ...MountOptsFunc) *Mount {
+	o := DefaultMountOpts()
+	o.Path = path
+	o.Source = source
+	o.FSType = fsType
+	for _, fn := range opts {
+		fn(&o)
+	}
+	return &Mount{
+		MountOpts: o,
+	}
+}
+
+func (a Mount) Handle(ctx context.Context, ex core.Executor, os core.OS, observer core.ActionObserver) error {
+	return core.WithObserver(observer, func() error {
+		if !strings.HasPrefix(a.Path, "/") {
+			return fmt.Errorf("invalid mount point %q: must be an absolute path", a.Path)
+		}
+		// /proc/mounts and findmnt list mount points without a trailing slash
+		a.Path = path.Clean(a.Path)
+
+		var changed bool
+		var source string
+		if a.State == Mounted || a.State == MountPersisted || a.State == Unmounted {
+			if a.Source == "" || a.FSType == "" {
+				return fmt.Errorf("mount %s needs a source and a filesystem type", a.Path)
+			}
+			var err error
+			source, err = a.fstabSource(ctx, ex, observer)
+			if err != nil {
+				return err
+			}
+			line := strings.Join([]string{fstabEscape(source), fstabEscape(a.Path), a.FSType, strings.Join(a.options(), ","), strconv.Itoa(a.Dump), strconv.Itoa(a.Pass)}, "\t")
+			changed, err = ensureFstabEntry(ctx, ex, line, a.matches, observer)
+			if err != nil {
+				return err
+			}
+		} else {
+			removed, err := removeFstabEntry(ctx, ex, a.matches, observer)
+			if err != nil {
+				return err
+			}
+			changed = removed
+		}
+
+		current, mounted, err := a.mounted(ctx, ex, observer)
+		if err != nil {
+			return err
+		}
+
+		var command string
+		switch {
+		case a.State == Mounted && !mounted:
+			command = fmt.Sprintf("mkdir -p %s && mount %s", core.ShellQuote(a.Path), core.ShellQuote(a.Path))
+		case a.State == Mounted:
+			if current.FSType != a.FSType {
+				return fmt.Errorf("%s is mounted as %s, not %s", a.Path, current.FSType, a.FSType)
+			}
+			// A remount can't change what is mounted, so a different source
+			// has to be unmounted by hand
+			mountedSource, same, err := a.sameSource(ctx, ex, source, observer)
+			if err != nil {
+				return err
+			}
+			if !same {
+				return fmt.Errorf("%s has %s mounted, not %s", a.Path, mountedSource, a.Source)
+			}
+			if missing := missingMountOptions(a.options(), current.Options); len(missing) > 0 {
+				command = fmt.Sprintf("mount -o %s %s", core.ShellQuote("remount,"+strings.Join(missing, ",")), core.ShellQuote(a.Path))
+			}
+		case (a.State == Unmounted || a.State == MountAbsent) && mounted:
+			command = fmt.Sprintf("umount %s", core.ShellQuote(a.Path))
+		}
+
+		if command != "" {
+			output, err := ex.Execute(ctx, command, observer)
+			if err != nil {
+				return fmt.Errorf("failed to change mount %s: %w: %s", a.Path, err, strings.TrimSpace(output))
+			}
+			changed = true
+		}
+
+		return core.ReportResult(observer, core.ActionResult{ID: "mount " + a.Path, Changed: changed})
+	})
+}
+
+func (a Mount) options() []string {
+	if len(a.Options) == 0 {
+		return []string{"defaults"}
+	}
+	return a.Options
+}
+
+// fstabSource returns the source to write to /etc/fstab, looking up the UUID
+// of a device path
+func (a Mount) fstabSource(ctx context.Context, ex core.Executor, observer core.ActionObserver) (string, error) {
+	if !strings.HasPrefix(a.Source, "/dev/") {
+		return a.Source, nil
+	}
+	output, err := ex.Execute(ctx, fmt.Sprintf("blkid -s UUID -o value %s", core.ShellQuote(a.Source)), observer)
+	if core.IsDryRun(ex) {
+		return a.Source, nil
+	}
+	uuid := strings.TrimSpace(output)
+	if err != nil || uuid == "" {
+		return "", fmt.Errorf("failed to find the filesystem UUID of %s: %v", a.Source, err)
+	}
+	return "UUID=" + uuid, nil
+}
+
+// findmntField matches a KEY="value" pair of findmnt -P
+var findmntField = regexp.MustCompile(`([A-Z]+)="([^"]*)"`)
+
+// sameSource reports whether the filesystem mounted at Path is source, the
+// way it is written to /etc/fstab, returning what is mounted. Bind mounts
+// show the device they are on and aren't compared.
+func (a Mount) sameSource(ctx context.Context, ex core.Executor, source string, observer core.ActionObserver) (string, bool, error) {
+	if slices.Contains(a.Options, "bind") || slices.Contains(a.Options, "rbind") {
+		return "", true, nil
+	}
+	output, err := ex.Execute(ctx, fmt.Sprintf("findmnt -n -P -o SOURCE,UUID,LABEL,PARTUUID,PARTLABEL --mountpoint %s", core.ShellQuote(a.Path)), observer)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to find the source of %s: %w", a.Path, err)
+	}
+	lines := splitLines(strings.TrimSpace(output))
+	if len(lines) == 0 {
+		return "", false, fmt.Errorf("failed to find the source of %s", a.Path)
+	}
+
+	// Of stacked mounts the last one is visible
+	fields := map[string]string{}
+	for _, match := range findmntField.FindAllStringSubmatch(lines[len(lines)-1], -1) {
+		fields[match[1]] = match[2]
+	}
+	mounted := fields["SOURCE"]
+
+	for _, candidate := range []string{a.Source, source} {
+		switch key, value, _ := strings.Cut(candidate, "="); {
+		case candidate == mounted:
+			return mounted, true, nil
+		case key != "SOURCE" && value != "" && fields[key] == value:
+			return mounted, true, nil
+		}
+	}
+	return mounted, false, nil
+}
+
+// matches reports whether fields of an /etc/fstab line are for this mount
+// point
+func (a Mount) matches(fields []string) bool {
+	return len(fields) >= 2 && fstabUnescape(fields[1]) == a.Path
+}
+
+// mountEntry is a line of /proc/mounts
+type mountEntry struct {
+	Source  string
+	FSType  string
+	Options []string
+}
+
+// mounted returns the filesystem mounted at Path from /proc/mounts. Of
+// stacked mounts the last one is visible.
+func (a Mount) mounted(ctx context.Context, ex core.Executor, observer core.ActionObserver) (mountEntry, bool, error) {
+	output, err := ex.Execute(ctx, "cat /proc/mounts", observer)
+	if err != nil {
+		return mountEntry{}, false, err
+	}
+
+	var entry mountEntry
+	found := false
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || fstabUnescape(fields[1]) != a.Path {
+			continue
+		}
+		entry = mountEntry{Source: fstabUnescape(fields[0]), FSType: fields[2], Options: strings.Split(fields[3], ",")}
+		found = true
+	}
+	return entry, found, nil
+}
+
+// missingMountOptions returns the options that aren't in effect. Options
+// that only tell mount or systemd what to do, such as defaults or nofail,
+// never appear in /proc/mounts and are ignored.
+func missingMountOptions(desired []string, current []string) []string {
+	var missing []string
+	for _, option := range desired {
+		switch {
+		case slices.Contains([]string{"defaults", "auto", "noauto", "nofail", "user", "nouser", "users", "_netdev"}, option):
+		case strings.HasPrefix(option, "x-"), strings.HasPrefix(option, "comment="):
+		case !slices.Contains(current, option):
+			missing = append(missing, option)
+		}
+	}
+	return missing
+}
+
+// ensureFstabEntry replaces the /etc/fstab lines that match with line, or
+// appends it. An entry with the same fields is left as it is.
+func ensureFstabEntry(ctx context.Context, ex core.Executor, line string, matches func(fields []string) bool, observer core.ActionObserver) (bool, error) {
+	opts := DefaultFileEditOpts()
+	opts.Path = "/etc/fstab"
+	opts.Create = true
+	return editFile(ctx, ex, opts, func(current string) string {
+		var lines []string
+		replaced := false
+		for _, existing := range splitLines(current) {
+			switch {
+			case !fstabLineMatches(existing, matches):
+				lines = append(lines, existing)
+			case replaced:
+			case slices.Equal(strings.Fields(existing), strings.Fields(line)):
+				// Keep the existing line's own spacing
+				lines = append(lines, existing)
+				replaced = true
+			default:
+				lines = append(lines, line)
+				replaced = true
+			}
+		}
+		if !replaced {
+			lines = append(lines, line)
+		}
+		return joinLines(lines)
+	}, observer)
+}
+
+// removeFstabEntry removes the /etc/fstab lines that match
+func removeFstabEntry(ctx context.Context, ex core.Executor, matches func(fields []string) bool, observer core.ActionObserver) (bool, error) {
+	opts := DefaultFileEditOpts()
+	opts.Path = "/etc/fstab"
+	opts.State = ContentAbsent
+	return editFile(ctx, ex, opts, func(current string) string {
+		var lines []string
+		for _, existing := range splitLines(current) {
+			if !fstabLineMatches(existing, matches) {
+				lines = append(lines, existing)
+			}
+		}
+		return joinLines(lines)
+	}, observer)
+}
+
+func fstabLineMatches(line string, matches func(fields []string) bool) bool {
+	fields := strings.Fields(line)
+	return len(fields) > 0 && !strings.HasPrefix(fields[0], "#") && matches(fields)
+}
+
+// fstabEscape escapes whitespace in an /etc/fstab field the way /etc/fstab
+// and /proc/mounts do, e.g. a space as \040
+func fstabEscape(field string) string {
+	return strings.NewReplacer(" ", `\040`, "\t", `\011`).Replace(field)
+}
+
+func fstabUnescape(field string) string {
+	return strings.NewReplacer(`\040`, " ", `\011`, "\t", `\012`, "\n", `\134`, `\`).Replace(field)
+}
+
+var _ core.Action = (*Mount)(nil)
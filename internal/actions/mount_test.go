@@ -0,0 +1,132 @@
+package actions
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+const baseFstab = "# /etc/fstab: static file system information.\nUUID=1111-2222 / ext4 errors=remount-ro 0 1\n"
+
+const dataSource = "findmnt -n -P -o SOURCE,UUID,LABEL,PARTUUID,PARTLABEL --mountpoint /srv/data"
+
+func Test_Mount(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Files: map[string][]byte{"/etc/fstab": []byte(baseFstab)},
+		Responses: map[string]core.FakeResponse{
+			"blkid -s UUID -o value /dev/nvme1n1": {Output: "3f1c-data\n"},
+			"cat /proc/mounts":                    {Output: "/dev/nvme0n1p1 / ext4 rw,relatime 0 0\n"},
+		},
+	}
+	action := NewMount("/var/lib/mysql", "/dev/nvme1n1", "ext4", WithMountOptions("defaults", "noatime"), WithPass(2))
+
+	if err := action.Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := baseFstab + "UUID=3f1c-data\t/var/lib/mysql\text4\tdefaults,noatime\t0\t2\n"
+	if content := string(ex.Files["/etc/.fstab.anvil"]); content != expected {
+		t.Errorf("unexpected fstab:\n%s", content)
+	}
+	if !ex.Executed("mkdir -p /var/lib/mysql && mount /var/lib/mysql") {
+		t.Errorf("did not mount: %v", ex.History)
+	}
+}
+
+func Test_Mount_Unchanged(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Files: map[string][]byte{"/etc/fstab": []byte(baseFstab + "LABEL=data  /srv/data  xfs  defaults,noatime  0  2\n")},
+		Responses: map[string]core.FakeResponse{
+			"cat /proc/mounts": {Output: "/dev/sdb1 /srv/data xfs rw,noatime,attr2 0 0\n"},
+			dataSource:         {Output: `SOURCE="/dev/sdb1" UUID="7d0e-data" LABEL="data" PARTUUID="" PARTLABEL=""` + "\n"},
+		},
+	}
+	observer := &resultRecorder{}
+	action := NewMount("/srv/data", "LABEL=data", "xfs", WithMountOptions("defaults", "noatime"), WithPass(2))
+
+	if err := action.Handle(t.Context(), ex, core.Ubuntu{}, observer); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(observer.Results) != 1 || observer.Results[0].Changed {
+		t.Errorf("expected a single unchanged result, got %v: %v", observer.Results, ex.History)
+	}
+}
+
+func Test_Mount_TrailingSlash(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Files: map[string][]byte{"/etc/fstab": []byte(baseFstab + "LABEL=data /srv/data xfs defaults 0 2\n")},
+		Responses: map[string]core.FakeResponse{
+			"cat /proc/mounts": {Output: "/dev/sdb1 /srv/data xfs rw,relatime 0 0\n"},
+			dataSource:         {Output: `SOURCE="/dev/sdb1" UUID="7d0e-data" LABEL="data" PARTUUID="" PARTLABEL=""` + "\n"},
+		},
+	}
+	observer := &resultRecorder{}
+
+	if err := NewMount("/srv/data/", "LABEL=data", "xfs", WithPass(2)).Handle(t.Context(), ex, core.Ubuntu{}, observer); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(observer.Results) != 1 || observer.Results[0].Changed {
+		t.Errorf("expected the mount to be recognised, got %v: %v", observer.Results, ex.History)
+	}
+}
+
+func Test_Mount_RemountsWithMissingOptions(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Files: map[string][]byte{"/etc/fstab": []byte("LABEL=data /srv/data xfs noatime,nodev 0 2\n")},
+		Responses: map[string]core.FakeResponse{
+			"cat /proc/mounts": {Output: "/dev/sdb1 /srv/data xfs rw,relatime 0 0\n"},
+			dataSource:         {Output: `SOURCE="/dev/sdb1" UUID="7d0e-data" LABEL="data" PARTUUID="" PARTLABEL=""` + "\n"},
+		},
+	}
+
+	if err := NewMount("/srv/data", "LABEL=data", "xfs", WithMountOptions("noatime", "nodev"), WithPass(2)).Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !ex.Executed("mount -o remount,noatime,nodev /srv/data") {
+		t.Errorf("did not remount with missing options: %v", ex.History)
+	}
+}
+
+func Test_Mount_DifferentSource(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Files: map[string][]byte{"/etc/fstab": []byte("LABEL=data /srv/data xfs defaults 0 2\n")},
+		Responses: map[string]core.FakeResponse{
+			"cat /proc/mounts": {Output: "/dev/sdc1 /srv/data xfs rw,relatime 0 0\n"},
+			dataSource:         {Output: `SOURCE="/dev/sdc1" UUID="91aa-backup" LABEL="backup" PARTUUID="" PARTLABEL=""` + "\n"},
+		},
+	}
+
+	err := NewMount("/srv/data", "LABEL=data", "xfs", WithPass(2)).Handle(t.Context(), ex, core.Ubuntu{}, nil)
+	if err == nil {
+		t.Fatal("expected error for another filesystem mounted at the mount point")
+	}
+	for _, command := range ex.History {
+		if strings.HasPrefix(command, "mount ") || strings.HasPrefix(command, "umount ") {
+			t.Errorf("should not change a mount of another filesystem: %s", command)
+		}
+	}
+}
+
+func Test_Mount_Absent(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Files: map[string][]byte{"/etc/fstab": []byte(baseFstab + "nfs.example.com:/export /mnt/share nfs defaults 0 0\n")},
+		Responses: map[string]core.FakeResponse{
+			"cat /proc/mounts": {Output: "nfs.example.com:/export /mnt/share nfs4 rw 0 0\n"},
+		},
+	}
+
+	if err := NewMount("/mnt/share", "", "", WithMountAbsent()).Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if content := string(ex.Files["/etc/.fstab.anvil"]); content != baseFstab {
+		t.Errorf("unexpected fstab:\n%s", content)
+	}
+	if !ex.Executed("umount /mnt/share") {
+		t.Errorf("did not unmount: %v", ex.History)
+	}
+}
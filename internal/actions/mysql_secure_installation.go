@@ -0,0 +1,133 @@
+package actions
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+type MySQLSecureInstallationOpts struct {
+	// RootPassword is set for root@localhost and written to /root/.my.cnf so
+	// the client keeps logging in. Empty leaves root's authentication alone,
+	// which on Debian and Ubuntu is the unix socket.
+	RootPassword string
+}
+
+type MySQLSecureInstallationOptsFunc func(*MySQLSecureInstallationOpts)
+
+func WithRootPassword(password string) MySQLSecureInstallationOptsFunc {
+	return func(o *MySQLSecureInstallationOpts) {
+		o.RootPassword = password
+	}
+}
+
+// MySQLSecureInstallation does what mysql_secure_installation does, without
+// prompting: it drops anonymous users, root accounts reachable from other
+// hosts and the test database, and optionally sets the root password
+type MySQLSecureInstallation struct {
+	MySQLSecureInstallationOpts
+}
+
+func DefaultMySQLSecureInstallationOpts() MySQLSecureInstallationOpts {
+	return MySQLSecureInstallationOpts{}
+}
+
+func NewMySQLSecureInstallation(opts ...MySQLSecureInstallationOptsFunc) *MySQLSecureInstallation {
+	o := DefaultMySQLSecureInstallationOpts()
+	for _, fn := range opts {
+		fn(&o)
+	}
+	return &MySQLSecureInstallation{
+		MySQLSecureInstallationOpts: o,
+	}
+}
+
+const mysqlRootOptionFile = "/root/.my.cnf"
+
+// mysqlInsecureQuery lists what mysql_secure_installation removes, one row
+// per account, database or grant
+const mysqlInsecureQuery = `SELECT 'user', User, Host FROM mysql.user WHERE User = '' OR (User = 'root' AND Host NOT IN ('localhost', '127.0.0.1', '::1'))
+UNION ALL SELECT 'database', SCHEMA_NAME, '' FROM information_schema.SCHEMATA WHERE SCHEMA_NAME = 'test'
+UNION ALL SELECT 'grant', Db, Host FROM mysql.db WHERE Db = 'test' OR Db LIKE 'test\\_%'`
+
+func (a MySQLSecureInstallation) Handle(ctx context.Context, ex core.Executor, os core.OS, observer core.ActionObserver) error {
+	return core.WithObserver(observer, func() error {
+		changed := false
+		if a.RootPassword != "" {
+			rootChanged, err := a.ensureRootPassword(ctx, ex, observer)
+			if err != nil {
+				return err
+			}
+			changed = rootChanged
+		}
+
+		rows, known, err := sqlQuery(ctx, ex, MySQL, mysqlInsecureQuery, observer)
+		if err != nil {
+			return err
+		}
+
+		var statements []string
+		var grants bool
+		for _, row := range rows {
+			if len(row) < 3 {
+				return fmt.Errorf("unexpected row checking the MySQL installation: %v", row)
+			}
+			switch row[0] {
+			case "user":
+				statements = append(statements, fmt.Sprintf("DROP USER IF EXISTS %s@%s", MySQL.quoteString(row[1]), MySQL.quoteString(row[2])))
+			case "database":
+				statements = append(statements, "DROP DATABASE IF EXISTS "+MySQL.quoteIdent(row[1]))
+			case "grant":
+				grants = true
+			}
+		}
+		if !known {
+			// Show the statements that don't depend on what the server has
+			statements = append(statements, "DROP DATABASE IF EXISTS `test`")
+			grants = true
+		}
+		if grants {
+			statements = append(statements, `DELETE FROM mysql.db WHERE Db = 'test' OR Db LIKE 'test\\_%'`)
+		}
+
+		if len(statements) > 0 {
+			statements = append(statements, "FLUSH PRIVILEGES")
+			if err := sqlApply(ctx, ex, MySQL, "secure-installation", statements, observer); err != nil {
+				return err
+			}
+			changed = true
+		}
+
+		return core.ReportResult(observer, core.ActionResult{ID: "mysql secure installation", Changed: changed})
+	})
+}
+
+// ensureRootPassword sets the root password when /root/.my.cnf doesn't have
+// it yet. The password is changed first, while the client can still log in
+// the way it did before, and the option file written after.
+func (a MySQLSecureInstallation) ensureRootPassword(ctx context.Context, ex core.Executor, observer core.ActionObserver) (bool, error) {
+	escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(a.RootPassword)
+	content := []byte(fmt.Sprintf("# Managed by anvil\n[client]\nuser=root\npassword=\"%s\"\n", escaped))
+
+	current, exists, err := readFile(ctx, ex, mysqlRootOptionFile, observer)
+	if err != nil {
+		return false, err
+	}
+	if exists && bytes.Equal(current, content) {
+		return false, nil
+	}
+
+	statement := "ALTER USER 'root'@'localhost' IDENTIFIED BY " + MySQL.quoteString(a.RootPassword)
+	if err := sqlApply(ctx, ex, MySQL, "root-password", []string{statement}, observer, a.RootPassword); err != nil {
+		return false, err
+	}
+	if err := core.Upload(ctx, ex, content, mysqlRootOptionFile, 0o600, observer); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+var _ core.Action = (*MySQLSecureInstallation)(nil)
@@ -0,0 +1,69 @@
+package actions
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+func Test_MySQLSecureInstallation(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			MySQL.queryCommand(mysqlInsecureQuery): {Output: "user\t\tlocalhost\nuser\troot\t%\ndatabase\ttest\t\ngrant\ttest\\_%\t%\n"},
+		},
+	}
+	observer := &resultRecorder{}
+
+	if err := NewMySQLSecureInstallation().Handle(t.Context(), ex, core.Ubuntu{}, observer); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "DROP USER IF EXISTS ''@'localhost';\nDROP USER IF EXISTS 'root'@'%';\nDROP DATABASE IF EXISTS `test`;\nDELETE FROM mysql.db WHERE Db = 'test' OR Db LIKE 'test\\\\_%';\nFLUSH PRIVILEGES;\n"
+	if script := string(ex.Files["/run/anvil/secure-installation.sql"]); script != expected {
+		t.Errorf("unexpected script: %q", script)
+	}
+	if len(observer.Results) != 1 || !observer.Results[0].Changed {
+		t.Errorf("expected a changed result, got %v", observer.Results)
+	}
+}
+
+func Test_MySQLSecureInstallation_Unchanged(t *testing.T) {
+	ex := &core.FakeExecutor{}
+	observer := &resultRecorder{}
+
+	if err := NewMySQLSecureInstallation().Handle(t.Context(), ex, core.Ubuntu{}, observer); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(ex.Files) != 0 {
+		t.Errorf("expected no script, got %v", ex.Files)
+	}
+	if len(observer.Results) != 1 || observer.Results[0].Changed {
+		t.Errorf("expected an unchanged result, got %v", observer.Results)
+	}
+}
+
+func Test_MySQLSecureInstallation_RootPassword(t *testing.T) {
+	ex := &core.FakeExecutor{}
+
+	if err := NewMySQLSecureInstallation(WithRootPassword(`pa"ss`)).Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if script := string(ex.Files["/run/anvil/root-password.sql"]); script != "ALTER USER 'root'@'localhost' IDENTIFIED BY 'pa\"ss';\n" {
+		t.Errorf("unexpected script: %q", script)
+	}
+	if cnf := string(ex.Files["/root/.my.cnf"]); !strings.Contains(cnf, `password="pa\"ss"`) {
+		t.Errorf("unexpected option file:\n%s", cnf)
+	}
+
+	// A second run finds the option file up to date
+	ex.Files = map[string][]byte{"/root/.my.cnf": ex.Files["/root/.my.cnf"]}
+	if err := NewMySQLSecureInstallation(WithRootPassword(`pa"ss`)).Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := ex.Files["/run/anvil/root-password.sql"]; ok {
+		t.Error("set the root password again")
+	}
+}
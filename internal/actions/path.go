@@ -0,0 +1,338 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+// PathState is the desired state of a path on the target
+type PathState int
+
+const (
+	// PathExists only manages the attributes of a path that must already
+	// exist
+	PathExists PathState = iota
+	PathDirectory
+	PathSymlink
+	PathAbsent
+)
+
+type PathOpts struct {
+	Path  string
+	State PathState
+	// Target is where a symlink points
+	Target string
+	Owner  string
+	Group  string
+	Mode   *fs.FileMode
+	// Recursive applies owner, group, mode and SELinux type to everything
+	// below the path too
+	Recursive bool
+	// SELinuxType is the SELinux type of the path, e.g. httpd_sys_content_t.
+	// It is ignored on hosts without SELinux.
+	SELinuxType string
+}
+
+type PathOptsFunc func(*PathOpts)
+
+func WithDirectory() PathOptsFunc {
+	return func(o *PathOpts) {
+		o.State = PathDirectory
+	}
+}
+
+func WithSymlinkTo(target string) PathOptsFunc {
+	return func(o *PathOpts) {
+		o.State = PathSymlink
+		o.Target = target
+	}
+}
+
+func WithPathAbsent() PathOptsFunc {
+	return func(o *PathOpts) {
+		o.State = PathAbsent
+	}
+}
+
+func WithOwner(owner string) PathOptsFunc {
+	return func(o *PathOpts) {
+		o.Owner = owner
+	}
+}
+
+func WithFileGroup(group string) PathOptsFunc {
+	return func(o *PathOpts) {
+		o.Group = group
+	}
+}
+
+func WithMode(mode fs.FileMode) PathOptsFunc {
+	return func(o *PathOpts) {
+		o.Mode = &mode
+	}
+}
+
+func WithRecursive() PathOptsFunc {
+	return func(o *PathOpts) {
+		o.Recursive = true
+	}
+}
+
+func WithSELinuxType(contextType string) PathOptsFunc {
+	return func(o *PathOpts) {
+		o.SELinuxType = contextType
+	}
+}
+
+// Path ensures a path is a directory, a symlink or absent, and that it has
+// the desired owner, group, mode and SELinux type
+type Path struct {
+	PathOpts
+}
+
+func DefaultPathOpts() PathOpts {
+	return PathOpts{
+		State: PathExists,
+	}
+}
+
+func NewPath(path string, opts ...PathOptsFunc) *Path {
+	o := DefaultPathOpts()
+	o.Path = path
+	for _, fn := range opts {
+		fn(&o)
+	}
+	return &Path{
+		PathOpts: o,
+	}
+}
+
+// pathStat is the parsed output of statCommand
+type pathStat struct {
+	Type  string
+	Mode  string
+	Owner string
+	UID   string
+	Group string
+	GID   string
+}
+
+func statCommand(path string) string {
+	return fmt.Sprintf("stat -c '%%F|%%a|%%U|%%u|%%G|%%g' %s", core.ShellQuote(path))
+}
+
+// parseStat parses stat output, reporting false if the path doesn't exist or
+// the output isn't stat's
+func parseStat(output string) (pathStat, bool) {
+	fields := strings.Split(strings.TrimSpace(output), "|")
+	if len(fields) != 6 {
+		return pathStat{}, false
+	}
+	if _, err := strconv.ParseUint(fields[1], 8, 32); err != nil {
+		return pathStat{}, false
+	}
+	return pathStat{
+		Type:  fields[0],
+		Mode:  fields[1],
+		Owner: fields[2],
+		UID:   fields[3],
+		Group: fields[4],
+		GID:   fields[5],
+	}, true
+}
+
+func (a Path) Handle(ctx context.Context, ex core.Executor, os core.OS, observer core.ActionObserver) error {
+	return core.WithObserver(observer, func() error {
+		if a.State == PathSymlink && a.Target == "" {
+			return fmt.Errorf("symlink %s needs a target", a.Path)
+		}
+
+		output, err := ex.Execute(ctx, statCommand(a.Path), observer)
+		current, exists := pathStat{}, false
+		if err == nil {
+			current, exists = parseStat(output)
+		}
+
+		changed, err := a.ensureState(ctx, ex, observer, current, exists)
+		if err != nil {
+			return err
+		}
+
+		if a.State != PathAbsent {
+			attrsChanged, err := a.ensureAttributes(ctx, ex, os, observer, current, exists && !changed)
+			if err != nil {
+				return err
+			}
+			changed = changed || attrsChanged
+		}
+
+		return core.ReportResult(observer, core.ActionResult{ID: "path " + a.Path, Changed: changed})
+	})
+}
+
+// ensureState creates, replaces or removes the path as needed
+func (a Path) ensureState(ctx context.Context, ex core.Executor, observer core.ActionObserver, current pathStat, exists bool) (bool, error) {
+	path := core.ShellQuote(a.Path)
+
+	var command string
+	switch a.State {
+	case PathExists:
+		if !exists {
+			return false, fmt.Errorf("%s does not exist", a.Path)
+		}
+		return false, nil
+	case PathAbsent:
+		if !exists {
+			return false, nil
+		}
+		command = fmt.Sprintf("rm -rf %s", path)
+	case PathDirectory:
+		if exists && current.Type == "directory" {
+			return false, nil
+		}
+		if exists {
+			return false, fmt.Errorf("%s exists and is a %s, not a directory", a.Path, current.Type)
+		}
+		command = fmt.Sprintf("mkdir -p %s", path)
+	case PathSymlink:
+		if exists && current.Type == "symbolic link" {
+			target, err := ex.Execute(ctx, fmt.Sprintf("readlink %s", path), observer)
+			if err == nil && strings.TrimSpace(target) == a.Target {
+				return false, nil
+			}
+		} else if exists && current.Type == "directory" {
+			return false, fmt.Errorf("%s is a directory, refusing to replace it with a symlink", a.Path)
+		}
+		command = fmt.Sprintf("ln -sfn %s %s", core.ShellQuote(a.Target), path)
+	}
+
+	_, err := ex.Execute(ctx, command, observer)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ensureAttributes sets the owner, group, mode and SELinux type. current is
+// only trusted when known is set; otherwise the attributes are applied.
+func (a Path) ensureAttributes(ctx context.Context, ex core.Executor, os core.OS, observer core.ActionObserver, current pathStat, known bool) (bool, error) {
+	path := core.ShellQuote(a.Path)
+	recursive := ""
+	if a.Recursive {
+		recursive = "-R "
+	}
+	// Symlinks are changed themselves rather than what they point to, and
+	// have no mode of their own
+	symlink := a.State == PathSymlink || current.Type == "symbolic link"
+	noDereference := ""
+	if symlink {
+		noDereference = "-h "
+	}
+
+	var commands []string
+
+	owner := a.Owner
+	if a.Group != "" {
+		owner += ":" + a.Group
+	}
+	if owner != "" && !(known && a.ownerMatches(ctx, ex, observer, current)) {
+		commands = append(commands, fmt.Sprintf("chown %s%s%s %s", noDereference, recursive, core.ShellQuote(owner), path))
+	}
+
+	if a.Mode != nil && !symlink {
+		mode := fmt.Sprintf("%o", a.Mode.Perm())
+		if !(known && a.modeMatches(ctx, ex, observer, current, mode)) {
+			commands = append(commands, fmt.Sprintf("chmod %s%s %s", recursive, mode, path))
+		}
+	}
+
+	if a.SELinuxType != "" {
+		if command := a.fileContextChange(ctx, ex, os, observer, known); command != "" {
+			commands = append(commands, command)
+		}
+	}
+
+	for _, command := range commands {
+		_, err := ex.Execute(ctx, command, observer)
+		if err != nil {
+			return false, err
+		}
+	}
+	return len(commands) > 0, nil
+}
+
+func (a Path) ownerMatches(ctx context.Context, ex core.Executor, observer core.ActionObserver, current pathStat) bool {
+	if a.Owner != "" && a.Owner != current.Owner && a.Owner != current.UID {
+		return false
+	}
+	if a.Group != "" && a.Group != current.Group && a.Group != current.GID {
+		return false
+	}
+	if !a.Recursive {
+		return true
+	}
+
+	var tests []string
+	if a.Owner != "" {
+		tests = append(tests, "! -user "+core.ShellQuote(a.Owner))
+	}
+	if a.Group != "" {
+		tests = append(tests, "! -group "+core.ShellQuote(a.Group))
+	}
+	return a.noneFound(ctx, ex, observer, strings.Join(tests, " -o "))
+}
+
+func (a Path) modeMatches(ctx context.Context, ex core.Executor, observer core.ActionObserver, current pathStat, mode string) bool {
+	currentMode, _ := strconv.ParseUint(current.Mode, 8, 32)
+	if fs.FileMode(currentMode).Perm() != a.Mode.Perm() {
+		return false
+	}
+	if !a.Recursive {
+		return true
+	}
+	return a.noneFound(ctx, ex, observer, fmt.Sprintf("! -perm %s ! -type l", mode))
+}
+
+// noneFound reports whether find finds nothing below the path that matches
+// tests, i.e. whether the whole tree already has the desired attributes
+func (a Path) noneFound(ctx context.Context, ex core.Executor, observer core.ActionObserver, tests string) bool {
+	output, err := ex.Execute(ctx, fmt.Sprintf("find %s \\( %s \\) -print -quit", core.ShellQuote(a.Path), tests), observer)
+	return err == nil && strings.TrimSpace(output) == ""
+}
+
+// fileContextChange returns the command that sets the SELinux type, or "" if
+// the host doesn't use SELinux or the type is already set
+func (a Path) fileContextChange(ctx context.Context, ex core.Executor, os core.OS, observer core.ActionObserver, known bool) string {
+	command := os.SetFileContext(a.Path, a.SELinuxType, a.Recursive)
+	probe := os.FileContext(a.Path)
+	if command == "" || probe == "" {
+		return ""
+	}
+	if _, err := ex.Execute(ctx, os.SELinuxEnabled(), observer); err != nil {
+		return ""
+	}
+	if !known {
+		return command
+	}
+
+	output, err := ex.Execute(ctx, probe, observer)
+	if err != nil {
+		return command
+	}
+	// SELinux contexts are user:role:type:level
+	fields := strings.Split(strings.TrimSpace(output), ":")
+	if len(fields) < 3 || fields[2] != a.SELinuxType {
+		return command
+	}
+	if a.Recursive && !a.noneFound(ctx, ex, observer, "! -context "+core.ShellQuote("*:"+a.SELinuxType+":*")) {
+		return command
+	}
+	return ""
+}
+
+var _ core.Action = (*Path)(nil)
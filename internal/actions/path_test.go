@@ -0,0 +1,157 @@
+package actions
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+func Test_Path_CreatesDirectory(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			statCommand("/srv/app"): {Output: "stat: cannot statx '/srv/app': No such file or directory\n", Err: errors.New("exit status 1")},
+		},
+	}
+	action := NewPath("/srv/app", WithDirectory(), WithOwner("deploy"), WithFileGroup("www-data"), WithMode(0o750))
+
+	if err := action.Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, command := range []string{"mkdir -p /srv/app", "chown deploy:www-data /srv/app", "chmod 750 /srv/app"} {
+		if !ex.Executed(command) {
+			t.Errorf("expected %q, got %v", command, ex.History)
+		}
+	}
+}
+
+func Test_Path_Unchanged(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			statCommand("/srv/app"): {Output: "directory|750|deploy|1001|www-data|33\n"},
+		},
+	}
+	observer := &resultRecorder{}
+	action := NewPath("/srv/app", WithDirectory(), WithOwner("1001"), WithFileGroup("www-data"), WithMode(0o750))
+
+	if err := action.Handle(t.Context(), ex, core.Ubuntu{}, observer); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(ex.History) != 1 {
+		t.Errorf("should only stat a converged path: %v", ex.History)
+	}
+
+	if len(observer.Results) != 1 || observer.Results[0].Changed {
+		t.Errorf("expected a single unchanged result, got %v", observer.Results)
+	}
+}
+
+func Test_Path_RecursiveFixesTree(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			statCommand("/var/www"):                                    {Output: "directory|755|www-data|33|www-data|33\n"},
+			"find /var/www \\( ! -user www-data \\) -print -quit":      {Output: "/var/www/index.html\n"},
+			"find /var/www \\( ! -perm 755 ! -type l \\) -print -quit": {Output: ""},
+		},
+	}
+	action := NewPath("/var/www", WithOwner("www-data"), WithMode(0o755), WithRecursive())
+
+	if err := action.Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !ex.Executed("chown -R www-data /var/www") {
+		t.Errorf("did not fix ownership of the tree: %v", ex.History)
+	}
+
+	if ex.Executed("chmod -R 755 /var/www") {
+		t.Error("should not change the mode of a tree that already has it")
+	}
+}
+
+func Test_Path_Symlink(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			statCommand("/etc/nginx/sites-enabled/app"): {Output: "symbolic link|777|root|0|root|0\n"},
+			"readlink /etc/nginx/sites-enabled/app":     {Output: "/etc/nginx/sites-available/old\n"},
+		},
+	}
+	action := NewPath("/etc/nginx/sites-enabled/app", WithSymlinkTo("/etc/nginx/sites-available/app"))
+
+	if err := action.Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !ex.Executed("ln -sfn /etc/nginx/sites-available/app /etc/nginx/sites-enabled/app") {
+		t.Errorf("did not repoint symlink: %v", ex.History)
+	}
+}
+
+func Test_Path_Absent(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			statCommand("/tmp/build"): {Output: "directory|755|root|0|root|0\n"},
+		},
+	}
+
+	if err := NewPath("/tmp/build", WithPathAbsent()).Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !ex.Executed("rm -rf /tmp/build") {
+		t.Errorf("did not remove path: %v", ex.History)
+	}
+}
+
+func Test_Path_SELinuxType(t *testing.T) {
+	os := core.Fedora{}
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			statCommand("/srv/www"):    {Output: "directory|755|root|0|root|0\n"},
+			os.FileContext("/srv/www"): {Output: "unconfined_u:object_r:var_t:s0\n"},
+		},
+	}
+	action := NewPath("/srv/www", WithSELinuxType("httpd_sys_content_t"))
+
+	if err := action.Handle(t.Context(), ex, os, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !ex.Executed("{ semanage fcontext -a -t httpd_sys_content_t /srv/www 2>/dev/null || semanage fcontext -m -t httpd_sys_content_t /srv/www; } && restorecon /srv/www") {
+		t.Errorf("did not set SELinux type: %v", ex.History)
+	}
+
+	debian := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			statCommand("/srv/www"): {Output: "directory|755|root|0|root|0\n"},
+		},
+	}
+	if err := action.Handle(t.Context(), debian, core.Debian{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(debian.History) != 1 {
+		t.Errorf("should ignore SELinux type on Debian: %v", debian.History)
+	}
+}
+
+func Test_Path_SELinuxDisabled(t *testing.T) {
+	os := core.Fedora{}
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			statCommand("/srv/www"):    {Output: "directory|755|root|0|root|0\n"},
+			os.SELinuxEnabled():        {Err: errors.New("exit status 1")},
+			os.FileContext("/srv/www"): {Output: "?\n"},
+		},
+	}
+	observer := &resultRecorder{}
+
+	if err := NewPath("/srv/www", WithSELinuxType("httpd_sys_content_t")).Handle(t.Context(), ex, os, observer); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(observer.Results) != 1 || observer.Results[0].Changed {
+		t.Errorf("should ignore SELinux type where SELinux is disabled: %v", ex.History)
+	}
+}
@@ -0,0 +1,221 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+// Condition is a probe run on the target that is polled until it holds
+type Condition struct {
+	Description string
+	Probe       func(os core.OS) string
+	Holds       func(output string, err error) bool
+}
+
+// ServiceActive holds once systemd reports the service as active
+func ServiceActive(serviceName string) Condition {
+	return Condition{
+		Description: fmt.Sprintf("service %s to be active", serviceName),
+		Probe: func(os core.OS) string {
+			return os.ServiceActive(serviceName)
+		},
+		Holds: func(output string, err error) bool {
+			return err == nil && parseServiceState(output, "") == "active"
+		},
+	}
+}
+
+// PortOpen holds once a TCP connection to host:port succeeds
+func PortOpen(host string, port int) Condition {
+	return Condition{
+		Description: fmt.Sprintf("port %s:%d to be open", host, port),
+		Probe: func(os core.OS) string {
+			return portProbe(host, port)
+		},
+		Holds: func(output string, err error) bool {
+			return err == nil
+		},
+	}
+}
+
+func portProbe(host string, port int) string {
+	return fmt.Sprintf("timeout 2 bash -c %s", core.ShellQuote(fmt.Sprintf("</dev/tcp/%s/%d", host, port)))
+}
+
+// HTTPOK holds once a GET of url returns a 2xx status
+func HTTPOK(url string) Condition {
+	return Condition{
+		Description: fmt.Sprintf("%s to return 2xx", url),
+		Probe: func(os core.OS) string {
+			return httpProbe(url)
+		},
+		Holds: func(output string, err error) bool {
+			status, ok := parseHTTPStatus(output)
+			return err == nil && ok && status >= 200 && status < 300
+		},
+	}
+}
+
+// httpProbe prints the HTTP status code of a GET of url, or 000 if the
+// request failed
+func httpProbe(url string) string {
+	return fmt.Sprintf("curl -sS -o /dev/null -w '%%{http_code}' --max-time 5 %s", core.ShellQuote(url))
+}
+
+func parseHTTPStatus(output string) (int, bool) {
+	output = strings.TrimSpace(output)
+	if len(output) != 3 {
+		return 0, false
+	}
+	status, err := strconv.Atoi(output)
+	return status, err == nil
+}
+
+// CommandSucceeds holds once command exits zero
+func CommandSucceeds(command string) Condition {
+	return Condition{
+		Description: fmt.Sprintf("%q to succeed", command),
+		Probe: func(os core.OS) string {
+			return command
+		},
+		Holds: func(output string, err error) bool {
+			return err == nil
+		},
+	}
+}
+
+// poll runs the condition's probe every interval until it holds, failing once
+// timeout has passed or ctx is cancelled. A dry run can't observe the
+// condition, so it is taken to hold.
+func poll(ctx context.Context, ex core.Executor, os core.OS, condition Condition, timeout time.Duration, interval time.Duration, observer core.ActionObserver) error {
+	deadline, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	probe := condition.Probe(os)
+	for {
+		output, err := ex.Execute(deadline, probe, observer)
+		if core.IsDryRun(ex) {
+			return nil
+		}
+		// A probe cut short by the deadline says nothing about the condition
+		if deadline.Err() == nil && condition.Holds(output, err) {
+			return nil
+		}
+
+		select {
+		case <-deadline.Done():
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("timed out after %s waiting for %s", timeout, condition.Description)
+		case <-time.After(interval):
+		}
+	}
+}
+
+// sustain waits up to timeout for condition to hold like poll, then requires
+// it to keep holding at every interval until timeout has passed
+func sustain(ctx context.Context, ex core.Executor, os core.OS, condition Condition, timeout time.Duration, interval time.Duration, observer core.ActionObserver) error {
+	deadline, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	probe := condition.Probe(os)
+	held := false
+	for {
+		output, err := ex.Execute(deadline, probe, observer)
+		if core.IsDryRun(ex) {
+			return nil
+		}
+		if deadline.Err() == nil {
+			holds := condition.Holds(output, err)
+			if held && !holds {
+				return fmt.Errorf("expected %s for %s, but it stopped", condition.Description, timeout)
+			}
+			held = holds
+		}
+
+		select {
+		case <-deadline.Done():
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if !held {
+				return fmt.Errorf("timed out after %s waiting for %s", timeout, condition.Description)
+			}
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+// PortClosed holds once a TCP connection to host:port is refused or times out
+func PortClosed(host string, port int) Condition {
+	return Condition{
+		Description: fmt.Sprintf("port %s:%d to be closed", host, port),
+		Probe: func(os core.OS) string {
+			return portProbe(host, port)
+		},
+		Holds: func(output string, err error) bool {
+			return err != nil
+		},
+	}
+}
+
+// FileExists holds once path exists on the target
+func FileExists(path string) Condition {
+	return Condition{
+		Description: fmt.Sprintf("%s to exist", path),
+		Probe: func(os core.OS) string {
+			return fmt.Sprintf("test -e %s", core.ShellQuote(path))
+		},
+		Holds: func(output string, err error) bool {
+			return err == nil
+		},
+	}
+}
+
+// FileAbsent holds once path no longer exists on the target
+func FileAbsent(path string) Condition {
+	return Condition{
+		Description: fmt.Sprintf("%s to be absent", path),
+		Probe: func(os core.OS) string {
+			return fmt.Sprintf("test ! -e %s", core.ShellQuote(path))
+		},
+		Holds: func(output string, err error) bool {
+			return err == nil
+		},
+	}
+}
+
+// FileMatches holds once a line of the file at path matches the extended
+// regular expression pattern
+func FileMatches(path string, pattern string) Condition {
+	return Condition{
+		Description: fmt.Sprintf("%s to match %q", path, pattern),
+		Probe: func(os core.OS) string {
+			return fmt.Sprintf("grep -Eq %s %s", core.ShellQuote(pattern), core.ShellQuote(path))
+		},
+		Holds: func(output string, err error) bool {
+			return err == nil
+		},
+	}
+}
+
+// HTTPStatus holds once a GET of url returns status
+func HTTPStatus(url string, status int) Condition {
+	return Condition{
+		Description: fmt.Sprintf("%s to return %d", url, status),
+		Probe: func(os core.OS) string {
+			return httpProbe(url)
+		},
+		Holds: func(output string, err error) bool {
+			actual, ok := parseHTTPStatus(output)
+			return err == nil && ok && actual == status
+		},
+	}
+}
@@ -0,0 +1,77 @@
+package actions
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+type RefreshPackageCacheOpts struct {
+	// ValidFor skips the refresh when the cache was refreshed more recently
+	// than this. Zero always refreshes.
+	ValidFor time.Duration
+}
+
+type RefreshPackageCacheOptsFunc func(*RefreshPackageCacheOpts)
+
+func WithCacheValidFor(validFor time.Duration) RefreshPackageCacheOptsFunc {
+	return func(o *RefreshPackageCacheOpts) {
+		o.ValidFor = validFor
+	}
+}
+
+// RefreshPackageCache refreshes the package manager's metadata without
+// upgrading anything
+type RefreshPackageCache struct {
+	RefreshPackageCacheOpts
+}
+
+func DefaultRefreshPackageCacheOpts() RefreshPackageCacheOpts {
+	return RefreshPackageCacheOpts{
+		ValidFor: 0,
+	}
+}
+
+func NewRefreshPackageCache(opts ...RefreshPackageCacheOptsFunc) *RefreshPackageCache {
+	o := DefaultRefreshPackageCacheOpts()
+	for _, fn := range opts {
+		fn(&o)
+	}
+	return &RefreshPackageCache{
+		RefreshPackageCacheOpts: o,
+	}
+}
+
+func (a RefreshPackageCache) Handle(ctx context.Context, ex core.Executor, os core.OS, observer core.ActionObserver) error {
+	return core.WithObserver(observer, func() error {
+		if a.ValidFor > 0 && a.cacheIsFresh(ctx, ex, os, observer) {
+			return core.ReportResult(observer, core.ActionResult{ID: "package cache", Changed: false})
+		}
+
+		_, err := ex.Execute(ctx, os.RefreshPackageCache(), observer)
+		if err != nil {
+			return err
+		}
+
+		return core.ReportResult(observer, core.ActionResult{ID: "package cache", Changed: true})
+	})
+}
+
+func (a RefreshPackageCache) cacheIsFresh(ctx context.Context, ex core.Executor, os core.OS, observer core.ActionObserver) bool {
+	output, err := ex.Execute(ctx, os.PackageCacheAge(), observer)
+	if err != nil {
+		return false
+	}
+
+	seconds, err := strconv.ParseInt(strings.TrimSpace(output), 10, 64)
+	if err != nil || seconds < 0 {
+		return false
+	}
+
+	return time.Duration(seconds)*time.Second < a.ValidFor
+}
+
+var _ core.Action = (*RefreshPackageCache)(nil)
@@ -0,0 +1,67 @@
+package actions
+
+import (
+	"testing"
+	"time"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+func Test_RefreshPackageCache(t *testing.T) {
+	os := core.Ubuntu{}
+	ex := &core.FakeExecutor{}
+	action := NewRefreshPackageCache()
+
+	if err := action.Handle(t.Context(), ex, os, nil); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if ex.Executed(os.PackageCacheAge()) {
+		t.Error("should not check cache age without a validity time")
+	}
+
+	if !ex.Executed(os.RefreshPackageCache()) {
+		t.Error("did not execute command to refresh package cache")
+	}
+}
+
+func Test_RefreshPackageCache_Fresh(t *testing.T) {
+	os := core.Ubuntu{}
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			os.PackageCacheAge(): {Output: "600\n"},
+		},
+	}
+	observer := &resultRecorder{}
+	action := NewRefreshPackageCache(WithCacheValidFor(time.Hour))
+
+	if err := action.Handle(t.Context(), ex, os, observer); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if ex.Executed(os.RefreshPackageCache()) {
+		t.Error("should not refresh a cache that is still valid")
+	}
+
+	if len(observer.Results) != 1 || observer.Results[0].Changed {
+		t.Errorf("expected a single unchanged result, got %v", observer.Results)
+	}
+}
+
+func Test_RefreshPackageCache_Stale(t *testing.T) {
+	os := core.Fedora{}
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			os.PackageCacheAge(): {Output: "7200\n"},
+		},
+	}
+	action := NewRefreshPackageCache(WithCacheValidFor(time.Hour))
+
+	if err := action.Handle(t.Context(), ex, os, nil); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if !ex.Executed(os.RefreshPackageCache()) {
+		t.Error("did not refresh a stale package cache")
+	}
+}
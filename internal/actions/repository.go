@@ -0,0 +1,184 @@
+package actions
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+// RepositoryState is the desired state of a package repository
+type RepositoryState int
+
+const (
+	RepositoryPresent RepositoryState = iota
+	RepositoryAbsent
+)
+
+type RepositoryOpts struct {
+	core.PackageRepository
+	// KeyFile is the local path of the ASCII-armored signing key
+	KeyFile      string
+	State        RepositoryState
+	RefreshCache bool
+}
+
+type RepositoryOptsFunc func(*RepositoryOpts)
+
+func WithRepositoryDescription(description string) RepositoryOptsFunc {
+	return func(o *RepositoryOpts) {
+		o.Description = description
+	}
+}
+
+func WithRepositoryURIs(uris ...string) RepositoryOptsFunc {
+	return func(o *RepositoryOpts) {
+		o.URIs = append(o.URIs, uris...)
+	}
+}
+
+func WithRepositorySuites(suites ...string) RepositoryOptsFunc {
+	return func(o *RepositoryOpts) {
+		o.Suites = append(o.Suites, suites...)
+	}
+}
+
+func WithRepositoryComponents(components ...string) RepositoryOptsFunc {
+	return func(o *RepositoryOpts) {
+		o.Components = append(o.Components, components...)
+	}
+}
+
+// WithRepositoryKey imports the signing key from a local file
+func WithRepositoryKey(keyFile string) RepositoryOptsFunc {
+	return func(o *RepositoryOpts) {
+		o.KeyFile = keyFile
+	}
+}
+
+// WithRepositoryAbsent removes the repository and its signing key
+func WithRepositoryAbsent() RepositoryOptsFunc {
+	return func(o *RepositoryOpts) {
+		o.State = RepositoryAbsent
+	}
+}
+
+// WithoutCacheRefresh skips refreshing the package cache after the repository
+// changed
+func WithoutCacheRefresh() RepositoryOptsFunc {
+	return func(o *RepositoryOpts) {
+		o.RefreshCache = false
+	}
+}
+
+// Repository manages a third-party package repository and its signing key
+type Repository struct {
+	RepositoryOpts
+}
+
+func DefaultRepositoryOpts() RepositoryOpts {
+	return RepositoryOpts{
+		State:        RepositoryPresent,
+		RefreshCache: true,
+	}
+}
+
+func NewRepository(name string, opts ...RepositoryOptsFunc) *Repository {
+	o := DefaultRepositoryOpts()
+	o.Name = name
+	for _, fn := range opts {
+		fn(&o)
+	}
+	return &Repository{
+		RepositoryOpts: o,
+	}
+}
+
+func (a Repository) Handle(ctx context.Context, ex core.Executor, os core.OS, observer core.ActionObserver) error {
+	return core.WithObserver(observer, func() error {
+		var changed bool
+		var err error
+		if a.State == RepositoryAbsent {
+			changed, err = a.remove(ctx, ex, os, observer)
+		} else {
+			changed, err = a.ensure(ctx, ex, os, observer)
+		}
+		if err != nil {
+			return err
+		}
+
+		if changed && a.RefreshCache {
+			_, err := ex.Execute(ctx, os.RefreshPackageCache(), observer)
+			if err != nil {
+				return err
+			}
+		}
+
+		return core.ReportResult(observer, core.ActionResult{ID: "repository " + a.Name, Changed: changed})
+	})
+}
+
+func (a Repository) ensure(ctx context.Context, ex core.Executor, os core.OS, observer core.ActionObserver) (bool, error) {
+	if len(a.URIs) == 0 {
+		return false, fmt.Errorf("repository '%s' has no URIs", a.Name)
+	}
+	if err := os.ValidateRepository(a.PackageRepository); err != nil {
+		return false, err
+	}
+
+	repo := a.PackageRepository
+	changed := false
+
+	if a.KeyFile != "" {
+		key, err := readSigningKey(a.KeyFile)
+		if err != nil {
+			return false, err
+		}
+
+		repo.KeyPath = os.RepositoryKeyPath(a.Name)
+		keyChanged, err := ensureFile(ctx, ex, repo.KeyPath, key, 0o644, observer)
+		if err != nil {
+			return false, err
+		}
+		changed = changed || keyChanged
+	}
+
+	content := []byte(os.RenderRepository(repo))
+	repoChanged, err := ensureFile(ctx, ex, os.RepositoryPath(a.Name), content, 0o644, observer)
+	if err != nil {
+		return false, err
+	}
+
+	return changed || repoChanged, nil
+}
+
+func (a Repository) remove(ctx context.Context, ex core.Executor, os core.OS, observer core.ActionObserver) (bool, error) {
+	repoChanged, err := removeFile(ctx, ex, os.RepositoryPath(a.Name), observer)
+	if err != nil {
+		return false, err
+	}
+
+	keyChanged, err := removeFile(ctx, ex, os.RepositoryKeyPath(a.Name), observer)
+	if err != nil {
+		return false, err
+	}
+
+	return repoChanged || keyChanged, nil
+}
+
+// readSigningKey reads a local signing key, which must be ASCII-armored so it
+// can be used by both APT and DNF
+func readSigningKey(keyFile string) ([]byte, error) {
+	key, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+	if !bytes.Contains(key, []byte("-----BEGIN PGP PUBLIC KEY BLOCK-----")) {
+		return nil, fmt.Errorf("signing key %s is not ASCII-armored", keyFile)
+	}
+	return key, nil
+}
+
+var _ core.Action = (*Repository)(nil)
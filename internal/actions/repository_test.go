@@ -0,0 +1,119 @@
+package actions
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+const testSigningKey = "-----BEGIN PGP PUBLIC KEY BLOCK-----\n\nmQINBGNoKey\n-----END PGP PUBLIC KEY BLOCK-----\n"
+
+func writeTestKey(t *testing.T) string {
+	t.Helper()
+	keyFile := filepath.Join(t.TempDir(), "pgdg.asc")
+	if err := os.WriteFile(keyFile, []byte(testSigningKey), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return keyFile
+}
+
+func Test_Repository(t *testing.T) {
+	target := core.Ubuntu{}
+	ex := &core.FakeExecutor{}
+	action := NewRepository("pgdg",
+		WithRepositoryURIs("https://apt.postgresql.org/pub/repos/apt"),
+		WithRepositorySuites("noble-pgdg"),
+		WithRepositoryComponents("main"),
+		WithRepositoryKey(writeTestKey(t)),
+	)
+
+	if err := action.Handle(t.Context(), ex, target, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if string(ex.Files["/etc/apt/keyrings/pgdg.asc"]) != testSigningKey {
+		t.Error("did not upload signing key")
+	}
+
+	source := string(ex.Files["/etc/apt/sources.list.d/pgdg.sources"])
+	if !strings.Contains(source, "Signed-By: /etc/apt/keyrings/pgdg.asc\n") {
+		t.Errorf("source does not reference signing key:\n%s", source)
+	}
+
+	if !ex.Executed(target.RefreshPackageCache()) {
+		t.Error("did not refresh package cache after adding repository")
+	}
+}
+
+func Test_Repository_Unchanged(t *testing.T) {
+	target := core.Fedora{}
+	repo := core.PackageRepository{Name: "docker-ce", URIs: []string{"https://download.docker.com/linux/fedora/$releasever/$basearch/stable"}}
+	ex := &core.FakeExecutor{
+		Files: map[string][]byte{
+			target.RepositoryPath("docker-ce"): []byte(target.RenderRepository(repo)),
+		},
+	}
+	observer := &resultRecorder{}
+	action := NewRepository("docker-ce", WithRepositoryURIs(repo.URIs...))
+
+	if err := action.Handle(t.Context(), ex, target, observer); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if ex.Executed(target.RefreshPackageCache()) {
+		t.Error("should not refresh package cache when repository is unchanged")
+	}
+
+	if len(observer.Results) != 1 || observer.Results[0].Changed {
+		t.Errorf("expected a single unchanged result, got %v", observer.Results)
+	}
+}
+
+func Test_Repository_Absent(t *testing.T) {
+	target := core.Debian{}
+	ex := &core.FakeExecutor{
+		Files: map[string][]byte{
+			target.RepositoryPath("nodesource"): []byte("Types: deb\n"),
+		},
+	}
+	action := NewRepository("nodesource", WithRepositoryAbsent(), WithoutCacheRefresh())
+
+	if err := action.Handle(t.Context(), ex, target, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !ex.Executed("rm -f /etc/apt/sources.list.d/nodesource.sources") {
+		t.Error("did not remove repository")
+	}
+
+	if ex.Executed("rm -f /etc/apt/keyrings/nodesource.asc") {
+		t.Error("should not remove a signing key that doesn't exist")
+	}
+}
+
+func Test_Repository_RejectsBinaryKey(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "key.gpg")
+	if err := os.WriteFile(keyFile, []byte{0x99, 0x02, 0x0d}, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	action := NewRepository("binary", WithRepositoryURIs("https://example.com"), WithRepositorySuites("stable"), WithRepositoryKey(keyFile))
+
+	if err := action.Handle(t.Context(), &core.FakeExecutor{}, core.Ubuntu{}, nil); err == nil {
+		t.Error("expected error for a key that is not ASCII-armored")
+	}
+}
+
+func Test_Repository_AptNeedsSuite(t *testing.T) {
+	ex := &core.FakeExecutor{}
+	action := NewRepository("nodesource", WithRepositoryURIs("https://deb.nodesource.com/node_22.x"))
+
+	if err := action.Handle(t.Context(), ex, core.Ubuntu{}, nil); err == nil {
+		t.Error("expected error for an APT repository without suites")
+	}
+	if len(ex.Files) > 0 {
+		t.Errorf("should not write an invalid source, wrote %v", ex.Files)
+	}
+}
@@ -0,0 +1,341 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+// ScheduleBackend is where a scheduled job is installed
+type ScheduleBackend int
+
+const (
+	// ScheduleCronD writes the job to /etc/cron.d/<name>
+	ScheduleCronD ScheduleBackend = iota
+	// ScheduleUserCrontab adds the job to the user's crontab
+	ScheduleUserCrontab
+	// ScheduleSystemdTimer writes a <name>.service and <name>.timer pair
+	ScheduleSystemdTimer
+)
+
+// JobState is the desired state of a scheduled job
+type JobState int
+
+const (
+	JobPresent JobState = iota
+	JobAbsent
+)
+
+type ScheduledJobOpts struct {
+	// Name identifies the job so it can be updated or removed later
+	Name string
+	// Schedule is a cron schedule, e.g. "*/15 * * * *" or "@daily". Timers
+	// get the equivalent calendar event.
+	Schedule string
+	Command  string
+	// User runs the command
+	User    string
+	Backend ScheduleBackend
+	State   JobState
+}
+
+type ScheduledJobOptsFunc func(*ScheduledJobOpts)
+
+func WithJobUser(user string) ScheduledJobOptsFunc {
+	return func(o *ScheduledJobOpts) {
+		o.User = user
+	}
+}
+
+func WithUserCrontab() ScheduledJobOptsFunc {
+	return func(o *ScheduledJobOpts) {
+		o.Backend = ScheduleUserCrontab
+	}
+}
+
+func WithSystemdTimer() ScheduledJobOptsFunc {
+	return func(o *ScheduledJobOpts) {
+		o.Backend = ScheduleSystemdTimer
+	}
+}
+
+func WithJobAbsent() ScheduledJobOptsFunc {
+	return func(o *ScheduledJobOpts) {
+		o.State = JobAbsent
+	}
+}
+
+// ScheduledJob runs a command on a schedule, as a cron entry or a systemd
+// timer. The job is identified by its name, so changing its schedule or
+// command replaces the existing entry rather than adding another.
+type ScheduledJob struct {
+	ScheduledJobOpts
+}
+
+func DefaultScheduledJobOpts() ScheduledJobOpts {
+	return ScheduledJobOpts{
+		User:    "root",
+		Backend: ScheduleCronD,
+		State:   JobPresent,
+	}
+}
+
+func NewScheduledJob(name string, schedule string, command string, opts ...ScheduledJobOptsFunc) *ScheduledJob {
+	o := DefaultScheduledJobOpts()
+	o.Name = name
+	o.Schedule = schedule
+	o.Command = command
+	for _, fn := range opts {
+		fn(&o)
+	}
+	return &ScheduledJob{
+		ScheduledJobOpts: o,
+	}
+}
+
+// jobName is what run-parts accepts in /etc/cron.d, which also makes a valid
+// unit name
+var jobName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+func (a ScheduledJob) Handle(ctx context.Context, ex core.Executor, os core.OS, observer core.ActionObserver) error {
+	return core.WithObserver(observer, func() error {
+		if !jobName.MatchString(a.Name) {
+			return fmt.Errorf("invalid job name %q: use letters, digits, '-' and '_'", a.Name)
+		}
+
+		var schedule cronSchedule
+		if a.State == JobPresent {
+			var err error
+			if schedule, err = parseCronSchedule(a.Schedule); err != nil {
+				return fmt.Errorf("job %s: %w", a.Name, err)
+			}
+			if strings.ContainsAny(a.Command, "\n") {
+				return fmt.Errorf("job %s: command must be a single line", a.Name)
+			}
+		}
+
+		var changed bool
+		var err error
+		switch a.Backend {
+		case ScheduleUserCrontab:
+			changed, err = a.ensureCrontab(ctx, ex, observer)
+		case ScheduleSystemdTimer:
+			changed, err = a.ensureTimer(ctx, ex, os, schedule, observer)
+		default:
+			if a.State == JobAbsent {
+				changed, err = removeFile(ctx, ex, a.CronDPath(), observer)
+			} else {
+				content := fmt.Sprintf("# Managed by anvil\n%s %s %s\n", a.Schedule, a.User, cronCommand(a.Command))
+				changed, err = ensureFile(ctx, ex, a.CronDPath(), []byte(content), 0o644, observer)
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		return core.ReportResult(observer, core.ActionResult{ID: "job " + a.Name, Changed: changed})
+	})
+}
+
+func (a ScheduledJob) CronDPath() string {
+	return path.Join("/etc/cron.d", a.Name)
+}
+
+// cronCommand escapes %, which cron otherwise turns into a newline
+func cronCommand(command string) string {
+	return strings.ReplaceAll(command, "%", `\%`)
+}
+
+// ensureCrontab adds, updates or removes the job in the user's crontab. The
+// entry follows a comment naming the job, and the rest of the crontab is left
+// as it is.
+func (a ScheduledJob) ensureCrontab(ctx context.Context, ex core.Executor, observer core.ActionObserver) (bool, error) {
+	user := core.ShellQuote(a.User)
+	output, err := ex.Execute(ctx, fmt.Sprintf("crontab -l -u %s", user), observer)
+	if err != nil && !strings.Contains(output, "no crontab") {
+		return false, fmt.Errorf("failed to read crontab of %s: %w: %s", a.User, err, strings.TrimSpace(output))
+	}
+	current := output
+	if err != nil || core.IsDryRun(ex) {
+		current = ""
+	}
+
+	marker := "# anvil: " + a.Name
+	var entry []string
+	if a.State == JobPresent {
+		entry = []string{marker, fmt.Sprintf("%s %s", a.Schedule, cronCommand(a.Command))}
+	}
+
+	lines := splitLines(current)
+	var result []string
+	replaced := false
+	for i := 0; i < len(lines); i++ {
+		if lines[i] != marker {
+			result = append(result, lines[i])
+			continue
+		}
+		// Skip the entry after the marker too
+		i++
+		if !replaced {
+			result = append(result, entry...)
+			replaced = true
+		}
+	}
+	if !replaced {
+		result = append(result, entry...)
+	}
+
+	content := joinLines(result)
+	if content == joinLines(lines) {
+		return false, nil
+	}
+
+	dir, err := stagingDir(ctx, ex, observer)
+	if err != nil {
+		return false, err
+	}
+	staging := path.Join(dir, "crontab")
+	output = ""
+	err = core.Upload(ctx, ex, []byte(content), staging, 0o600, observer)
+	if err == nil {
+		output, err = ex.Execute(ctx, fmt.Sprintf("crontab -u %s %s", user, core.ShellQuote(staging)), observer)
+	}
+	if _, cleanupErr := ex.Execute(ctx, fmt.Sprintf("rm -rf %s", core.ShellQuote(dir)), observer); cleanupErr != nil {
+		// Log error but report the crontab result
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to install crontab of %s: %w: %s", a.User, err, strings.TrimSpace(output))
+	}
+	return true, nil
+}
+
+// ensureTimer writes the job's service and timer units and converges the
+// timer to enabled and running, or stops it and removes both units
+func (a ScheduledJob) ensureTimer(ctx context.Context, ex core.Executor, os core.OS, schedule cronSchedule, observer core.ActionObserver) (bool, error) {
+	servicePath := os.ServiceUnitPath(a.Name + ".service")
+	timerName := a.Name + ".timer"
+	timerPath := os.ServiceUnitPath(timerName)
+
+	if a.State == JobAbsent {
+		var commands []string
+		state := serviceActiveState(ctx, ex, os, timerName, observer)
+		if state == "active" || state == "activating" {
+			commands = append(commands, os.StopService(timerName))
+		}
+		if serviceEnabledState(ctx, ex, os, timerName, observer) == "enabled" {
+			commands = append(commands, os.DisableService(timerName))
+		}
+		for _, command := range commands {
+			if _, err := ex.Execute(ctx, command, observer); err != nil {
+				return false, err
+			}
+		}
+
+		removed := len(commands) > 0
+		for _, unitPath := range []string{timerPath, servicePath} {
+			changed, err := removeFile(ctx, ex, unitPath, observer)
+			if err != nil {
+				return false, err
+			}
+			removed = removed || changed
+		}
+		if removed {
+			if _, err := ex.Execute(ctx, os.ReloadServices(), observer); err != nil {
+				return false, err
+			}
+		}
+		return removed, nil
+	}
+
+	timerContent, err := a.timerUnit(schedule)
+	if err != nil {
+		return false, err
+	}
+
+	unitsChanged := false
+	for _, unit := range []struct {
+		path    string
+		content string
+	}{
+		{servicePath, a.serviceUnit()},
+		{timerPath, timerContent},
+	} {
+		changed, err := ensureFile(ctx, ex, unit.path, []byte(unit.content), 0o644, observer)
+		if err != nil {
+			return false, err
+		}
+		unitsChanged = unitsChanged || changed
+	}
+
+	var commands []string
+	if unitsChanged {
+		commands = append(commands, os.ReloadServices())
+	}
+	if serviceEnabledState(ctx, ex, os, timerName, observer) != "enabled" {
+		commands = append(commands, os.EnableService(timerName))
+	}
+	state := serviceActiveState(ctx, ex, os, timerName, observer)
+	switch {
+	case state != "active" && state != "activating":
+		commands = append(commands, os.StartService(timerName))
+	case unitsChanged:
+		// A running timer keeps its old schedule until it is restarted
+		commands = append(commands, os.RestartService(timerName))
+	}
+
+	for _, command := range commands {
+		if _, err := ex.Execute(ctx, command, observer); err != nil {
+			return false, err
+		}
+	}
+	return unitsChanged || len(commands) > 0, nil
+}
+
+func (a ScheduledJob) serviceUnit() string {
+	return fmt.Sprintf(`# Managed by anvil
+
+[Unit]
+Description=%s
+
+[Service]
+Type=oneshot
+User=%s
+ExecStart=/bin/sh -c %s
+`, a.Name, a.User, systemdQuote(a.Command))
+}
+
+func (a ScheduledJob) timerUnit(schedule cronSchedule) (string, error) {
+	trigger := "OnBootSec=0"
+	if schedule.Macro != "@reboot" {
+		event, err := schedule.onCalendar()
+		if err != nil {
+			return "", fmt.Errorf("job %s: %w", a.Name, err)
+		}
+		trigger = "OnCalendar=" + event
+	}
+
+	return fmt.Sprintf(`# Managed by anvil
+
+[Unit]
+Description=Run %s on a schedule
+
+[Timer]
+%s
+
+[Install]
+WantedBy=timers.target
+`, a.Name, trigger), nil
+}
+
+// systemdQuote quotes a single argument of an Exec line, escaping systemd's
+// own specifier and variable expansion
+func systemdQuote(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "%", "%%", "$", "$$").Replace(s)
+	return `"` + s + `"`
+}
+
+var _ core.Action = (*ScheduledJob)(nil)
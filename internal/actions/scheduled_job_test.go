@@ -0,0 +1,174 @@
+package actions
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+func Test_ScheduledJob_CronD(t *testing.T) {
+	ex := &core.FakeExecutor{}
+	action := NewScheduledJob("backup", "30 2 * * *", "/usr/local/bin/backup --date=$(date +%F)", WithJobUser("backup"))
+
+	if err := action.Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "# Managed by anvil\n30 2 * * * backup /usr/local/bin/backup --date=$(date +\\%F)\n"
+	if content := string(ex.Files["/etc/cron.d/backup"]); content != expected {
+		t.Errorf("unexpected cron.d content:\n%s", content)
+	}
+}
+
+func Test_ScheduledJob_CronDUnchanged(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Files: map[string][]byte{"/etc/cron.d/backup": []byte("# Managed by anvil\n30 2 * * * root /usr/local/bin/backup\n")},
+	}
+	observer := &resultRecorder{}
+	action := NewScheduledJob("backup", "30 2 * * *", "/usr/local/bin/backup")
+
+	if err := action.Handle(t.Context(), ex, core.Ubuntu{}, observer); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(observer.Results) != 1 || observer.Results[0].Changed {
+		t.Errorf("expected a single unchanged result, got %v", observer.Results)
+	}
+}
+
+func Test_ScheduledJob_InvalidSchedule(t *testing.T) {
+	for _, schedule := range []string{"* * * *", "60 * * * *", "* 0-25 * * *", "*/0 * * * *", "5-1 * * * *", "* * * foo *", "@often"} {
+		ex := &core.FakeExecutor{}
+		action := NewScheduledJob("backup", schedule, "/usr/local/bin/backup")
+
+		if err := action.Handle(t.Context(), ex, core.Ubuntu{}, nil); err == nil {
+			t.Errorf("expected error for schedule %q", schedule)
+		}
+		if len(ex.Files) > 0 {
+			t.Errorf("should not write a job with schedule %q", schedule)
+		}
+	}
+}
+
+func Test_ScheduledJob_UserCrontab(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			"mktemp -d /tmp/anvil.XXXXXXXXXX": {Output: "/tmp/anvil.Q7cVn2pXe4\n"},
+			"crontab -l -u deploy":            {Output: "MAILTO=ops@example.com\n# anvil: prune\n0 * * * * /srv/app/prune\n@reboot /srv/app/warm\n"},
+		},
+	}
+	action := NewScheduledJob("prune", "*/10 * * * *", "/srv/app/prune", WithJobUser("deploy"), WithUserCrontab())
+
+	if err := action.Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "MAILTO=ops@example.com\n# anvil: prune\n*/10 * * * * /srv/app/prune\n@reboot /srv/app/warm\n"
+	if content := string(ex.Files["/tmp/anvil.Q7cVn2pXe4/crontab"]); content != expected {
+		t.Errorf("unexpected crontab:\n%s", content)
+	}
+	if !ex.Executed("crontab -u deploy /tmp/anvil.Q7cVn2pXe4/crontab") {
+		t.Errorf("did not install crontab: %v", ex.History)
+	}
+}
+
+func Test_ScheduledJob_UserCrontabEmpty(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			"mktemp -d /tmp/anvil.XXXXXXXXXX": {Output: "/tmp/anvil.Q7cVn2pXe4\n"},
+			"crontab -l -u root":              {Output: "no crontab for root", Err: errors.New("exit status 1")},
+		},
+	}
+	action := NewScheduledJob("prune", "@hourly", "/srv/app/prune", WithUserCrontab())
+
+	if err := action.Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if content := string(ex.Files["/tmp/anvil.Q7cVn2pXe4/crontab"]); content != "# anvil: prune\n@hourly /srv/app/prune\n" {
+		t.Errorf("unexpected crontab:\n%s", content)
+	}
+}
+
+func Test_ScheduledJob_UserCrontabAbsent(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			"mktemp -d /tmp/anvil.XXXXXXXXXX": {Output: "/tmp/anvil.Q7cVn2pXe4\n"},
+			"crontab -l -u root":              {Output: "# anvil: prune\n0 * * * * /srv/app/prune\n"},
+		},
+	}
+	action := NewScheduledJob("prune", "", "", WithUserCrontab(), WithJobAbsent())
+
+	if err := action.Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if content, ok := ex.Files["/tmp/anvil.Q7cVn2pXe4/crontab"]; !ok || len(content) != 0 {
+		t.Errorf("expected an empty crontab, got %q", content)
+	}
+}
+
+func Test_ScheduledJob_SystemdTimer(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			"systemctl is-enabled backup.timer": {Output: "disabled", Err: errors.New("exit status 1")},
+			"systemctl is-active backup.timer":  {Output: "inactive", Err: errors.New("exit status 3")},
+		},
+	}
+	action := NewScheduledJob("backup", "*/15 2 * * mon-fri", `pg_dump app > "/backups/app-$(date +%u).sql"`, WithSystemdTimer())
+
+	if err := action.Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	service := string(ex.Files["/etc/systemd/system/backup.service"])
+	if !strings.Contains(service, `ExecStart=/bin/sh -c "pg_dump app > \"/backups/app-$$(date +%%u).sql\""`) {
+		t.Errorf("unexpected service unit:\n%s", service)
+	}
+
+	timer := string(ex.Files["/etc/systemd/system/backup.timer"])
+	if !strings.Contains(timer, "OnCalendar=Mon,Tue,Wed,Thu,Fri *-*-* 2:0,15,30,45:00\n") {
+		t.Errorf("unexpected timer unit:\n%s", timer)
+	}
+
+	for _, command := range []string{"systemctl daemon-reload", "systemctl enable backup.timer", "systemctl start backup.timer"} {
+		if !ex.Executed(command) {
+			t.Errorf("expected %q, got %v", command, ex.History)
+		}
+	}
+}
+
+func Test_ScheduledJob_SystemdTimerRejectsDayOfMonthAndWeek(t *testing.T) {
+	ex := &core.FakeExecutor{}
+	action := NewScheduledJob("backup", "0 0 1 * mon", "/usr/local/bin/backup", WithSystemdTimer())
+
+	if err := action.Handle(t.Context(), ex, core.Ubuntu{}, nil); err == nil {
+		t.Fatal("expected error for a schedule a timer can't express")
+	}
+	if len(ex.Files) > 0 {
+		t.Error("should not write units for a schedule a timer can't express")
+	}
+}
+
+func Test_CronScheduleOnCalendar(t *testing.T) {
+	tests := map[string]string{
+		"@daily":         "daily",
+		"* * * * *":      "*-*-* *:*:00",
+		"0 */6 * * *":    "*-*-* 0,6,12,18:0:00",
+		"5 4 1,15 jan *": "*-1-1,15 4:5:00",
+		"0 9 * * 0-1,7":  "Sun,Mon *-*-* 9:0:00",
+	}
+
+	for schedule, expected := range tests {
+		parsed, err := parseCronSchedule(schedule)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", schedule, err)
+		}
+		event, err := parsed.onCalendar()
+		if err != nil || event != expected {
+			t.Errorf("%q: expected %q, got %q (%v)", schedule, expected, event, err)
+		}
+	}
+}
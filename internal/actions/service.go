@@ -2,6 +2,9 @@ package actions
 
 import (
 	"context"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/johnnyfreeman/anvil/internal/core"
 )
@@ -14,18 +17,26 @@ const (
 	StopService
 	EnableService
 	RestartService
+	DisableService
+	MaskService
+	UnmaskService
 )
 
-// ServiceAction performs operations on system services
+// ServiceAction performs operations on system services. Use Service to bring
+// a service to a desired state; RestartService is meant to be notified as a
+// handler with core.Notify.
 type ServiceAction struct {
 	ServiceName string
 	Operation   ServiceOperation
+	// HealthChecks verify the service after a start or restart
+	HealthChecks []HealthCheck
 }
 
-func NewStartService(serviceName string) *ServiceAction {
+func NewStartService(serviceName string, checks ...HealthCheck) *ServiceAction {
 	return &ServiceAction{
-		ServiceName: serviceName,
-		Operation:   StartService,
+		ServiceName:  serviceName,
+		Operation:    StartService,
+		HealthChecks: checks,
 	}
 }
 
@@ -43,15 +54,41 @@ func NewEnableService(serviceName string) *ServiceAction {
 	}
 }
 
-func NewRestartService(serviceName string) *ServiceAction {
+func NewRestartService(serviceName string, checks ...HealthCheck) *ServiceAction {
+	return &ServiceAction{
+		ServiceName:  serviceName,
+		Operation:    RestartService,
+		HealthChecks: checks,
+	}
+}
+
+func NewDisableService(serviceName string) *ServiceAction {
+	return &ServiceAction{
+		ServiceName: serviceName,
+		Operation:   DisableService,
+	}
+}
+
+func NewMaskService(serviceName string) *ServiceAction {
+	return &ServiceAction{
+		ServiceName: serviceName,
+		Operation:   MaskService,
+	}
+}
+
+func NewUnmaskService(serviceName string) *ServiceAction {
 	return &ServiceAction{
 		ServiceName: serviceName,
-		Operation:   RestartService,
+		Operation:   UnmaskService,
 	}
 }
 
 func (a ServiceAction) Handle(ctx context.Context, ex core.Executor, os core.OS, observer core.ActionObserver) error {
 	return core.WithObserver(observer, func() error {
+		if a.converged(ctx, ex, os, observer) {
+			return core.ReportResult(observer, core.ActionResult{ID: "service " + a.ServiceName, Changed: false})
+		}
+
 		var command string
 		switch a.Operation {
 		case StartService:
@@ -62,10 +99,255 @@ func (a ServiceAction) Handle(ctx context.Context, ex core.Executor, os core.OS,
 			command = os.EnableService(a.ServiceName)
 		case RestartService:
 			command = os.RestartService(a.ServiceName)
+		case DisableService:
+			command = os.DisableService(a.ServiceName)
+		case MaskService:
+			command = os.MaskService(a.ServiceName)
+		case UnmaskService:
+			command = os.UnmaskService(a.ServiceName)
 		}
 		_, err := ex.Execute(ctx, command, observer)
-		return err
+		if err != nil {
+			return err
+		}
+
+		if a.Operation == StartService || a.Operation == RestartService {
+			if err := verifyService(ctx, ex, os, a.ServiceName, a.HealthChecks, observer); err != nil {
+				return err
+			}
+		}
+
+		return core.ReportResult(observer, core.ActionResult{ID: "service " + a.ServiceName, Changed: true})
 	})
 }
 
-var _ core.Action = (*ServiceAction)(nil)
\ No newline at end of file
+// converged reports whether the unit's enablement already matches a disable,
+// mask or unmask operation
+func (a ServiceAction) converged(ctx context.Context, ex core.Executor, os core.OS, observer core.ActionObserver) bool {
+	switch a.Operation {
+	case DisableService:
+		state := serviceEnabledState(ctx, ex, os, a.ServiceName, observer)
+		return state == "disabled" || state == "masked" || fixedState(state)
+	case MaskService:
+		return serviceEnabledState(ctx, ex, os, a.ServiceName, observer) == "masked"
+	case UnmaskService:
+		return serviceEnabledState(ctx, ex, os, a.ServiceName, observer) != "masked"
+	}
+	return false
+}
+
+// serviceActiveState returns the active state of the service, e.g. active or
+// failed. is-active exits non-zero for anything but active, so only its output
+// is meaningful.
+func serviceActiveState(ctx context.Context, ex core.Executor, os core.OS, serviceName string, observer core.ActionObserver) string {
+	output, _ := ex.Execute(ctx, os.ServiceActive(serviceName), observer)
+	return parseServiceState(output, "inactive")
+}
+
+// serviceEnabledState returns the enablement state of the service, e.g.
+// enabled, disabled or masked. Units that don't exist report not-found.
+func serviceEnabledState(ctx context.Context, ex core.Executor, os core.OS, serviceName string, observer core.ActionObserver) string {
+	output, _ := ex.Execute(ctx, os.ServiceEnabled(serviceName), observer)
+	return parseServiceState(output, "not-found")
+}
+
+// fixedState reports whether systemctl enable and disable leave a unit in
+// the enablement state as it is. Static and generated units can't be enabled
+// or disabled, aliases such as Debian's mysql and indirect units follow the
+// unit they belong to. Such units need neither.
+func fixedState(state string) bool {
+	switch state {
+	case "static", "alias", "indirect", "generated":
+		return true
+	}
+	return false
+}
+
+// enabledState reports whether an enablement state needs no systemctl enable.
+// enabled-runtime doesn't survive a reboot, so it still needs one.
+func enabledState(state string) bool {
+	return state == "enabled" || fixedState(state)
+}
+
+func parseServiceState(output string, fallback string) string {
+	fields := strings.Fields(output)
+	if len(fields) != 1 {
+		return fallback
+	}
+	return fields[0]
+}
+
+var _ core.Action = (*ServiceAction)(nil)
+
+type ServiceOpts struct {
+	ServiceName string
+	// Running starts (true) or stops (false) the service. Nil leaves it as it
+	// is.
+	Running *bool
+	// Enabled enables (true) or disables (false) the service at boot. Nil
+	// leaves it as it is.
+	Enabled *bool
+	// HealthChecks verify the service after it was started
+	HealthChecks []HealthCheck
+}
+
+type ServiceOptsFunc func(*ServiceOpts)
+
+func WithServiceRunning(running bool) ServiceOptsFunc {
+	return func(o *ServiceOpts) {
+		o.Running = &running
+	}
+}
+
+func WithServiceEnabled(enabled bool) ServiceOptsFunc {
+	return func(o *ServiceOpts) {
+		o.Enabled = &enabled
+	}
+}
+
+func WithHealthChecks(checks ...HealthCheck) ServiceOptsFunc {
+	return func(o *ServiceOpts) {
+		o.HealthChecks = append(o.HealthChecks, checks...)
+	}
+}
+
+// Service converges a service to its desired running and enabled states,
+// only issuing the commands needed to get there
+type Service struct {
+	ServiceOpts
+}
+
+func DefaultServiceOpts() ServiceOpts {
+	return ServiceOpts{
+		ServiceName: "",
+	}
+}
+
+func NewService(serviceName string, opts ...ServiceOptsFunc) *Service {
+	o := DefaultServiceOpts()
+	o.ServiceName = serviceName
+	for _, fn := range opts {
+		fn(&o)
+	}
+	return &Service{
+		ServiceOpts: o,
+	}
+}
+
+func (a Service) Handle(ctx context.Context, ex core.Executor, os core.OS, observer core.ActionObserver) error {
+	return core.WithObserver(observer, func() error {
+		var commands []string
+
+		if a.Enabled != nil {
+			state := serviceEnabledState(ctx, ex, os, a.ServiceName, observer)
+			switch {
+			case *a.Enabled && state == "masked":
+				return fmt.Errorf("service %s is masked", a.ServiceName)
+			case *a.Enabled && !enabledState(state):
+				commands = append(commands, os.EnableService(a.ServiceName))
+			case !*a.Enabled && state == "enabled":
+				commands = append(commands, os.DisableService(a.ServiceName))
+			}
+		}
+
+		if a.Running != nil {
+			state := serviceActiveState(ctx, ex, os, a.ServiceName, observer)
+			running := state == "active" || state == "activating" || state == "reloading"
+			switch {
+			case *a.Running && !running:
+				commands = append(commands, os.StartService(a.ServiceName))
+			case !*a.Running && running:
+				commands = append(commands, os.StopService(a.ServiceName))
+			}
+		}
+
+		started := false
+		for _, command := range commands {
+			_, err := ex.Execute(ctx, command, observer)
+			if err != nil {
+				return err
+			}
+			started = started || command == os.StartService(a.ServiceName)
+		}
+
+		if started {
+			if err := verifyService(ctx, ex, os, a.ServiceName, a.HealthChecks, observer); err != nil {
+				return err
+			}
+		}
+
+		return core.ReportResult(observer, core.ActionResult{ID: "service " + a.ServiceName, Changed: len(commands) > 0})
+	})
+}
+
+var _ core.Action = (*Service)(nil)
+
+// HealthCheck verifies that a service works after it was started or
+// restarted, retrying its condition every Interval for up to Timeout
+type HealthCheck struct {
+	Condition
+	Timeout  time.Duration
+	Interval time.Duration
+	// Sustained requires the condition to keep holding until Timeout has
+	// passed, instead of passing as soon as it holds
+	Sustained bool
+}
+
+// CheckActive requires the service itself to become active and stay active
+// for timeout, catching services that crash shortly after starting
+func CheckActive(timeout time.Duration) HealthCheck {
+	return HealthCheck{Timeout: timeout, Interval: time.Second, Sustained: true}
+}
+
+// CheckPort waits up to timeout for port to accept connections on the target
+func CheckPort(port int, timeout time.Duration) HealthCheck {
+	return HealthCheck{Condition: PortOpen("127.0.0.1", port), Timeout: timeout, Interval: time.Second}
+}
+
+// CheckHTTP waits up to timeout for url to return a 2xx status, as seen from
+// the target
+func CheckHTTP(url string, timeout time.Duration) HealthCheck {
+	return HealthCheck{Condition: HTTPOK(url), Timeout: timeout, Interval: time.Second}
+}
+
+// CheckCommand waits up to timeout for command to succeed on the target
+func CheckCommand(command string, timeout time.Duration) HealthCheck {
+	return HealthCheck{Condition: CommandSucceeds(command), Timeout: timeout, Interval: time.Second}
+}
+
+// Every returns the check retrying at interval instead of every second
+func (c HealthCheck) Every(interval time.Duration) HealthCheck {
+	c.Interval = interval
+	return c
+}
+
+// serviceLogLines is how much of the journal is shown when a health check fails
+const serviceLogLines = 20
+
+// verifyService runs the health checks in order. When one fails, the tail of
+// the service's journal is shown through the observer.
+func verifyService(ctx context.Context, ex core.Executor, os core.OS, serviceName string, checks []HealthCheck, observer core.ActionObserver) error {
+	for _, check := range checks {
+		condition := check.Condition
+		if condition.Probe == nil {
+			condition = ServiceActive(serviceName)
+		}
+
+		wait := poll
+		if check.Sustained {
+			wait = sustain
+		}
+		err := wait(ctx, ex, os, condition, check.Timeout, check.Interval, observer)
+		if err == nil {
+			continue
+		}
+
+		if ctx.Err() == nil {
+			if _, logErr := ex.Execute(ctx, os.ServiceLogs(serviceName, serviceLogLines), observer); logErr != nil {
+				// Log error but report the failed check
+			}
+		}
+		return fmt.Errorf("service %s failed health check: %w", serviceName, err)
+	}
+	return nil
+}
\ No newline at end of file
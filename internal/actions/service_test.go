@@ -0,0 +1,234 @@
+package actions
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+func Test_Service_Converges(t *testing.T) {
+	os := core.Ubuntu{}
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			os.ServiceEnabled("nginx"): {Output: "enabled\n"},
+			os.ServiceActive("nginx"):  {Output: "inactive\n", Err: errors.New("exit status 3")},
+		},
+	}
+	observer := &resultRecorder{}
+	action := NewService("nginx", WithServiceEnabled(true), WithServiceRunning(true))
+
+	if err := action.Handle(t.Context(), ex, os, observer); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if ex.Executed("systemctl enable nginx") {
+		t.Error("should not enable an enabled service")
+	}
+
+	if !ex.Executed("systemctl start nginx") {
+		t.Error("did not start an inactive service")
+	}
+
+	if len(observer.Results) != 1 || !observer.Results[0].Changed {
+		t.Errorf("expected a single changed result, got %v", observer.Results)
+	}
+}
+
+func Test_Service_AlreadyConverged(t *testing.T) {
+	os := core.Fedora{}
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			os.ServiceEnabled("httpd"): {Output: "disabled\n", Err: errors.New("exit status 1")},
+			os.ServiceActive("httpd"):  {Output: "inactive\n", Err: errors.New("exit status 3")},
+		},
+	}
+	observer := &resultRecorder{}
+	action := NewService("httpd", WithServiceEnabled(false), WithServiceRunning(false))
+
+	if err := action.Handle(t.Context(), ex, os, observer); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(ex.History) != 2 {
+		t.Errorf("should only probe a converged service: %v", ex.History)
+	}
+
+	if len(observer.Results) != 1 || observer.Results[0].Changed {
+		t.Errorf("expected a single unchanged result, got %v", observer.Results)
+	}
+}
+
+func Test_Service_AliasIsEnabled(t *testing.T) {
+	os := core.Debian{}
+	for _, state := range []string{"alias", "static", "indirect", "generated"} {
+		ex := &core.FakeExecutor{
+			Responses: map[string]core.FakeResponse{
+				os.ServiceEnabled("mysql"): {Output: state + "\n"},
+			},
+		}
+		observer := &resultRecorder{}
+
+		if err := NewService("mysql", WithServiceEnabled(true)).Handle(t.Context(), ex, os, observer); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if ex.Executed(os.EnableService("mysql")) || observer.Results[0].Changed {
+			t.Errorf("should not enable a %s unit: %v", state, ex.History)
+		}
+	}
+}
+
+func Test_Service_EnablesRuntimeUnit(t *testing.T) {
+	os := core.Debian{}
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			os.ServiceEnabled("nginx"): {Output: "enabled-runtime\n"},
+		},
+	}
+
+	if err := NewService("nginx", WithServiceEnabled(true)).Handle(t.Context(), ex, os, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !ex.Executed(os.EnableService("nginx")) {
+		t.Errorf("should enable a unit that is only enabled until reboot: %v", ex.History)
+	}
+}
+
+func Test_Service_StopsAndDisables(t *testing.T) {
+	os := core.Debian{}
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			os.ServiceEnabled("apache2"): {Output: "enabled\n"},
+			os.ServiceActive("apache2"):  {Output: "active\n"},
+		},
+	}
+	action := NewService("apache2", WithServiceEnabled(false), WithServiceRunning(false))
+
+	if err := action.Handle(t.Context(), ex, os, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !ex.Executed("systemctl disable apache2") || !ex.Executed("systemctl stop apache2") {
+		t.Errorf("did not stop and disable service: %v", ex.History)
+	}
+}
+
+func Test_Service_MaskedCannotBeEnabled(t *testing.T) {
+	os := core.Ubuntu{}
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			os.ServiceEnabled("nginx"): {Output: "masked\n", Err: errors.New("exit status 1")},
+		},
+	}
+
+	if err := NewService("nginx", WithServiceEnabled(true)).Handle(t.Context(), ex, os, nil); err == nil {
+		t.Error("expected error enabling a masked service")
+	}
+}
+
+func Test_StartService_HealthCheckPasses(t *testing.T) {
+	os := core.Ubuntu{}
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			os.ServiceActive("nginx"): {Output: "active\n"},
+		},
+	}
+	action := NewStartService("nginx", CheckActive(20*time.Millisecond).Every(5*time.Millisecond), CheckPort(80, time.Second))
+
+	if err := action.Handle(t.Context(), ex, os, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !ex.Executed("timeout 2 bash -c '</dev/tcp/127.0.0.1/80'") {
+		t.Errorf("did not check port: %v", ex.History)
+	}
+}
+
+func Test_StartService_HealthCheckFailsWithJournal(t *testing.T) {
+	os := core.Ubuntu{}
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			os.ServiceActive("nginx"):   {Output: "failed\n", Err: errors.New("exit status 3")},
+			os.ServiceLogs("nginx", 20): {Output: "nginx: [emerg] bind() to 0.0.0.0:80 failed\n"},
+		},
+	}
+	observer := &resultRecorder{}
+	action := NewRestartService("nginx", CheckActive(30*time.Millisecond).Every(5*time.Millisecond))
+
+	err := action.Handle(t.Context(), ex, os, observer)
+	if err == nil {
+		t.Fatal("expected error for a service that never becomes active")
+	}
+
+	probes := 0
+	for _, command := range ex.History {
+		if command == os.ServiceActive("nginx") {
+			probes++
+		}
+	}
+	if probes < 2 {
+		t.Errorf("expected the check to be retried, got %d probes", probes)
+	}
+
+	if !slices.Contains(observer.Outputs, "nginx: [emerg] bind() to 0.0.0.0:80 failed\n") {
+		t.Errorf("did not show journal through the observer: %v", observer.Outputs)
+	}
+}
+
+func Test_RestartService_MustStayActive(t *testing.T) {
+	ex := &sequenceExecutor{responses: []core.FakeResponse{
+		{},
+		{Output: "active\n"},
+		{Output: "active\n"},
+		{Output: "failed\n", Err: errors.New("exit status 3")},
+	}}
+	action := NewRestartService("app", CheckActive(time.Second).Every(time.Millisecond))
+
+	err := action.Handle(t.Context(), ex, core.Ubuntu{}, nil)
+	if err == nil {
+		t.Fatal("expected error for a service that fails after becoming active")
+	}
+	if !strings.Contains(err.Error(), "stopped") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func Test_RestartService_StaysActive(t *testing.T) {
+	ex := &sequenceExecutor{responses: []core.FakeResponse{
+		{},
+		{Output: "activating\n", Err: errors.New("exit status 3")},
+		{Output: "active\n"},
+	}}
+	action := NewRestartService("app", CheckActive(30*time.Millisecond).Every(5*time.Millisecond))
+
+	if err := action.Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(ex.History) < 4 {
+		t.Errorf("expected the service to be checked until the duration passed, got %v", ex.History)
+	}
+}
+
+func Test_Service_HealthCheckOnlyAfterStart(t *testing.T) {
+	os := core.Ubuntu{}
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			os.ServiceActive("app"): {Output: "active\n"},
+		},
+	}
+	action := NewService("app", WithServiceRunning(true), WithHealthChecks(CheckHTTP("http://localhost/health", time.Second)))
+
+	if err := action.Handle(t.Context(), ex, os, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if ex.Executed(httpProbe("http://localhost/health")) {
+		t.Error("should not check a service that was already running")
+	}
+}
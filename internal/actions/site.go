@@ -0,0 +1,454 @@
+package actions
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+// SiteState is the desired state of a web server site
+type SiteState int
+
+const (
+	SiteEnabled SiteState = iota
+	SiteAbsent
+)
+
+type SiteOpts struct {
+	// Name is the configuration file name, the server name by default
+	Name       string
+	Server     core.WebServerKind
+	ServerName string
+	Aliases    []string
+	// DocumentRoot is the directory static files and PHP scripts are
+	// served from
+	DocumentRoot string
+	// ProxyPass is the upstream requests are proxied to, e.g.
+	// http://127.0.0.1:3000
+	ProxyPass string
+	// PHPFPMSocket is the PHP-FPM socket .php files under DocumentRoot are
+	// passed to, e.g. /run/php/php8.3-fpm.sock
+	PHPFPMSocket string
+	// TLSCertificate and TLSKey serve the site over HTTPS, redirecting
+	// plain HTTP to it
+	TLSCertificate string
+	TLSKey         string
+	State          SiteState
+}
+
+type SiteOptsFunc func(*SiteOpts)
+
+func WithSiteName(name string) SiteOptsFunc {
+	return func(o *SiteOpts) {
+		o.Name = name
+	}
+}
+
+func WithServerAliases(aliases ...string) SiteOptsFunc {
+	return func(o *SiteOpts) {
+		o.Aliases = append(o.Aliases, aliases...)
+	}
+}
+
+func WithDocumentRoot(documentRoot string) SiteOptsFunc {
+	return func(o *SiteOpts) {
+		o.DocumentRoot = documentRoot
+	}
+}
+
+func WithProxyPass(upstream string) SiteOptsFunc {
+	return func(o *SiteOpts) {
+		o.ProxyPass = upstream
+	}
+}
+
+func WithPHPFPM(socket string) SiteOptsFunc {
+	return func(o *SiteOpts) {
+		o.PHPFPMSocket = socket
+	}
+}
+
+func WithTLS(certificate string, key string) SiteOptsFunc {
+	return func(o *SiteOpts) {
+		o.TLSCertificate = certificate
+		o.TLSKey = key
+	}
+}
+
+func WithSiteAbsent() SiteOptsFunc {
+	return func(o *SiteOpts) {
+		o.State = SiteAbsent
+	}
+}
+
+// Site renders a virtual host for nginx or Apache, enables it and reloads
+// the web server. The whole configuration is tested first, and a site that
+// fails the test is put back the way it was.
+type Site struct {
+	SiteOpts
+}
+
+func DefaultSiteOpts() SiteOpts {
+	return SiteOpts{
+		State: SiteEnabled,
+	}
+}
+
+func NewNginxSite(serverName string, opts ...SiteOptsFunc) *Site {
+	return newSite(serverName, core.Nginx, opts)
+}
+
+func NewApacheSite(serverName string, opts ...SiteOptsFunc) *Site {
+	return newSite(serverName, core.Apache, opts)
+}
+
+func newSite(serverName string, server core.WebServerKind, opts []SiteOptsFunc) *Site {
+	o := DefaultSiteOpts()
+	o.ServerName = serverName
+	o.Server = server
+	for _, fn := range opts {
+		fn(&o)
+	}
+	if o.Name == "" {
+		o.Name = o.ServerName
+	}
+	return &Site{
+		SiteOpts: o,
+	}
+}
+
+var (
+	siteName = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*$`)
+	// serverName is a host name, optionally with a leading wildcard
+	serverName = regexp.MustCompile(`^(\*\.)?[A-Za-z0-9]([A-Za-z0-9.-]*[A-Za-z0-9])?$`)
+	// sitePath and siteUpstream keep values from breaking out of the
+	// directive they are written into
+	sitePath     = regexp.MustCompile(`^/[^\s;{}<>"'|\\]*$`)
+	siteUpstream = regexp.MustCompile(`^https?://[^\s;{}<>"'|\\]+$`)
+)
+
+func (a Site) Handle(ctx context.Context, ex core.Executor, os core.OS, observer core.ActionObserver) error {
+	return core.WithObserver(observer, func() error {
+		if err := a.validate(); err != nil {
+			return err
+		}
+
+		server := os.WebServer(a.Server)
+		var changed bool
+		var err error
+		if a.State == SiteAbsent {
+			changed, err = a.remove(ctx, ex, server, observer)
+		} else {
+			changed, err = a.ensure(ctx, ex, server, observer)
+		}
+		if err != nil {
+			return err
+		}
+
+		if changed {
+			// A stopped server picks the site up when it is started
+			if state := serviceActiveState(ctx, ex, os, server.Service, observer); state == "active" || core.IsDryRun(ex) {
+				output, err := ex.Execute(ctx, server.Reload(), observer)
+				if err != nil {
+					return fmt.Errorf("failed to reload %s: %w: %s", server.Service, err, strings.TrimSpace(output))
+				}
+			}
+		}
+
+		return core.ReportResult(observer, core.ActionResult{ID: fmt.Sprintf("%s site %s", a.Server, a.Name), Changed: changed})
+	})
+}
+
+func (a Site) validate() error {
+	if !siteName.MatchString(a.Name) {
+		return fmt.Errorf("invalid site name %q", a.Name)
+	}
+	if a.State == SiteAbsent {
+		return nil
+	}
+
+	for _, name := range append([]string{a.ServerName}, a.Aliases...) {
+		if !serverName.MatchString(name) {
+			return fmt.Errorf("invalid server name %q for site %s", name, a.Name)
+		}
+	}
+	for _, value := range []string{a.DocumentRoot, a.PHPFPMSocket, a.TLSCertificate, a.TLSKey} {
+		if value != "" && !sitePath.MatchString(value) {
+			return fmt.Errorf("invalid path %q for site %s: must be absolute without whitespace or quotes", value, a.Name)
+		}
+	}
+	if a.ProxyPass != "" && !siteUpstream.MatchString(a.ProxyPass) {
+		return fmt.Errorf("invalid upstream %q for site %s", a.ProxyPass, a.Name)
+	}
+
+	switch {
+	case a.DocumentRoot == "" && a.ProxyPass == "":
+		return fmt.Errorf("site %s needs a document root or an upstream", a.Name)
+	case a.PHPFPMSocket != "" && a.DocumentRoot == "":
+		return fmt.Errorf("site %s needs a document root for PHP-FPM", a.Name)
+	case (a.TLSCertificate == "") != (a.TLSKey == ""):
+		return fmt.Errorf("site %s needs both a TLS certificate and key", a.Name)
+	}
+	return nil
+}
+
+// ensure writes and enables the site, reporting whether it changed. The
+// previous configuration is kept next to the site until the web server
+// accepts the new one. Apache modules the site needs stay enabled either way.
+func (a Site) ensure(ctx context.Context, ex core.Executor, server core.WebServer, observer core.ActionObserver) (bool, error) {
+	content, err := a.render()
+	if err != nil {
+		return false, err
+	}
+
+	sitePath := server.SitePath(a.Name)
+	current, exists, err := readFile(ctx, ex, sitePath, observer)
+	if err != nil {
+		return false, err
+	}
+	contentChanged := !exists || !bytes.Equal(current, content)
+
+	enabled := true
+	if enabledPath := server.EnabledPath(a.Name); enabledPath != "" {
+		_, err := ex.Execute(ctx, fmt.Sprintf("test -L %s", core.ShellQuote(enabledPath)), observer)
+		enabled = err == nil
+	}
+
+	if !contentChanged && enabled {
+		return false, nil
+	}
+
+	if core.IsDryRun(ex) && observer != nil && contentChanged {
+		if err := observer.OnExecutionOutput(unifiedDiff(sitePath, string(current), string(content))); err != nil {
+			// Log error but continue
+		}
+	}
+
+	quotedPath := core.ShellQuote(sitePath)
+	quotedRollback := core.ShellQuote(sitePath + ".anvil-rollback")
+	rollback := func() {
+		var commands []string
+		switch {
+		case contentChanged && exists:
+			commands = append(commands, fmt.Sprintf("mv -f %s %s", quotedRollback, quotedPath))
+		case contentChanged:
+			commands = append(commands, fmt.Sprintf("rm -f %s", quotedPath))
+		}
+		if !enabled {
+			commands = append(commands, server.DisableSite(a.Name))
+		}
+		for _, command := range commands {
+			if _, cleanupErr := ex.Execute(ctx, command, observer); cleanupErr != nil {
+				// Log error but report the original failure
+			}
+		}
+	}
+
+	if contentChanged {
+		if exists {
+			if _, err := ex.Execute(ctx, fmt.Sprintf("cp -p %s %s", quotedPath, quotedRollback), observer); err != nil {
+				return false, err
+			}
+		} else if _, err := ex.Execute(ctx, fmt.Sprintf("mkdir -p %s", core.ShellQuote(path.Dir(sitePath))), observer); err != nil {
+			return false, err
+		}
+		if err := core.Upload(ctx, ex, content, sitePath, 0o644, observer); err != nil {
+			rollback()
+			return false, err
+		}
+	}
+
+	var commands []string
+	if modules := server.EnableModules(a.modules()...); modules != "" && contentChanged {
+		commands = append(commands, modules)
+	}
+	if !enabled {
+		commands = append(commands, server.EnableSite(a.Name))
+	}
+	for _, command := range commands {
+		if output, err := ex.Execute(ctx, command, observer); err != nil {
+			rollback()
+			return false, fmt.Errorf("failed to enable site %s: %w: %s", a.Name, err, strings.TrimSpace(output))
+		}
+	}
+
+	if output, err := ex.Execute(ctx, server.ConfigTest(), observer); err != nil {
+		rollback()
+		return false, fmt.Errorf("%s configuration test failed, site %s was rolled back: %w: %s", a.Server, a.Name, err, strings.TrimSpace(output))
+	}
+
+	if contentChanged && exists {
+		if _, cleanupErr := ex.Execute(ctx, fmt.Sprintf("rm -f %s", quotedRollback), observer); cleanupErr != nil {
+			// Log error but keep the new configuration
+		}
+	}
+	return true, nil
+}
+
+// remove disables the site and removes its configuration
+func (a Site) remove(ctx context.Context, ex core.Executor, server core.WebServer, observer core.ActionObserver) (bool, error) {
+	changed := false
+	if enabledPath := server.EnabledPath(a.Name); enabledPath != "" {
+		if _, err := ex.Execute(ctx, fmt.Sprintf("test -L %s", core.ShellQuote(enabledPath)), observer); err == nil {
+			output, err := ex.Execute(ctx, server.DisableSite(a.Name), observer)
+			if err != nil {
+				return false, fmt.Errorf("failed to disable site %s: %w: %s", a.Name, err, strings.TrimSpace(output))
+			}
+			changed = true
+		}
+	}
+
+	removed, err := removeFile(ctx, ex, server.SitePath(a.Name), observer)
+	if err != nil {
+		return false, err
+	}
+	return changed || removed, nil
+}
+
+// modules returns the Apache modules the site's directives need
+func (a Site) modules() []string {
+	var modules []string
+	if a.TLSCertificate != "" {
+		modules = append(modules, "ssl")
+	}
+	if a.PHPFPMSocket != "" {
+		modules = append(modules, "proxy_fcgi")
+	}
+	if a.ProxyPass != "" {
+		modules = append(modules, "proxy_http")
+	}
+	return modules
+}
+
+func (a Site) render() ([]byte, error) {
+	tmpl := nginxSite
+	if a.Server == core.Apache {
+		tmpl = apacheSite
+	}
+
+	// Apache only maps a ProxyPass path onto an upstream path ending in /
+	upstream := a.ProxyPass
+	if a.Server == core.Apache && upstream != "" && !strings.HasSuffix(upstream, "/") {
+		upstream += "/"
+	}
+
+	var b bytes.Buffer
+	err := tmpl.Execute(&b, struct {
+		SiteOpts
+		ServerNames string
+		Upstream    string
+	}{a.SiteOpts, strings.Join(append([]string{a.ServerName}, a.Aliases...), " "), upstream})
+	if err != nil {
+		return nil, fmt.Errorf("failed to render site %s: %w", a.Name, err)
+	}
+	return b.Bytes(), nil
+}
+
+var nginxSite = template.Must(template.New("nginx").Parse(`# Managed by anvil
+{{- if .TLSCertificate}}
+server {
+    listen 80;
+    listen [::]:80;
+    server_name {{.ServerNames}};
+    return 301 https://$host$request_uri;
+}
+{{end}}
+server {
+{{- if .TLSCertificate}}
+    listen 443 ssl;
+    listen [::]:443 ssl;
+    server_name {{.ServerNames}};
+    ssl_certificate {{.TLSCertificate}};
+    ssl_certificate_key {{.TLSKey}};
+{{- else}}
+    listen 80;
+    listen [::]:80;
+    server_name {{.ServerNames}};
+{{- end}}
+{{- if .DocumentRoot}}
+    root {{.DocumentRoot}};
+    index {{if .PHPFPMSocket}}index.php {{end}}index.html;
+{{- end}}
+{{- if .ProxyPass}}
+
+    location / {
+        proxy_pass {{.Upstream}};
+        proxy_set_header Host $host;
+        proxy_set_header X-Real-IP $remote_addr;
+        proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+        proxy_set_header X-Forwarded-Proto $scheme;
+    }
+{{- else if .PHPFPMSocket}}
+
+    location / {
+        try_files $uri $uri/ /index.php?$query_string;
+    }
+
+    location ~ \.php$ {
+        try_files $uri =404;
+        include fastcgi_params;
+        fastcgi_param SCRIPT_FILENAME $document_root$fastcgi_script_name;
+        fastcgi_pass unix:{{.PHPFPMSocket}};
+    }
+{{- else}}
+
+    location / {
+        try_files $uri $uri/ =404;
+    }
+{{- end}}
+}
+`))
+
+var apacheSite = template.Must(template.New("apache").Parse(`# Managed by anvil
+{{- define "names"}}
+    ServerName {{.ServerName}}
+{{- if .Aliases}}
+    ServerAlias{{range .Aliases}} {{.}}{{end}}
+{{- end}}
+{{- end}}
+{{- if .TLSCertificate}}
+<VirtualHost *:80>
+{{- template "names" .}}
+    Redirect permanent / https://{{.ServerName}}/
+</VirtualHost>
+
+<VirtualHost *:443>
+{{- template "names" .}}
+    SSLEngine on
+    SSLCertificateFile {{.TLSCertificate}}
+    SSLCertificateKeyFile {{.TLSKey}}
+{{- else}}
+<VirtualHost *:80>
+{{- template "names" .}}
+{{- end}}
+{{- if .DocumentRoot}}
+    DocumentRoot {{.DocumentRoot}}
+
+    <Directory {{.DocumentRoot}}>
+        Options FollowSymLinks
+        AllowOverride All
+        Require all granted
+    </Directory>
+{{- end}}
+{{- if .PHPFPMSocket}}
+
+    <FilesMatch "\.php$">
+        SetHandler "proxy:unix:{{.PHPFPMSocket}}|fcgi://localhost"
+    </FilesMatch>
+{{- end}}
+{{- if .ProxyPass}}
+
+    ProxyPreserveHost On
+    ProxyPass / {{.Upstream}}
+    ProxyPassReverse / {{.Upstream}}
+{{- end}}
+</VirtualHost>
+`))
+
+var _ core.Action = (*Site)(nil)
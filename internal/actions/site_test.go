@@ -0,0 +1,157 @@
+package actions
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+func Test_Site_NginxCreate(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			"test -L /etc/nginx/sites-enabled/example.com.conf": {Err: errors.New("exit status 1")},
+			"systemctl is-active nginx":                         {Output: "active\n"},
+		},
+	}
+	observer := &resultRecorder{}
+	action := NewNginxSite("example.com", WithServerAliases("www.example.com"), WithDocumentRoot("/var/www/app/public"), WithPHPFPM("/run/php/php8.3-fpm.sock"))
+
+	if err := action.Handle(t.Context(), ex, core.Ubuntu{}, observer); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	content := string(ex.Files["/etc/nginx/sites-available/example.com.conf"])
+	for _, directive := range []string{"server_name example.com www.example.com;", "root /var/www/app/public;", "fastcgi_pass unix:/run/php/php8.3-fpm.sock;"} {
+		if !strings.Contains(content, directive) {
+			t.Errorf("expected %q in site:\n%s", directive, content)
+		}
+	}
+	for _, command := range []string{
+		"ln -sfn /etc/nginx/sites-available/example.com.conf /etc/nginx/sites-enabled/example.com.conf",
+		"nginx -t",
+		"systemctl reload nginx",
+	} {
+		if !ex.Executed(command) {
+			t.Errorf("expected %q to be executed: %v", command, ex.History)
+		}
+	}
+	if len(observer.Results) != 1 || observer.Results[0].ID != "nginx site example.com" || !observer.Results[0].Changed {
+		t.Errorf("unexpected results: %v", observer.Results)
+	}
+}
+
+func Test_Site_Unchanged(t *testing.T) {
+	action := NewNginxSite("api.example.com", WithProxyPass("http://127.0.0.1:3000"))
+	content, err := action.render()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ex := &core.FakeExecutor{
+		Files: map[string][]byte{"/etc/nginx/conf.d/api.example.com.conf": content},
+	}
+	observer := &resultRecorder{}
+
+	if err := action.Handle(t.Context(), ex, core.Fedora{}, observer); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if ex.Executed("nginx -t") || ex.Executed("systemctl reload nginx") {
+		t.Errorf("expected no test or reload: %v", ex.History)
+	}
+	if len(observer.Results) != 1 || observer.Results[0].Changed {
+		t.Errorf("expected an unchanged result, got %v", observer.Results)
+	}
+}
+
+func Test_Site_RollsBackChangedSite(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Files: map[string][]byte{"/etc/apache2/sites-available/example.com.conf": []byte("# previous\n")},
+		Responses: map[string]core.FakeResponse{
+			"apachectl configtest": {Output: "AH00526: Syntax error on line 12\n", Err: errors.New("exit status 1")},
+		},
+	}
+	action := NewApacheSite("example.com", WithDocumentRoot("/var/www/app"), WithTLS("/etc/ssl/certs/example.pem", "/etc/ssl/private/example.key"))
+
+	err := action.Handle(t.Context(), ex, core.Debian{}, nil)
+	if err == nil || !strings.Contains(err.Error(), "rolled back") || !strings.Contains(err.Error(), "AH00526") {
+		t.Fatalf("expected a rollback error, got %v", err)
+	}
+
+	for _, command := range []string{
+		"cp -p /etc/apache2/sites-available/example.com.conf /etc/apache2/sites-available/example.com.conf.anvil-rollback",
+		"a2enmod -q ssl",
+		"mv -f /etc/apache2/sites-available/example.com.conf.anvil-rollback /etc/apache2/sites-available/example.com.conf",
+	} {
+		if !ex.Executed(command) {
+			t.Errorf("expected %q to be executed: %v", command, ex.History)
+		}
+	}
+	if ex.Executed("a2dissite -q example.com") || ex.Executed("systemctl reload apache2") {
+		t.Errorf("expected the enabled site to stay enabled and apache not to reload: %v", ex.History)
+	}
+}
+
+func Test_Site_RollsBackNewSite(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			"test -L /etc/nginx/sites-enabled/shop.conf": {Err: errors.New("exit status 1")},
+			"nginx -t": {Output: "nginx: [emerg] duplicate listen options\n", Err: errors.New("exit status 1")},
+		},
+	}
+
+	err := NewNginxSite("shop.example.com", WithSiteName("shop"), WithDocumentRoot("/var/www/shop")).Handle(t.Context(), ex, core.Ubuntu{}, nil)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	for _, command := range []string{
+		"rm -f /etc/nginx/sites-available/shop.conf",
+		"rm -f /etc/nginx/sites-enabled/shop.conf",
+	} {
+		if !ex.Executed(command) {
+			t.Errorf("expected %q to be executed: %v", command, ex.History)
+		}
+	}
+}
+
+func Test_Site_Absent(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Files: map[string][]byte{"/etc/apache2/sites-available/old.conf": []byte("# old\n")},
+		Responses: map[string]core.FakeResponse{
+			"systemctl is-active apache2": {Output: "inactive\n"},
+		},
+	}
+	observer := &resultRecorder{}
+
+	if err := NewApacheSite("old.example.com", WithSiteName("old"), WithSiteAbsent()).Handle(t.Context(), ex, core.Ubuntu{}, observer); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !ex.Executed("a2dissite -q old") || !ex.Executed("rm -f /etc/apache2/sites-available/old.conf") {
+		t.Errorf("expected the site to be disabled and removed: %v", ex.History)
+	}
+	if ex.Executed("systemctl reload apache2") {
+		t.Errorf("expected a stopped server not to be reloaded: %v", ex.History)
+	}
+	if len(observer.Results) != 1 || !observer.Results[0].Changed {
+		t.Errorf("expected a changed result, got %v", observer.Results)
+	}
+}
+
+func Test_Site_Invalid(t *testing.T) {
+	tests := map[string]*Site{
+		"no root or upstream":  NewNginxSite("example.com"),
+		"directive injection":  NewNginxSite("example.com", WithDocumentRoot("/var/www; include /etc/shadow")),
+		"server name":          NewApacheSite("example.com\nInclude /etc", WithDocumentRoot("/var/www")),
+		"certificate only":     NewNginxSite("example.com", WithDocumentRoot("/var/www"), WithTLS("/etc/ssl/cert.pem", "")),
+		"php without root":     NewNginxSite("example.com", WithProxyPass("http://127.0.0.1:3000"), WithPHPFPM("/run/php/fpm.sock")),
+		"upstream with spaces": NewNginxSite("example.com", WithProxyPass("http://127.0.0.1:3000 backup")),
+	}
+	for name, action := range tests {
+		if err := action.Handle(t.Context(), &core.FakeExecutor{}, core.Ubuntu{}, nil); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
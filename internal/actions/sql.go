@@ -0,0 +1,129 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+// DatabaseEngine is the database server an action talks to
+type DatabaseEngine int
+
+const (
+	// MySQL covers MySQL and MariaDB, reached as root through the mysql
+	// client, which logs in through the unix socket or /root/.my.cnf
+	MySQL DatabaseEngine = iota
+	// PostgreSQL is reached through psql as the postgres user
+	PostgreSQL
+)
+
+func (e DatabaseEngine) String() string {
+	if e == PostgreSQL {
+		return "postgresql"
+	}
+	return "mysql"
+}
+
+// sqlStagingDir holds SQL scripts while they run. It is on a tmpfs and only
+// readable by root, as scripts can contain passwords.
+const sqlStagingDir = "/run/anvil"
+
+// queryCommand returns the command that runs a single query and prints its
+// rows with tab separated fields and no headers
+func (e DatabaseEngine) queryCommand(query string) string {
+	if e == PostgreSQL {
+		return fmt.Sprintf("cd / && runuser -u postgres -- psql -X -q -A -t -F %s -v ON_ERROR_STOP=1 -d postgres -c %s", core.ShellQuote("\t"), core.ShellQuote(query))
+	}
+	return fmt.Sprintf("mysql -N -B -e %s", core.ShellQuote(query))
+}
+
+// scriptCommand returns the command that runs the SQL script at path
+func (e DatabaseEngine) scriptCommand(path string) string {
+	if e == PostgreSQL {
+		return fmt.Sprintf("cd / && runuser -u postgres -- psql -X -q -v ON_ERROR_STOP=1 -d postgres < %s", core.ShellQuote(path))
+	}
+	return fmt.Sprintf("mysql < %s", core.ShellQuote(path))
+}
+
+// quoteIdent quotes a database, user or role name
+func (e DatabaseEngine) quoteIdent(name string) string {
+	if e == PostgreSQL {
+		return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+	}
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// quoteString quotes a string literal. PostgreSQL has treated backslashes
+// literally since standard_conforming_strings became the default.
+func (e DatabaseEngine) quoteString(s string) string {
+	if e == PostgreSQL {
+		return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", "''").Replace(s) + "'"
+}
+
+// maskSecrets hides secrets in output, also where they appear quoted, as
+// servers quote the statement they fail on
+func (e DatabaseEngine) maskSecrets(output string, secrets []string) string {
+	for _, secret := range secrets {
+		if secret == "" {
+			continue
+		}
+		quoted := e.quoteString(secret)
+		for _, form := range []string{quoted, quoted[1 : len(quoted)-1], secret} {
+			output = strings.ReplaceAll(output, form, "********")
+		}
+	}
+	return output
+}
+
+// sqlQuery runs query and returns its rows, reporting false if they are
+// unknown because nothing is executed in a dry run
+func sqlQuery(ctx context.Context, ex core.Executor, engine DatabaseEngine, query string, observer core.ActionObserver) ([][]string, bool, error) {
+	output, err := ex.Execute(ctx, engine.queryCommand(query), observer)
+	if err != nil {
+		return nil, false, fmt.Errorf("%s query failed: %w: %s", engine, err, strings.TrimSpace(output))
+	}
+	if core.IsDryRun(ex) {
+		return nil, false, nil
+	}
+
+	var rows [][]string
+	for _, line := range strings.Split(strings.TrimRight(output, "\n"), "\n") {
+		if line != "" {
+			rows = append(rows, strings.Split(line, "\t"))
+		}
+	}
+	return rows, true, nil
+}
+
+// sqlApply runs statements as a script uploaded to the target, so that
+// passwords never show up in the process list or in the commands reported to
+// the observer. secrets are masked in the error returned.
+func sqlApply(ctx context.Context, ex core.Executor, engine DatabaseEngine, name string, statements []string, observer core.ActionObserver, secrets ...string) error {
+	if _, err := ex.Execute(ctx, fmt.Sprintf("install -d -m 700 %s", sqlStagingDir), observer); err != nil {
+		return err
+	}
+
+	path := fmt.Sprintf("%s/%s.sql", sqlStagingDir, strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, name))
+	script := strings.Join(statements, ";\n") + ";\n"
+	if err := core.Upload(ctx, ex, []byte(script), path, 0o600, observer); err != nil {
+		return err
+	}
+
+	// The script is removed by the same command, whether it succeeds or not
+	command := fmt.Sprintf("%s; status=$?; rm -f %s; exit $status", engine.scriptCommand(path), core.ShellQuote(path))
+	output, err := ex.Execute(ctx, command, observer)
+	if err != nil {
+		output = engine.maskSecrets(strings.TrimSpace(output), secrets)
+		return fmt.Errorf("failed to apply %s changes for %s: %w: %s", engine, name, err, output)
+	}
+	return nil
+}
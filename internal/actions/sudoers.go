@@ -0,0 +1,179 @@
+package actions
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+// SudoRule is a single sudoers user specification. Empty Hosts, RunAs and
+// Commands default to ALL.
+type SudoRule struct {
+	Users      []string
+	Groups     []string
+	Hosts      []string
+	RunAs      []string
+	Commands   []string
+	NoPassword bool
+}
+
+// String renders the rule as a sudoers line, e.g.
+// deploy ALL=(root) NOPASSWD: /usr/bin/systemctl restart app
+func (r SudoRule) String() string {
+	principals := append([]string(nil), r.Users...)
+	for _, group := range r.Groups {
+		principals = append(principals, "%"+group)
+	}
+
+	line := fmt.Sprintf("%s %s=(%s) ", strings.Join(principals, ","), orAll(r.Hosts, ","), orAll(r.RunAs, ","))
+	if r.NoPassword {
+		line += "NOPASSWD: "
+	}
+	return line + orAll(r.Commands, ", ")
+}
+
+func orAll(values []string, sep string) string {
+	if len(values) == 0 {
+		return "ALL"
+	}
+	return strings.Join(values, sep)
+}
+
+// SudoersState is the desired state of a sudoers drop-in
+type SudoersState int
+
+const (
+	SudoersPresent SudoersState = iota
+	SudoersAbsent
+)
+
+type SudoersOpts struct {
+	Name  string
+	Rules []SudoRule
+	State SudoersState
+}
+
+type SudoersOptsFunc func(*SudoersOpts)
+
+func WithSudoRule(rule SudoRule) SudoersOptsFunc {
+	return func(o *SudoersOpts) {
+		o.Rules = append(o.Rules, rule)
+	}
+}
+
+func WithSudoersAbsent() SudoersOptsFunc {
+	return func(o *SudoersOpts) {
+		o.State = SudoersAbsent
+	}
+}
+
+// Sudoers manages a drop-in file in /etc/sudoers.d. New content is checked
+// with visudo on the target before it replaces the live file, so an invalid
+// rule is never installed.
+type Sudoers struct {
+	SudoersOpts
+}
+
+func DefaultSudoersOpts() SudoersOpts {
+	return SudoersOpts{
+		State: SudoersPresent,
+	}
+}
+
+func NewSudoers(name string, opts ...SudoersOptsFunc) *Sudoers {
+	o := DefaultSudoersOpts()
+	o.Name = name
+	for _, fn := range opts {
+		fn(&o)
+	}
+	return &Sudoers{
+		SudoersOpts: o,
+	}
+}
+
+func (a Sudoers) Path() string {
+	return path.Join("/etc/sudoers.d", a.Name)
+}
+
+func (a Sudoers) Handle(ctx context.Context, ex core.Executor, os core.OS, observer core.ActionObserver) error {
+	return core.WithObserver(observer, func() error {
+		if err := a.validate(); err != nil {
+			return err
+		}
+
+		var changed bool
+		var err error
+		if a.State == SudoersAbsent {
+			changed, err = removeFile(ctx, ex, a.Path(), observer)
+		} else {
+			changed, err = a.install(ctx, ex, observer)
+		}
+		if err != nil {
+			return err
+		}
+
+		return core.ReportResult(observer, core.ActionResult{ID: "sudoers " + a.Name, Changed: changed})
+	})
+}
+
+// validate rejects names that sudo would silently ignore and rules without
+// anyone to apply to
+func (a Sudoers) validate() error {
+	if a.Name == "" || strings.ContainsAny(a.Name, "./") || strings.HasSuffix(a.Name, "~") {
+		return fmt.Errorf("invalid sudoers name %q: must not be empty or contain '.' or '/'", a.Name)
+	}
+	for _, rule := range a.Rules {
+		if len(rule.Users) == 0 && len(rule.Groups) == 0 {
+			return fmt.Errorf("sudoers %s: rule %q has no users or groups", a.Name, rule)
+		}
+	}
+	return nil
+}
+
+func (a Sudoers) render() []byte {
+	var b bytes.Buffer
+	b.WriteString("# Managed by anvil\n")
+	for _, rule := range a.Rules {
+		b.WriteString(rule.String())
+		b.WriteString("\n")
+	}
+	return b.Bytes()
+}
+
+// install uploads the new content next to the live file under a name sudo
+// ignores, validates it and only then moves it into place
+func (a Sudoers) install(ctx context.Context, ex core.Executor, observer core.ActionObserver) (bool, error) {
+	content := a.render()
+	current, exists, err := readFile(ctx, ex, a.Path(), observer)
+	if err != nil {
+		return false, err
+	}
+	if exists && bytes.Equal(current, content) {
+		return false, nil
+	}
+
+	staging := path.Join("/etc/sudoers.d", "."+a.Name+".anvil")
+	if err := core.Upload(ctx, ex, content, staging, 0o440, observer); err != nil {
+		return false, err
+	}
+
+	output, err := ex.Execute(ctx, fmt.Sprintf("visudo -cf %s", core.ShellQuote(staging)), observer)
+	if err != nil {
+		if _, cleanupErr := ex.Execute(ctx, fmt.Sprintf("rm -f %s", core.ShellQuote(staging)), observer); cleanupErr != nil {
+			// Log error but report the validation failure
+		}
+		return false, fmt.Errorf("sudoers %s failed validation, not installed: %w: %s", a.Name, err, strings.TrimSpace(output))
+	}
+
+	_, err = ex.Execute(ctx, fmt.Sprintf("chown root:root %s && mv -f %s %s", core.ShellQuote(staging), core.ShellQuote(staging), core.ShellQuote(a.Path())), observer)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+var _ core.Action = (*Sudoers)(nil)
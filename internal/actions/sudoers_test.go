@@ -0,0 +1,81 @@
+package actions
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+func Test_Sudoers(t *testing.T) {
+	ex := &core.FakeExecutor{}
+	action := NewSudoers("deploy", WithSudoRule(SudoRule{
+		Users:      []string{"deploy"},
+		RunAs:      []string{"root"},
+		Commands:   []string{"/usr/bin/systemctl restart app", "/usr/bin/journalctl"},
+		NoPassword: true,
+	}))
+
+	if err := action.Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "# Managed by anvil\ndeploy ALL=(root) NOPASSWD: /usr/bin/systemctl restart app, /usr/bin/journalctl\n"
+	if content := string(ex.Files["/etc/sudoers.d/.deploy.anvil"]); content != expected {
+		t.Errorf("unexpected sudoers content:\n%s", content)
+	}
+
+	if !ex.Executed("visudo -cf /etc/sudoers.d/.deploy.anvil") {
+		t.Error("did not validate sudoers file")
+	}
+
+	if !ex.Executed("chown root:root /etc/sudoers.d/.deploy.anvil && mv -f /etc/sudoers.d/.deploy.anvil /etc/sudoers.d/deploy") {
+		t.Errorf("did not move validated file into place: %v", ex.History)
+	}
+}
+
+func Test_Sudoers_InvalidNotInstalled(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			"visudo -cf /etc/sudoers.d/.ops.anvil": {Output: "syntax error near line 2", Err: errors.New("exit status 1")},
+		},
+	}
+	action := NewSudoers("ops", WithSudoRule(SudoRule{Groups: []string{"ops"}, Commands: []string{"/usr/bin/reboot"}}))
+
+	if err := action.Handle(t.Context(), ex, core.Ubuntu{}, nil); err == nil {
+		t.Fatal("expected error for a sudoers file that fails validation")
+	}
+
+	for _, command := range ex.History {
+		if command == "chown root:root /etc/sudoers.d/.ops.anvil && mv -f /etc/sudoers.d/.ops.anvil /etc/sudoers.d/ops" {
+			t.Fatal("should not install a sudoers file that fails validation")
+		}
+	}
+
+	if !ex.Executed("rm -f /etc/sudoers.d/.ops.anvil") {
+		t.Error("did not clean up the rejected file")
+	}
+}
+
+func Test_Sudoers_Unchanged(t *testing.T) {
+	action := NewSudoers("deploy", WithSudoRule(SudoRule{Users: []string{"deploy"}}))
+	ex := &core.FakeExecutor{
+		Files: map[string][]byte{"/etc/sudoers.d/deploy": []byte("# Managed by anvil\ndeploy ALL=(ALL) ALL\n")},
+	}
+
+	if err := action.Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if ex.Uploaded("/etc/sudoers.d/.deploy.anvil") {
+		t.Error("should not upload a sudoers file that is unchanged")
+	}
+}
+
+func Test_Sudoers_RejectsIgnoredName(t *testing.T) {
+	action := NewSudoers("deploy.conf", WithSudoRule(SudoRule{Users: []string{"deploy"}}))
+
+	if err := action.Handle(t.Context(), &core.FakeExecutor{}, core.Ubuntu{}, nil); err == nil {
+		t.Error("expected error for a name sudo would ignore")
+	}
+}
@@ -0,0 +1,169 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+// SwapState is the desired state of a swapfile
+type SwapState int
+
+const (
+	SwapEnabled SwapState = iota
+	SwapAbsent
+)
+
+type SwapfileOpts struct {
+	Path string
+	// SizeMiB is the size of the swapfile in MiB
+	SizeMiB int
+	State   SwapState
+}
+
+type SwapfileOptsFunc func(*SwapfileOpts)
+
+func WithSwapfilePath(path string) SwapfileOptsFunc {
+	return func(o *SwapfileOpts) {
+		o.Path = path
+	}
+}
+
+func WithSwapfileAbsent() SwapfileOptsFunc {
+	return func(o *SwapfileOpts) {
+		o.State = SwapAbsent
+	}
+}
+
+// Swapfile creates a swapfile of a given size, enables it and adds it to
+// /etc/fstab. A swapfile of the wrong size is recreated.
+type Swapfile struct {
+	SwapfileOpts
+}
+
+func DefaultSwapfileOpts() SwapfileOpts {
+	return SwapfileOpts{
+		Path:  "/swapfile",
+		State: SwapEnabled,
+	}
+}
+
+func NewSwapfile(sizeMiB int, opts ...SwapfileOptsFunc) *Swapfile {
+	o := DefaultSwapfileOpts()
+	o.SizeMiB = sizeMiB
+	for _, fn := range opts {
+		fn(&o)
+	}
+	return &Swapfile{
+		SwapfileOpts: o,
+	}
+}
+
+func (a Swapfile) Handle(ctx context.Context, ex core.Executor, os core.OS, observer core.ActionObserver) error {
+	return core.WithObserver(observer, func() error {
+		if !strings.HasPrefix(a.Path, "/") {
+			return fmt.Errorf("invalid swapfile %q: must be an absolute path", a.Path)
+		}
+		if a.State == SwapEnabled && a.SizeMiB <= 0 {
+			return fmt.Errorf("invalid size %d MiB for swapfile %s", a.SizeMiB, a.Path)
+		}
+
+		path := core.ShellQuote(a.Path)
+		active := a.active(ctx, ex, observer)
+
+		var commands []string
+		var fstabChanged bool
+		var err error
+		if a.State == SwapAbsent {
+			if active {
+				commands = append(commands, fmt.Sprintf("swapoff %s", path))
+			}
+			fstabChanged, err = removeFstabEntry(ctx, ex, a.matches, observer)
+			if err != nil {
+				return err
+			}
+			if _, exists := a.size(ctx, ex, observer); exists {
+				commands = append(commands, fmt.Sprintf("rm -f %s", path))
+			}
+		} else {
+			size, exists := a.size(ctx, ex, observer)
+			if !exists || size != int64(a.SizeMiB)*1024*1024 {
+				if active {
+					commands = append(commands, fmt.Sprintf("swapoff %s", path))
+				}
+				// dd rather than fallocate, as swapon refuses files with
+				// holes on some filesystems
+				commands = append(commands, fmt.Sprintf("rm -f %s && dd if=/dev/zero of=%s bs=1M count=%d status=none && chmod 600 %s && mkswap %s", path, path, a.SizeMiB, path, path))
+				active = false
+			} else if !active && !a.formatted(ctx, ex, observer) {
+				// A run that died before mkswap, or a file that was never
+				// swap, would otherwise fail swapon on every run
+				commands = append(commands, fmt.Sprintf("chmod 600 %s && mkswap %s", path, path))
+			}
+			if !active {
+				commands = append(commands, fmt.Sprintf("swapon %s", path))
+			}
+		}
+
+		for _, command := range commands {
+			output, err := ex.Execute(ctx, command, observer)
+			if err != nil {
+				return fmt.Errorf("failed to change swapfile %s: %w: %s", a.Path, err, strings.TrimSpace(output))
+			}
+		}
+
+		if a.State == SwapEnabled {
+			line := strings.Join([]string{fstabEscape(a.Path), "none", "swap", "sw", "0", "0"}, "\t")
+			fstabChanged, err = ensureFstabEntry(ctx, ex, line, a.matches, observer)
+			if err != nil {
+				return err
+			}
+		}
+
+		return core.ReportResult(observer, core.ActionResult{ID: "swapfile " + a.Path, Changed: fstabChanged || len(commands) > 0})
+	})
+}
+
+// active reports whether swapon --show lists the swapfile
+func (a Swapfile) active(ctx context.Context, ex core.Executor, observer core.ActionObserver) bool {
+	output, err := ex.Execute(ctx, "swapon --show=NAME --noheadings", observer)
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(output, "\n") {
+		if strings.TrimSpace(line) == a.Path {
+			return true
+		}
+	}
+	return false
+}
+
+// size returns the size of the swapfile in bytes, reporting false if it
+// doesn't exist
+func (a Swapfile) size(ctx context.Context, ex core.Executor, observer core.ActionObserver) (int64, bool) {
+	output, err := ex.Execute(ctx, fmt.Sprintf("stat -c %%s %s", core.ShellQuote(a.Path)), observer)
+	if err != nil {
+		return 0, false
+	}
+	size, err := strconv.ParseInt(strings.TrimSpace(output), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return size, true
+}
+
+// formatted reports whether the swapfile has a swap signature
+func (a Swapfile) formatted(ctx context.Context, ex core.Executor, observer core.ActionObserver) bool {
+	output, err := ex.Execute(ctx, fmt.Sprintf("blkid -p -s TYPE -o value %s", core.ShellQuote(a.Path)), observer)
+	return err == nil && strings.TrimSpace(output) == "swap"
+}
+
+// matches reports whether fields of an /etc/fstab line are for the swapfile
+func (a Swapfile) matches(fields []string) bool {
+	return fstabUnescape(fields[0]) == a.Path
+}
+
+var _ core.Action = (*Swapfile)(nil)
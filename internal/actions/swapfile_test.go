@@ -0,0 +1,97 @@
+package actions
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+func Test_Swapfile(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Files: map[string][]byte{"/etc/fstab": []byte(baseFstab)},
+		Responses: map[string]core.FakeResponse{
+			"stat -c %s /swapfile": {Output: "stat: cannot statx '/swapfile': No such file or directory", Err: errors.New("exit status 1")},
+		},
+	}
+
+	if err := NewSwapfile(2048).Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, command := range []string{
+		"rm -f /swapfile && dd if=/dev/zero of=/swapfile bs=1M count=2048 status=none && chmod 600 /swapfile && mkswap /swapfile",
+		"swapon /swapfile",
+	} {
+		if !ex.Executed(command) {
+			t.Errorf("expected %q, got %v", command, ex.History)
+		}
+	}
+	if content := string(ex.Files["/etc/.fstab.anvil"]); content != baseFstab+"/swapfile\tnone\tswap\tsw\t0\t0\n" {
+		t.Errorf("unexpected fstab:\n%s", content)
+	}
+}
+
+func Test_Swapfile_Unchanged(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Files: map[string][]byte{"/etc/fstab": []byte(baseFstab + "/swapfile none swap sw 0 0\n")},
+		Responses: map[string]core.FakeResponse{
+			"swapon --show=NAME --noheadings": {Output: "/swapfile\n"},
+			"stat -c %s /swapfile":            {Output: "1073741824\n"},
+		},
+	}
+	observer := &resultRecorder{}
+
+	if err := NewSwapfile(1024).Handle(t.Context(), ex, core.Ubuntu{}, observer); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(observer.Results) != 1 || observer.Results[0].Changed {
+		t.Errorf("expected a single unchanged result, got %v: %v", observer.Results, ex.History)
+	}
+}
+
+func Test_Swapfile_Unformatted(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Files: map[string][]byte{"/etc/fstab": []byte("/swapfile none swap sw 0 0\n")},
+		Responses: map[string]core.FakeResponse{
+			"stat -c %s /swapfile":                {Output: "1073741824\n"},
+			"blkid -p -s TYPE -o value /swapfile": {Err: errors.New("exit status 2")},
+		},
+	}
+
+	if err := NewSwapfile(1024).Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, command := range []string{"chmod 600 /swapfile && mkswap /swapfile", "swapon /swapfile"} {
+		if !ex.Executed(command) {
+			t.Errorf("expected %q, got %v", command, ex.History)
+		}
+	}
+}
+
+func Test_Swapfile_Resize(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Files: map[string][]byte{"/etc/fstab": []byte("/swapfile none swap sw 0 0\n")},
+		Responses: map[string]core.FakeResponse{
+			"swapon --show=NAME --noheadings": {Output: "/swapfile\n"},
+			"stat -c %s /swapfile":            {Output: "1073741824\n"},
+		},
+	}
+
+	if err := NewSwapfile(4096).Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{
+		"swapoff /swapfile",
+		"rm -f /swapfile && dd if=/dev/zero of=/swapfile bs=1M count=4096 status=none && chmod 600 /swapfile && mkswap /swapfile",
+		"swapon /swapfile",
+	}
+	for _, command := range expected {
+		if !ex.Executed(command) {
+			t.Errorf("expected %q, got %v", command, ex.History)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package actions
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+// SysctlValue is a kernel parameter such as net.core.somaxconn and the value
+// it should have
+type SysctlValue struct {
+	Key   string
+	Value string
+}
+
+// SysctlState is the desired state of a sysctl.d file
+type SysctlState int
+
+const (
+	SysctlPresent SysctlState = iota
+	SysctlAbsent
+)
+
+type SysctlOpts struct {
+	// Name is the name of the file in /etc/sysctl.d, without .conf
+	Name   string
+	Values []SysctlValue
+	State  SysctlState
+}
+
+type SysctlOptsFunc func(*SysctlOpts)
+
+func WithSysctlValue(key string, value string) SysctlOptsFunc {
+	return func(o *SysctlOpts) {
+		o.Values = append(o.Values, SysctlValue{Key: key, Value: value})
+	}
+}
+
+// WithSysctlAbsent removes the file. The kernel keeps the values it set until
+// the next boot.
+func WithSysctlAbsent() SysctlOptsFunc {
+	return func(o *SysctlOpts) {
+		o.State = SysctlAbsent
+	}
+}
+
+// Sysctl persists kernel parameters in /etc/sysctl.d and applies them to the
+// running kernel when the file changed or a live value in /proc/sys differs
+type Sysctl struct {
+	SysctlOpts
+}
+
+func DefaultSysctlOpts() SysctlOpts {
+	return SysctlOpts{
+		State: SysctlPresent,
+	}
+}
+
+func NewSysctl(name string, opts ...SysctlOptsFunc) *Sysctl {
+	o := DefaultSysctlOpts()
+	o.Name = name
+	for _, fn := range opts {
+		fn(&o)
+	}
+	return &Sysctl{
+		SysctlOpts: o,
+	}
+}
+
+func (a Sysctl) Path() string {
+	return path.Join("/etc/sysctl.d", a.Name+".conf")
+}
+
+var sysctlKey = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.:/-]*$`)
+
+func (a Sysctl) Handle(ctx context.Context, ex core.Executor, os core.OS, observer core.ActionObserver) error {
+	return core.WithObserver(observer, func() error {
+		if a.Name == "" || strings.Contains(a.Name, "/") {
+			return fmt.Errorf("invalid sysctl name %q: must not be empty or contain '/'", a.Name)
+		}
+
+		if a.State == SysctlAbsent {
+			changed, err := removeFile(ctx, ex, a.Path(), observer)
+			if err != nil {
+				return err
+			}
+			return core.ReportResult(observer, core.ActionResult{ID: "sysctl " + a.Name, Changed: changed})
+		}
+
+		var b bytes.Buffer
+		b.WriteString("# Managed by anvil\n")
+		for _, value := range a.Values {
+			if !sysctlKey.MatchString(value.Key) || strings.ContainsAny(value.Value, "\n") {
+				return fmt.Errorf("invalid sysctl %s = %q", value.Key, value.Value)
+			}
+			fmt.Fprintf(&b, "%s = %s\n", value.Key, value.Value)
+		}
+
+		changed, err := ensureFile(ctx, ex, a.Path(), b.Bytes(), 0o644, observer)
+		if err != nil {
+			return err
+		}
+
+		if !changed {
+			for _, value := range a.Values {
+				if !a.live(ctx, ex, value, observer) {
+					changed = true
+					break
+				}
+			}
+		}
+
+		if changed {
+			output, err := ex.Execute(ctx, fmt.Sprintf("sysctl -p %s", core.ShellQuote(a.Path())), observer)
+			if err != nil {
+				return fmt.Errorf("failed to apply %s: %w: %s", a.Path(), err, strings.TrimSpace(output))
+			}
+		}
+
+		return core.ReportResult(observer, core.ActionResult{ID: "sysctl " + a.Name, Changed: changed})
+	})
+}
+
+// live reports whether the running kernel already has the value. Multi-value
+// parameters such as net.ipv4.tcp_rmem compare field by field, as /proc/sys
+// separates them with tabs.
+func (a Sysctl) live(ctx context.Context, ex core.Executor, value SysctlValue, observer core.ActionObserver) bool {
+	output, err := ex.Execute(ctx, fmt.Sprintf("cat %s", core.ShellQuote(sysctlPath(value.Key))), observer)
+	if err != nil {
+		return false
+	}
+	return strings.Join(strings.Fields(output), " ") == strings.Join(strings.Fields(value.Value), " ")
+}
+
+// sysctlPath returns the /proc/sys file of a key. Keys containing '/' use it
+// as the separator so that dots can appear in names, e.g.
+// net/ipv4/conf/eth0.100/rp_filter.
+func sysctlPath(key string) string {
+	if !strings.Contains(key, "/") {
+		key = strings.ReplaceAll(key, ".", "/")
+	}
+	return path.Join("/proc/sys", key)
+}
+
+var _ core.Action = (*Sysctl)(nil)
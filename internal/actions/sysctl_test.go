@@ -0,0 +1,61 @@
+package actions
+
+import (
+	"testing"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+func Test_Sysctl(t *testing.T) {
+	ex := &core.FakeExecutor{}
+	action := NewSysctl("90-database", WithSysctlValue("vm.swappiness", "10"), WithSysctlValue("net.ipv4.tcp_rmem", "4096 87380 6291456"))
+
+	if err := action.Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "# Managed by anvil\nvm.swappiness = 10\nnet.ipv4.tcp_rmem = 4096 87380 6291456\n"
+	if content := string(ex.Files["/etc/sysctl.d/90-database.conf"]); content != expected {
+		t.Errorf("unexpected sysctl.d content:\n%s", content)
+	}
+	if !ex.Executed("sysctl -p /etc/sysctl.d/90-database.conf") {
+		t.Errorf("did not apply the values: %v", ex.History)
+	}
+}
+
+func Test_Sysctl_Unchanged(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Files: map[string][]byte{"/etc/sysctl.d/90-database.conf": []byte("# Managed by anvil\nvm.swappiness = 10\nnet.ipv4.tcp_rmem = 4096 87380 6291456\n")},
+		Responses: map[string]core.FakeResponse{
+			"cat /proc/sys/vm/swappiness":     {Output: "10\n"},
+			"cat /proc/sys/net/ipv4/tcp_rmem": {Output: "4096\t87380\t6291456\n"},
+		},
+	}
+	observer := &resultRecorder{}
+	action := NewSysctl("90-database", WithSysctlValue("vm.swappiness", "10"), WithSysctlValue("net.ipv4.tcp_rmem", "4096 87380 6291456"))
+
+	if err := action.Handle(t.Context(), ex, core.Ubuntu{}, observer); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(observer.Results) != 1 || observer.Results[0].Changed {
+		t.Errorf("expected a single unchanged result, got %v", observer.Results)
+	}
+}
+
+func Test_Sysctl_AppliesDriftedLiveValue(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Files: map[string][]byte{"/etc/sysctl.d/90-proxy.conf": []byte("# Managed by anvil\nnet/ipv4/conf/eth0.100/rp_filter = 2\n")},
+		Responses: map[string]core.FakeResponse{
+			"cat /proc/sys/net/ipv4/conf/eth0.100/rp_filter": {Output: "1\n"},
+		},
+	}
+
+	if err := NewSysctl("90-proxy", WithSysctlValue("net/ipv4/conf/eth0.100/rp_filter", "2")).Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !ex.Executed("sysctl -p /etc/sysctl.d/90-proxy.conf") {
+		t.Errorf("did not apply the drifted value: %v", ex.History)
+	}
+}
@@ -0,0 +1,198 @@
+package actions
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"text/template"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+// UnitEntry is a single key=value line of a unit file. An empty value resets
+// a list setting such as ExecStart in a drop-in.
+type UnitEntry struct {
+	Key   string
+	Value string
+}
+
+// UnitSection is a [Section] of a unit file with its entries in order
+type UnitSection struct {
+	Name    string
+	Entries []UnitEntry
+}
+
+// UnitState is the desired state of a unit file
+type UnitState int
+
+const (
+	UnitPresent UnitState = iota
+	UnitAbsent
+)
+
+type SystemdUnitOpts struct {
+	UnitName string
+	Sections []UnitSection
+	// Content is the complete unit file, used instead of Sections
+	Content string
+	// Template is a text/template rendered with TemplateData into the
+	// complete unit file
+	Template     string
+	TemplateData any
+	// DropIn is the name of a drop-in under <unit>.d to write instead of
+	// the unit file itself
+	DropIn string
+	State  UnitState
+}
+
+type SystemdUnitOptsFunc func(*SystemdUnitOpts)
+
+// WithUnitEntry adds key=value to the named section, creating the section
+// after the existing ones if needed
+func WithUnitEntry(section string, key string, value string) SystemdUnitOptsFunc {
+	return func(o *SystemdUnitOpts) {
+		for i := range o.Sections {
+			if o.Sections[i].Name == section {
+				o.Sections[i].Entries = append(o.Sections[i].Entries, UnitEntry{Key: key, Value: value})
+				return
+			}
+		}
+		o.Sections = append(o.Sections, UnitSection{Name: section, Entries: []UnitEntry{{Key: key, Value: value}}})
+	}
+}
+
+func WithUnitContent(content string) SystemdUnitOptsFunc {
+	return func(o *SystemdUnitOpts) {
+		o.Content = content
+	}
+}
+
+// WithUnitTemplate renders the unit file from a text/template with data
+func WithUnitTemplate(text string, data any) SystemdUnitOptsFunc {
+	return func(o *SystemdUnitOpts) {
+		o.Template = text
+		o.TemplateData = data
+	}
+}
+
+// WithDropIn writes the drop-in <unit>.d/<name>.conf instead of the unit file
+func WithDropIn(name string) SystemdUnitOptsFunc {
+	return func(o *SystemdUnitOpts) {
+		o.DropIn = name
+	}
+}
+
+// WithOverride writes the drop-in <unit>.d/override.conf, as systemctl edit
+// does
+func WithOverride() SystemdUnitOptsFunc {
+	return WithDropIn("override")
+}
+
+func WithUnitAbsent() SystemdUnitOptsFunc {
+	return func(o *SystemdUnitOpts) {
+		o.State = UnitAbsent
+	}
+}
+
+// SystemdUnit writes a systemd unit file or drop-in and reloads systemd when
+// it changed. Starting and enabling the unit is left to ServiceAction.
+type SystemdUnit struct {
+	SystemdUnitOpts
+}
+
+func DefaultSystemdUnitOpts() SystemdUnitOpts {
+	return SystemdUnitOpts{
+		State: UnitPresent,
+	}
+}
+
+func NewSystemdUnit(unitName string, opts ...SystemdUnitOptsFunc) *SystemdUnit {
+	o := DefaultSystemdUnitOpts()
+	o.UnitName = unitName
+	for _, fn := range opts {
+		fn(&o)
+	}
+	return &SystemdUnit{
+		SystemdUnitOpts: o,
+	}
+}
+
+func (a SystemdUnit) Path(os core.OS) string {
+	unitPath := os.ServiceUnitPath(a.UnitName)
+	if a.DropIn == "" {
+		return unitPath
+	}
+	return path.Join(unitPath+".d", a.DropIn+".conf")
+}
+
+func (a SystemdUnit) Handle(ctx context.Context, ex core.Executor, os core.OS, observer core.ActionObserver) error {
+	return core.WithObserver(observer, func() error {
+		if !strings.Contains(a.UnitName, ".") || strings.Contains(a.UnitName, "/") {
+			return fmt.Errorf("invalid unit name %q: expected a name such as app.service", a.UnitName)
+		}
+
+		var changed bool
+		var err error
+		if a.State == UnitAbsent {
+			changed, err = removeFile(ctx, ex, a.Path(os), observer)
+		} else {
+			var content []byte
+			content, err = a.render()
+			if err != nil {
+				return err
+			}
+			changed, err = ensureFile(ctx, ex, a.Path(os), content, 0o644, observer)
+		}
+		if err != nil {
+			return err
+		}
+
+		if changed {
+			_, err = ex.Execute(ctx, os.ReloadServices(), observer)
+			if err != nil {
+				return err
+			}
+		}
+
+		return core.ReportResult(observer, core.ActionResult{ID: "unit " + a.ID(), Changed: changed})
+	})
+}
+
+// ID names the unit, or the drop-in as unit/name
+func (a SystemdUnit) ID() string {
+	if a.DropIn == "" {
+		return a.UnitName
+	}
+	return a.UnitName + "/" + a.DropIn
+}
+
+func (a SystemdUnit) render() ([]byte, error) {
+	if a.Template != "" {
+		tmpl, err := template.New(a.UnitName).Option("missingkey=error").Parse(a.Template)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template for unit %s: %w", a.UnitName, err)
+		}
+		var b bytes.Buffer
+		if err := tmpl.Execute(&b, a.TemplateData); err != nil {
+			return nil, fmt.Errorf("failed to render unit %s: %w", a.UnitName, err)
+		}
+		return b.Bytes(), nil
+	}
+	if a.Content != "" {
+		return []byte(a.Content), nil
+	}
+
+	var b bytes.Buffer
+	b.WriteString("# Managed by anvil\n")
+	for _, section := range a.Sections {
+		fmt.Fprintf(&b, "\n[%s]\n", section.Name)
+		for _, entry := range section.Entries {
+			fmt.Fprintf(&b, "%s=%s\n", entry.Key, entry.Value)
+		}
+	}
+	return b.Bytes(), nil
+}
+
+var _ core.Action = (*SystemdUnit)(nil)
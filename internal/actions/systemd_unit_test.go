@@ -0,0 +1,103 @@
+package actions
+
+import (
+	"testing"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+func Test_SystemdUnit(t *testing.T) {
+	ex := &core.FakeExecutor{}
+	action := NewSystemdUnit("app.service",
+		WithUnitEntry("Unit", "Description", "App"),
+		WithUnitEntry("Service", "ExecStart", "/usr/local/bin/app"),
+		WithUnitEntry("Service", "User", "deploy"),
+		WithUnitEntry("Install", "WantedBy", "multi-user.target"),
+	)
+
+	if err := action.Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "# Managed by anvil\n\n[Unit]\nDescription=App\n\n[Service]\nExecStart=/usr/local/bin/app\nUser=deploy\n\n[Install]\nWantedBy=multi-user.target\n"
+	if content := string(ex.Files["/etc/systemd/system/app.service"]); content != expected {
+		t.Errorf("unexpected unit file:\n%s", content)
+	}
+
+	if !ex.Executed("systemctl daemon-reload") {
+		t.Error("did not reload systemd after writing the unit")
+	}
+}
+
+func Test_SystemdUnit_OverrideFromTemplate(t *testing.T) {
+	ex := &core.FakeExecutor{}
+	action := NewSystemdUnit("nginx.service",
+		WithOverride(),
+		WithUnitTemplate("[Service]\nLimitNOFILE={{ .Files }}\n", map[string]int{"Files": 65536}),
+	)
+
+	if err := action.Handle(t.Context(), ex, core.Fedora{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if content := string(ex.Files["/etc/systemd/system/nginx.service.d/override.conf"]); content != "[Service]\nLimitNOFILE=65536\n" {
+		t.Errorf("unexpected override:\n%s", content)
+	}
+
+	if !ex.Executed("mkdir -p /etc/systemd/system/nginx.service.d") {
+		t.Error("did not create the drop-in directory")
+	}
+}
+
+func Test_SystemdUnit_UnchangedSkipsReload(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Files: map[string][]byte{"/etc/systemd/system/app.service": []byte("[Service]\nExecStart=/bin/app\n")},
+	}
+	observer := &resultRecorder{}
+	action := NewSystemdUnit("app.service", WithUnitContent("[Service]\nExecStart=/bin/app\n"))
+
+	if err := action.Handle(t.Context(), ex, core.Ubuntu{}, observer); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if ex.Executed("systemctl daemon-reload") {
+		t.Error("should not reload systemd when nothing changed")
+	}
+
+	if len(observer.Results) != 1 || observer.Results[0].Changed {
+		t.Errorf("expected a single unchanged result, got %v", observer.Results)
+	}
+}
+
+func Test_SystemdUnit_TemplateError(t *testing.T) {
+	action := NewSystemdUnit("app.service", WithUnitTemplate("ExecStart={{ .Missing }}\n", map[string]string{}))
+
+	if err := action.Handle(t.Context(), &core.FakeExecutor{}, core.Ubuntu{}, nil); err == nil {
+		t.Error("expected error for a template that fails to render")
+	}
+}
+
+func Test_ServiceAction_MaskSkipsMasked(t *testing.T) {
+	os := core.Ubuntu{}
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			os.ServiceEnabled("apache2"): {Output: "masked\n"},
+		},
+	}
+
+	if err := NewMaskService("apache2").Handle(t.Context(), ex, os, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if ex.Executed("systemctl mask apache2") {
+		t.Error("should not mask an already masked service")
+	}
+
+	if err := NewUnmaskService("apache2").Handle(t.Context(), ex, os, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !ex.Executed("systemctl unmask apache2") {
+		t.Error("did not unmask a masked service")
+	}
+}
@@ -0,0 +1,52 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+// Timezone sets the system timezone, e.g. Europe/Berlin or UTC
+type Timezone struct {
+	Timezone string
+}
+
+func NewTimezone(timezone string) *Timezone {
+	return &Timezone{
+		Timezone: timezone,
+	}
+}
+
+var timezoneName = regexp.MustCompile(`^[A-Za-z0-9_+-]+(/[A-Za-z0-9_+-]+)*$`)
+
+func (a Timezone) Handle(ctx context.Context, ex core.Executor, os core.OS, observer core.ActionObserver) error {
+	return core.WithObserver(observer, func() error {
+		if !timezoneName.MatchString(a.Timezone) {
+			return fmt.Errorf("invalid timezone %q", a.Timezone)
+		}
+
+		current, err := ex.Execute(ctx, os.Timezone(), observer)
+		if err != nil {
+			return err
+		}
+		current = strings.TrimSpace(current)
+		if core.IsDryRun(ex) {
+			current = ""
+		}
+
+		changed := current != a.Timezone
+		if changed {
+			output, err := ex.Execute(ctx, os.SetTimezone(a.Timezone), observer)
+			if err != nil {
+				return fmt.Errorf("failed to set timezone %s: %w: %s", a.Timezone, err, strings.TrimSpace(output))
+			}
+		}
+
+		return core.ReportResult(observer, core.ActionResult{ID: "timezone", Changed: changed, Before: current, After: a.Timezone})
+	})
+}
+
+var _ core.Action = (*Timezone)(nil)
@@ -0,0 +1,40 @@
+package actions
+
+import (
+	"testing"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+func Test_Timezone(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			core.Ubuntu{}.Timezone(): {Output: "Etc/UTC\n"},
+		},
+	}
+
+	if err := NewTimezone("Europe/Berlin").Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !ex.Executed(core.Ubuntu{}.SetTimezone("Europe/Berlin")) {
+		t.Errorf("did not set timezone: %v", ex.History)
+	}
+
+	ex = &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			core.Ubuntu{}.Timezone(): {Output: "Europe/Berlin\n"},
+		},
+	}
+	if err := NewTimezone("Europe/Berlin").Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ex.Executed(core.Ubuntu{}.SetTimezone("Europe/Berlin")) {
+		t.Error("should not set a timezone that is already set")
+	}
+}
+
+func Test_Timezone_Invalid(t *testing.T) {
+	if err := NewTimezone("../../etc/passwd").Handle(t.Context(), &core.FakeExecutor{}, core.Ubuntu{}, nil); err == nil {
+		t.Error("expected error for an invalid timezone")
+	}
+}
@@ -0,0 +1,79 @@
+package actions
+
+import (
+	"context"
+	"strings"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+type UpgradePackagesOpts struct {
+	Mode         core.UpgradeMode
+	HeldPackages []string
+}
+
+type UpgradePackagesOptsFunc func(*UpgradePackagesOpts)
+
+// WithDistUpgrade allows the upgrade to install and remove packages as
+// dependencies change
+func WithDistUpgrade() UpgradePackagesOptsFunc {
+	return func(o *UpgradePackagesOpts) {
+		o.Mode = core.UpgradeDist
+	}
+}
+
+// WithHeldPackages keeps the given packages at their installed version
+func WithHeldPackages(packageNames ...string) UpgradePackagesOptsFunc {
+	return func(o *UpgradePackagesOpts) {
+		o.HeldPackages = append(o.HeldPackages, packageNames...)
+	}
+}
+
+// UpgradePackages upgrades all installed packages
+type UpgradePackages struct {
+	UpgradePackagesOpts
+}
+
+func DefaultUpgradePackagesOpts() UpgradePackagesOpts {
+	return UpgradePackagesOpts{
+		Mode: core.UpgradeSafe,
+	}
+}
+
+func NewUpgradePackages(opts ...UpgradePackagesOptsFunc) *UpgradePackages {
+	o := DefaultUpgradePackagesOpts()
+	for _, fn := range opts {
+		fn(&o)
+	}
+	return &UpgradePackages{
+		UpgradePackagesOpts: o,
+	}
+}
+
+// upToDateMarkers are printed by the package managers when there was nothing
+// to upgrade
+var upToDateMarkers = []string{
+	"0 upgraded, 0 newly installed, 0 to remove",
+	"Nothing to do",
+}
+
+func (a UpgradePackages) Handle(ctx context.Context, ex core.Executor, os core.OS, observer core.ActionObserver) error {
+	return core.WithObserver(observer, func() error {
+		output, err := ex.Execute(ctx, os.UpgradePackages(a.Mode, a.HeldPackages...), observer)
+		if err != nil {
+			return err
+		}
+
+		changed := true
+		for _, marker := range upToDateMarkers {
+			if strings.Contains(output, marker) {
+				changed = false
+				break
+			}
+		}
+
+		return core.ReportResult(observer, core.ActionResult{ID: "package upgrade", Changed: changed})
+	})
+}
+
+var _ core.Action = (*UpgradePackages)(nil)
@@ -0,0 +1,26 @@
+package actions
+
+import (
+	"testing"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+func Test_UpgradePackages_UpToDate(t *testing.T) {
+	os := core.Ubuntu{}
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			os.UpgradePackages(core.UpgradeDist, "nginx"): {Output: "0 upgraded, 0 newly installed, 0 to remove and 0 not upgraded.\n"},
+		},
+	}
+	observer := &resultRecorder{}
+	action := NewUpgradePackages(WithDistUpgrade(), WithHeldPackages("nginx"))
+
+	if err := action.Handle(t.Context(), ex, os, observer); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if len(observer.Results) != 1 || observer.Results[0].Changed {
+		t.Errorf("expected a single unchanged result, got %v", observer.Results)
+	}
+}
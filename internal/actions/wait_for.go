@@ -0,0 +1,65 @@
+package actions
+
+import (
+	"context"
+	"time"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+type WaitForOpts struct {
+	Condition Condition
+	Timeout   time.Duration
+	Interval  time.Duration
+}
+
+type WaitForOptsFunc func(*WaitForOpts)
+
+func WithWaitTimeout(timeout time.Duration) WaitForOptsFunc {
+	return func(o *WaitForOpts) {
+		o.Timeout = timeout
+	}
+}
+
+func WithWaitInterval(interval time.Duration) WaitForOptsFunc {
+	return func(o *WaitForOpts) {
+		o.Interval = interval
+	}
+}
+
+// WaitFor polls a condition on the target until it holds, e.g. MySQL
+// accepting connections before a database is created. It fails when the
+// timeout passes or the context is cancelled first.
+type WaitFor struct {
+	WaitForOpts
+}
+
+func DefaultWaitForOpts() WaitForOpts {
+	return WaitForOpts{
+		Timeout:  time.Minute,
+		Interval: time.Second,
+	}
+}
+
+func NewWaitFor(condition Condition, opts ...WaitForOptsFunc) *WaitFor {
+	o := DefaultWaitForOpts()
+	o.Condition = condition
+	for _, fn := range opts {
+		fn(&o)
+	}
+	return &WaitFor{
+		WaitForOpts: o,
+	}
+}
+
+func (a WaitFor) Handle(ctx context.Context, ex core.Executor, os core.OS, observer core.ActionObserver) error {
+	return core.WithObserver(observer, func() error {
+		if err := poll(ctx, ex, os, a.Condition, a.Timeout, a.Interval, observer); err != nil {
+			return err
+		}
+
+		return core.ReportResult(observer, core.ActionResult{ID: "wait for " + a.Condition.Description, Changed: false})
+	})
+}
+
+var _ core.Action = (*WaitFor)(nil)
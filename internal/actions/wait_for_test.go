@@ -0,0 +1,109 @@
+package actions
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+// sequenceExecutor answers the same command with a different response on each
+// call, repeating the last one
+type sequenceExecutor struct {
+	core.FakeExecutor
+	responses []core.FakeResponse
+}
+
+func (e *sequenceExecutor) Execute(ctx context.Context, command string, observer core.ExecutionObserver) (string, error) {
+	e.History = append(e.History, command)
+	resp := e.responses[0]
+	if len(e.responses) > 1 {
+		e.responses = e.responses[1:]
+	}
+	return resp.Output, resp.Err
+}
+
+func Test_WaitFor_PollsUntilHolds(t *testing.T) {
+	ex := &sequenceExecutor{responses: []core.FakeResponse{
+		{Err: errors.New("exit status 1")},
+		{Err: errors.New("exit status 1")},
+		{},
+	}}
+	action := NewWaitFor(PortOpen("127.0.0.1", 3306), WithWaitInterval(time.Millisecond), WithWaitTimeout(time.Second))
+
+	if err := action.Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(ex.History) != 3 {
+		t.Errorf("expected 3 probes, got %v", ex.History)
+	}
+}
+
+func Test_WaitFor_TimesOut(t *testing.T) {
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			"test -e /run/app.ready": {Err: errors.New("exit status 1")},
+		},
+	}
+	action := NewWaitFor(FileExists("/run/app.ready"), WithWaitInterval(time.Millisecond), WithWaitTimeout(20*time.Millisecond))
+
+	if err := action.Handle(t.Context(), ex, core.Ubuntu{}, nil); err == nil {
+		t.Fatal("expected error when the condition never holds")
+	}
+}
+
+func Test_WaitFor_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	ex := &core.FakeExecutor{
+		Responses: map[string]core.FakeResponse{
+			httpProbe("http://localhost/"): {Output: "503"},
+		},
+	}
+	action := NewWaitFor(HTTPStatus("http://localhost/", 200))
+
+	if err := action.Handle(ctx, ex, core.Ubuntu{}, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func Test_WaitFor_DryRun(t *testing.T) {
+	ex := &core.DryRunExecutor{}
+	action := NewWaitFor(FileExists("/run/app.sock"), WithWaitInterval(time.Millisecond), WithWaitTimeout(time.Second))
+
+	if err := action.Handle(t.Context(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("a dry run should not wait: %v", err)
+	}
+	if len(ex.Commands) != 1 {
+		t.Errorf("expected a single probe, got %v", ex.Commands)
+	}
+}
+
+func Test_Conditions(t *testing.T) {
+	tests := []struct {
+		condition Condition
+		probe     string
+		output    string
+		err       error
+		holds     bool
+	}{
+		{PortClosed("db", 5432), "timeout 2 bash -c '</dev/tcp/db/5432'", "", errors.New("exit status 1"), true},
+		{FileAbsent("/tmp/lock"), "test ! -e /tmp/lock", "", nil, true},
+		{FileMatches("/var/log/app.log", "ready|started"), "grep -Eq 'ready|started' /var/log/app.log", "", nil, true},
+		{HTTPStatus("http://localhost/", 204), httpProbe("http://localhost/"), "204", nil, true},
+		{HTTPOK("http://localhost/"), httpProbe("http://localhost/"), "000", errors.New("exit status 7"), false},
+		{CommandSucceeds("mysqladmin ping"), "mysqladmin ping", "", nil, true},
+	}
+
+	for _, tt := range tests {
+		if probe := tt.condition.Probe(core.Ubuntu{}); probe != tt.probe {
+			t.Errorf("%s: expected probe %q, got %q", tt.condition.Description, tt.probe, probe)
+		}
+		if holds := tt.condition.Holds(tt.output, tt.err); holds != tt.holds {
+			t.Errorf("%s: expected holds %v, got %v", tt.condition.Description, tt.holds, holds)
+		}
+	}
+}
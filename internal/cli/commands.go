@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/johnnyfreeman/anvil/internal/actions"
 	"github.com/johnnyfreeman/anvil/internal/core"
@@ -15,6 +16,11 @@ import (
 func CreateUserCommand(ctx context.Context, executor core.Executor, args []string) {
 	fs := flag.NewFlagSet("create-user", flag.ExitOnError)
 	group := fs.String("group", "", "Optional group to add user to")
+	shell := fs.String("shell", "", "Login shell")
+	home := fs.String("home", "", "Home directory")
+	uid := fs.Int("uid", -1, "User ID")
+	system := fs.Bool("system", false, "Create a system account")
+	remove := fs.Bool("remove", false, "Remove the user and its home directory")
 	
 	if err := fs.Parse(args); err != nil {
 		log.Fatal(err)
@@ -29,14 +35,72 @@ func CreateUserCommand(ctx context.Context, executor core.Executor, args []strin
 	// Create action
 	var opts []actions.CreateUserOptsFunc
 	if *group != "" {
-		opts = append(opts, actions.WithGroup(*group))
+		opts = append(opts, actions.WithGroup(*group), actions.WithEnsureGroups())
+	}
+	if *shell != "" {
+		opts = append(opts, actions.WithShell(*shell))
+	}
+	if *home != "" {
+		opts = append(opts, actions.WithHome(*home))
+	}
+	if *uid >= 0 {
+		opts = append(opts, actions.WithUID(*uid))
+	}
+	if *system {
+		opts = append(opts, actions.WithSystemUser())
+	}
+	if *remove {
+		opts = append(opts, actions.WithUserAbsent(true))
 	}
 	
 	action := actions.NewCreateUser(username, opts...)
 	
 	// Execute action
+	successMsg := fmt.Sprintf("✓ User %s created successfully", username)
+	if *remove {
+		successMsg = fmt.Sprintf("✓ User %s removed successfully", username)
+	}
 	runner := NewRunner(ctx, executor, &cliObserver{})
-	runner.ExecuteAction(action, fmt.Sprintf("✓ User %s created successfully", username))
+	runner.ExecuteAction(action, successMsg)
+}
+
+func CreateGroupCommand(ctx context.Context, executor core.Executor, args []string) {
+	fs := flag.NewFlagSet("create-group", flag.ExitOnError)
+	gid := fs.Int("gid", -1, "Group ID")
+	system := fs.Bool("system", false, "Create a system group")
+	remove := fs.Bool("remove", false, "Remove the group")
+	
+	if err := fs.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+	
+	if fs.NArg() < 1 {
+		log.Fatal("Group name required")
+	}
+	
+	name := fs.Arg(0)
+	
+	// Create action
+	var opts []actions.CreateGroupOptsFunc
+	if *gid >= 0 {
+		opts = append(opts, actions.WithGID(*gid))
+	}
+	if *system {
+		opts = append(opts, actions.WithSystemGroup())
+	}
+	if *remove {
+		opts = append(opts, actions.WithGroupAbsent())
+	}
+	
+	action := actions.NewCreateGroup(name, opts...)
+	
+	// Execute action
+	successMsg := fmt.Sprintf("✓ Group %s created successfully", name)
+	if *remove {
+		successMsg = fmt.Sprintf("✓ Group %s removed successfully", name)
+	}
+	runner := NewRunner(ctx, executor, &cliObserver{})
+	runner.ExecuteAction(action, successMsg)
 }
 
 func InstallPackageCommand(ctx context.Context, executor core.Executor, args []string) {
@@ -51,7 +115,7 @@ func InstallPackageCommand(ctx context.Context, executor core.Executor, args []s
 		log.Fatal("Package name required")
 	}
 	
-	packageName := fs.Arg(0)
+	packageNames := fs.Args()
 	
 	// Create action
 	var opts []actions.InstallPackageOptsFunc
@@ -59,11 +123,11 @@ func InstallPackageCommand(ctx context.Context, executor core.Executor, args []s
 		opts = append(opts, actions.WithUpdate())
 	}
 	
-	action := actions.NewInstallPackage(packageName, opts...)
+	action := actions.NewInstallPackages(packageNames, opts...)
 	
 	// Execute action
 	runner := NewRunner(ctx, executor, &cliObserver{})
-	runner.ExecuteAction(action, fmt.Sprintf("✓ Package %s installed successfully", packageName))
+	runner.ExecuteAction(action, fmt.Sprintf("✓ Packages %s installed successfully", strings.Join(packageNames, ", ")))
 }
 
 func RecipeCommand(ctx context.Context, executor core.Executor, args []string) {
@@ -140,4 +204,17 @@ func (o *cliObserver) OnExecutionOutput(output string) error {
 
 func (o *cliObserver) OnExecutionEnd() error {
 	return nil
+}
+
+func (o *cliObserver) OnActionResult(result core.ActionResult) error {
+	status := "ok"
+	if result.Changed {
+		status = "changed"
+	}
+	if result.Before != "" || result.After != "" {
+		fmt.Printf("  [%s] %s (%s -> %s)\n", status, result.ID, result.Before, result.After)
+		return nil
+	}
+	fmt.Printf("  [%s] %s\n", status, result.ID)
+	return nil
 }
\ No newline at end of file
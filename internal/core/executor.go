@@ -2,6 +2,7 @@ package core
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os/exec"
@@ -14,6 +15,20 @@ type Executor interface {
 	Execute(ctx context.Context, command string, observer ExecutionObserver) (string, error)
 }
 
+// ExitCode returns the exit status of a command from the error Execute
+// returned, such as an *exec.ExitError. It reports false for errors that carry
+// no exit status, e.g. when the command couldn't be started.
+func ExitCode(err error) (int, bool) {
+	if err == nil {
+		return 0, true
+	}
+	var exitErr interface{ ExitCode() int }
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), true
+	}
+	return 0, false
+}
+
 type SshExecutor struct {
 	Host string
 	User string
@@ -31,9 +46,10 @@ func (e SshExecutor) Execute(ctx context.Context, command string, observer Execu
 		}()
 	}
 
-	// Use ssh command for now - can be improved with golang.org/x/crypto/ssh later
-	sshCmd := fmt.Sprintf("ssh %s@%s '%s'", e.User, e.Host, command)
-	cmd := exec.CommandContext(ctx, "sh", "-c", sshCmd)
+	// Use ssh command for now - can be improved with golang.org/x/crypto/ssh later.
+	// The command is passed as a single argument so that ssh hands it to the
+	// remote shell unchanged, whatever quoting it contains.
+	cmd := exec.CommandContext(ctx, "ssh", e.target(), command)
 	
 	var output strings.Builder
 	cmd.Stdout = &output
@@ -48,6 +64,10 @@ func (e SshExecutor) Execute(ctx context.Context, command string, observer Execu
 	return output.String(), err
 }
 
+func (e SshExecutor) target() string {
+	return fmt.Sprintf("%s@%s", e.User, e.Host)
+}
+
 type LocalExecutor struct{}
 
 func (e LocalExecutor) Execute(ctx context.Context, command string, observer ExecutionObserver) (string, error) {
@@ -92,6 +112,7 @@ func (w *observerWriter) Write(p []byte) (n int, err error) {
 type FakeExecutor struct {
 	History   []string
 	Responses map[string]FakeResponse
+	Files     map[string][]byte
 }
 
 type FakeResponse struct {
@@ -135,8 +156,14 @@ func (e *FakeExecutor) Executed(command string) bool {
 }
 
 type DryRunExecutor struct {
-	Commands       []string
-	simulatedError bool
+	Commands []string
+}
+
+// IsDryRun reports whether ex only previews commands, for actions that show
+// more detail, such as diffs, when nothing is applied
+func IsDryRun(ex Executor) bool {
+	_, ok := ex.(*DryRunExecutor)
+	return ok
 }
 
 func (e *DryRunExecutor) Execute(ctx context.Context, command string, observer ExecutionObserver) (string, error) {
@@ -159,13 +186,9 @@ func (e *DryRunExecutor) Execute(ctx context.Context, command string, observer E
 		}
 	}
 
-	// Simulate realistic command behavior for dry run
-	// This helps actions make proper decisions about next steps
-	if strings.Contains(command, "id -u") && !e.simulatedError {
-		// Simulate user not found to trigger user creation (only once)
-		e.simulatedError = true
-		return "", fmt.Errorf("exit status 1")
-	}
+	// Actions parse the output of their checks, so the dry run output is
+	// never mistaken for existing state and the changes they would make are
+	// shown
 
 	return "[DRY RUN] Command would be executed", nil
 }
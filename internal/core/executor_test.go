@@ -102,6 +102,7 @@ type TestObserver struct {
 	ActionEndCalled   bool
 	Commands          []string
 	Outputs           []string
+	Results           []ActionResult
 }
 
 func (o *TestObserver) OnExecutionStart(command string) error {
@@ -130,3 +131,8 @@ func (o *TestObserver) OnActionEnd() error {
 	o.ActionEndCalled = true
 	return nil
 }
+
+func (o *TestObserver) OnActionResult(result ActionResult) error {
+	o.Results = append(o.Results, result)
+	return nil
+}
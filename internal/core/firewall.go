@@ -0,0 +1,375 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// FirewallPolicy is what a firewall rule does with matching traffic
+type FirewallPolicy int
+
+const (
+	FirewallAllow FirewallPolicy = iota
+	FirewallDeny
+)
+
+func (p FirewallPolicy) String() string {
+	if p == FirewallDeny {
+		return "deny"
+	}
+	return "allow"
+}
+
+// FirewallRule allows or denies incoming traffic to a port. Rules are
+// compared as values, so backends parse the current rules into the same
+// form they are written in.
+type FirewallRule struct {
+	Policy   FirewallPolicy
+	Port     int
+	Protocol string
+	// Source is an address or CIDR the rule is limited to. Empty matches any
+	// source.
+	Source string
+	// Zone is the firewalld zone of the rule. Empty is the default zone.
+	// Other backends have no zones and ignore it.
+	Zone string
+}
+
+// String describes the rule, e.g. allow 5432/tcp from 10.0.0.0/8
+func (r FirewallRule) String() string {
+	s := fmt.Sprintf("%s %d/%s", r.Policy, r.Port, r.Protocol)
+	if r.Source != "" {
+		s += " from " + r.Source
+	}
+	if r.Zone != "" {
+		s += " in zone " + r.Zone
+	}
+	return s
+}
+
+// Firewall builds the commands that manage a host firewall. Commands that
+// change rules only change the stored configuration until Apply, and Enable
+// is run after the rules are in place so that enabling a firewall never
+// blocks traffic the rules allow.
+type Firewall interface {
+	// Name is the firewall tool, e.g. ufw
+	Name() string
+	// Installed succeeds if the firewall tool is installed
+	Installed() string
+	// Active succeeds if the firewall is enabled and filtering traffic
+	Active() string
+	Enable() string
+	// ListRules prints the rules of a zone for ParseRules
+	ListRules(zone string) string
+	// ParseRules returns the port rules in the output of ListRules. Rules it
+	// can't represent, e.g. for services or port ranges, are left out.
+	ParseRules(output string, zone string) []FirewallRule
+	AddRule(rule FirewallRule) string
+	RemoveRule(rule FirewallRule) string
+	// Apply makes changed rules take effect, or is empty if they already
+	// have
+	Apply() string
+}
+
+// UfwFirewall manages ufw, the firewall of Debian-family hosts
+type UfwFirewall struct{}
+
+func (f UfwFirewall) Name() string {
+	return "ufw"
+}
+
+func (f UfwFirewall) Installed() string {
+	return "command -v ufw"
+}
+
+func (f UfwFirewall) Active() string {
+	return "ufw status | grep -q '^Status: active'"
+}
+
+func (f UfwFirewall) Enable() string {
+	return "ufw --force enable"
+}
+
+// ListRules prints the rules as ufw commands. Unlike ufw status it also lists
+// them while ufw is inactive.
+func (f UfwFirewall) ListRules(zone string) string {
+	return "ufw show added"
+}
+
+// ParseRules parses lines such as "ufw allow 22/tcp" and
+// "ufw deny from 10.0.0.0/8 to any port 5432 proto tcp"
+func (f UfwFirewall) ParseRules(output string, zone string) []FirewallRule {
+	var rules []FirewallRule
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[0] != "ufw" {
+			continue
+		}
+
+		rule := FirewallRule{Zone: zone}
+		switch fields[1] {
+		case "allow":
+			rule.Policy = FirewallAllow
+		case "deny":
+			rule.Policy = FirewallDeny
+		default:
+			continue
+		}
+
+		for i := 2; i < len(fields); i++ {
+			next := ""
+			if i+1 < len(fields) {
+				next = fields[i+1]
+			}
+			switch fields[i] {
+			case "from":
+				if next != "any" {
+					rule.Source = next
+				}
+				i++
+			case "to":
+				i++
+			case "port":
+				rule.Port, _ = strconv.Atoi(next)
+				i++
+			case "proto":
+				rule.Protocol = next
+				i++
+			default:
+				port, protocol, _ := strings.Cut(fields[i], "/")
+				if p, err := strconv.Atoi(port); err == nil {
+					rule.Port = p
+					rule.Protocol = protocol
+				}
+			}
+		}
+
+		// Rules for both protocols and application profiles aren't port rules
+		if rule.Port > 0 && rule.Protocol != "" {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+func (f UfwFirewall) AddRule(rule FirewallRule) string {
+	return "ufw " + f.rule(rule)
+}
+
+func (f UfwFirewall) RemoveRule(rule FirewallRule) string {
+	return "ufw delete " + f.rule(rule)
+}
+
+func (f UfwFirewall) rule(rule FirewallRule) string {
+	source := "any"
+	if rule.Source != "" {
+		source = ShellQuote(rule.Source)
+	}
+	return fmt.Sprintf("%s proto %s from %s to any port %d", rule.Policy, rule.Protocol, source, rule.Port)
+}
+
+// Apply is empty as ufw applies rules as they are added
+func (f UfwFirewall) Apply() string {
+	return ""
+}
+
+// FirewalldFirewall manages firewalld, the firewall of Fedora-family hosts.
+// Rules are written to the permanent configuration, with firewall-offline-cmd
+// while firewalld isn't running.
+type FirewalldFirewall struct{}
+
+func (f FirewalldFirewall) Name() string {
+	return "firewalld"
+}
+
+func (f FirewalldFirewall) Installed() string {
+	return "command -v firewall-cmd"
+}
+
+func (f FirewalldFirewall) Active() string {
+	return "firewall-cmd --state"
+}
+
+func (f FirewalldFirewall) Enable() string {
+	return "systemctl enable --now firewalld"
+}
+
+func (f FirewalldFirewall) ListRules(zone string) string {
+	return fmt.Sprintf("%s && %s", f.command(zone, "--list-ports"), f.command(zone, "--list-rich-rules"))
+}
+
+var (
+	richRuleSource = regexp.MustCompile(`source address="([^"]+)"`)
+	richRulePort   = regexp.MustCompile(`port port="(\d+)" protocol="(\w+)"`)
+)
+
+// ParseRules parses the open ports, e.g. "80/tcp 443/tcp", and rich rules
+// for a single port
+func (f FirewalldFirewall) ParseRules(output string, zone string) []FirewallRule {
+	var rules []FirewallRule
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "rule ") {
+			for _, field := range strings.Fields(line) {
+				port, protocol, _ := strings.Cut(field, "/")
+				if p, err := strconv.Atoi(port); err == nil {
+					rules = append(rules, FirewallRule{Policy: FirewallAllow, Port: p, Protocol: protocol, Zone: zone})
+				}
+			}
+			continue
+		}
+
+		match := richRulePort.FindStringSubmatch(line)
+		if match == nil || strings.Contains(line, " NOT ") {
+			continue
+		}
+		rule := FirewallRule{Policy: FirewallAllow, Protocol: match[2], Zone: zone}
+		rule.Port, _ = strconv.Atoi(match[1])
+		if source := richRuleSource.FindStringSubmatch(line); source != nil {
+			rule.Source = source[1]
+		}
+		switch {
+		case strings.HasSuffix(line, " reject"), strings.HasSuffix(line, " drop"):
+			rule.Policy = FirewallDeny
+		case !strings.HasSuffix(line, " accept"):
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+func (f FirewalldFirewall) AddRule(rule FirewallRule) string {
+	if rule.Policy == FirewallAllow && rule.Source == "" {
+		return f.command(rule.Zone, fmt.Sprintf("--add-port=%d/%s", rule.Port, rule.Protocol))
+	}
+	return f.command(rule.Zone, "--add-rich-rule="+ShellQuote(f.richRule(rule)))
+}
+
+func (f FirewalldFirewall) RemoveRule(rule FirewallRule) string {
+	if rule.Policy == FirewallAllow && rule.Source == "" {
+		return f.command(rule.Zone, fmt.Sprintf("--remove-port=%d/%s", rule.Port, rule.Protocol))
+	}
+	return f.command(rule.Zone, "--remove-rich-rule="+ShellQuote(f.richRule(rule)))
+}
+
+// richRule renders a rule the way firewalld lists it, e.g.
+// rule family="ipv4" source address="10.0.0.0/8" port port="5432" protocol="tcp" accept
+func (f FirewalldFirewall) richRule(rule FirewallRule) string {
+	action := "accept"
+	if rule.Policy == FirewallDeny {
+		action = "reject"
+	}
+	port := fmt.Sprintf(`port port="%d" protocol="%s" %s`, rule.Port, rule.Protocol, action)
+	if rule.Source == "" {
+		return "rule " + port
+	}
+	family := "ipv4"
+	if strings.Contains(rule.Source, ":") {
+		family = "ipv6"
+	}
+	return fmt.Sprintf(`rule family="%s" source address="%s" %s`, family, rule.Source, port)
+}
+
+// command runs a firewall-cmd option against the permanent configuration
+// of the zone, whether or not firewalld is running
+func (f FirewalldFirewall) command(zone string, option string) string {
+	if zone != "" {
+		option = "--zone=" + ShellQuote(zone) + " " + option
+	}
+	return fmt.Sprintf("if firewall-cmd --state >/dev/null 2>&1; then firewall-cmd --permanent %s; else firewall-offline-cmd %s; fi", option, option)
+}
+
+func (f FirewalldFirewall) Apply() string {
+	return "if firewall-cmd --state >/dev/null 2>&1; then firewall-cmd --reload; fi"
+}
+
+// NftablesFirewall manages an inet anvil table with nft. It is the fallback
+// for hosts without their family's firewall tool. Enable sets the input
+// chain's policy to drop, after letting established connections, loopback
+// and ICMP through. Apply saves the table to /etc/nftables.d/anvil.nft,
+// which the host's nftables configuration has to include to restore it at
+// boot.
+type NftablesFirewall struct{}
+
+const nftChain = "inet anvil input"
+
+func (f NftablesFirewall) Name() string {
+	return "nftables"
+}
+
+func (f NftablesFirewall) Installed() string {
+	return "command -v nft"
+}
+
+func (f NftablesFirewall) Active() string {
+	return fmt.Sprintf("nft list chain %s 2>/dev/null | grep -q 'policy drop'", nftChain)
+}
+
+func (f NftablesFirewall) Enable() string {
+	return fmt.Sprintf("%s && nft 'add rule %s ct state established,related accept; add rule %s iif lo accept; add rule %s meta l4proto { icmp, ipv6-icmp } accept; chain %s { policy drop; }'",
+		f.ensureChain(), nftChain, nftChain, nftChain, nftChain)
+}
+
+// ListRules prints nothing if the table doesn't exist yet
+func (f NftablesFirewall) ListRules(zone string) string {
+	return fmt.Sprintf("nft list chain %s 2>/dev/null || true", nftChain)
+}
+
+var nftRule = regexp.MustCompile(`^(?:ip6? saddr (\S+) )?(tcp|udp) dport (\d+) (accept|drop)$`)
+
+// ParseRules parses rules such as "ip saddr 10.0.0.0/8 tcp dport 5432 accept"
+func (f NftablesFirewall) ParseRules(output string, zone string) []FirewallRule {
+	var rules []FirewallRule
+	for _, line := range strings.Split(output, "\n") {
+		match := nftRule.FindStringSubmatch(strings.TrimSpace(line))
+		if match == nil {
+			continue
+		}
+		rule := FirewallRule{Policy: FirewallAllow, Source: match[1], Protocol: match[2], Zone: zone}
+		rule.Port, _ = strconv.Atoi(match[3])
+		if match[4] == "drop" {
+			rule.Policy = FirewallDeny
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+func (f NftablesFirewall) AddRule(rule FirewallRule) string {
+	return fmt.Sprintf("%s && nft add rule %s %s", f.ensureChain(), nftChain, f.rule(rule))
+}
+
+// RemoveRule deletes the rule by the handles of every copy of it in the chain
+func (f NftablesFirewall) RemoveRule(rule FirewallRule) string {
+	return fmt.Sprintf(`for h in $(nft -a list chain %s | awk -v rule=%s '{ h = $NF; sub(/^[ \t]+/, ""); sub(/ # handle [0-9]+$/, "") } $0 == rule { print h }'); do nft delete rule %s handle "$h"; done`,
+		nftChain, ShellQuote(f.rule(rule)), nftChain)
+}
+
+func (f NftablesFirewall) rule(rule FirewallRule) string {
+	action := "accept"
+	if rule.Policy == FirewallDeny {
+		action = "drop"
+	}
+	expr := fmt.Sprintf("%s dport %d %s", rule.Protocol, rule.Port, action)
+	if rule.Source == "" {
+		return expr
+	}
+	family := "ip"
+	if strings.Contains(rule.Source, ":") {
+		family = "ip6"
+	}
+	return fmt.Sprintf("%s saddr %s %s", family, rule.Source, expr)
+}
+
+// ensureChain creates the table and an accepting input chain if they don't
+// exist, leaving the policy of an existing chain alone
+func (f NftablesFirewall) ensureChain() string {
+	return fmt.Sprintf("nft add table inet anvil && { nft list chain %s >/dev/null 2>&1 || nft add chain %s '{ type filter hook input priority 0; policy accept; }'; }", nftChain, nftChain)
+}
+
+func (f NftablesFirewall) Apply() string {
+	return "mkdir -p /etc/nftables.d && nft list table inet anvil > /etc/nftables.d/anvil.nft"
+}
@@ -0,0 +1,71 @@
+package core
+
+import (
+	"slices"
+	"testing"
+)
+
+func Test_UfwParseRules(t *testing.T) {
+	output := `Added user rules (see 'ufw status' for running firewall):
+ufw allow 22/tcp
+ufw allow OpenSSH
+ufw allow 53
+ufw deny from 10.0.0.0/8 to any port 5432 proto tcp
+`
+	expected := []FirewallRule{
+		{Policy: FirewallAllow, Port: 22, Protocol: "tcp"},
+		{Policy: FirewallDeny, Port: 5432, Protocol: "tcp", Source: "10.0.0.0/8"},
+	}
+	if rules := (UfwFirewall{}).ParseRules(output, ""); !slices.Equal(rules, expected) {
+		t.Errorf("expected %v, got %v", expected, rules)
+	}
+}
+
+func Test_FirewalldParseRules(t *testing.T) {
+	output := `80/tcp 8000-8100/tcp
+rule family="ipv4" source address="10.0.0.0/8" port port="5432" protocol="tcp" accept
+rule port port="23" protocol="tcp" reject
+rule service name="ssh" accept
+`
+	expected := []FirewallRule{
+		{Policy: FirewallAllow, Port: 80, Protocol: "tcp", Zone: "public"},
+		{Policy: FirewallAllow, Port: 5432, Protocol: "tcp", Source: "10.0.0.0/8", Zone: "public"},
+		{Policy: FirewallDeny, Port: 23, Protocol: "tcp", Zone: "public"},
+	}
+	if rules := (FirewalldFirewall{}).ParseRules(output, "public"); !slices.Equal(rules, expected) {
+		t.Errorf("expected %v, got %v", expected, rules)
+	}
+
+	for _, rule := range expected[1:] {
+		if rendered := (FirewalldFirewall{}).richRule(rule); !slices.Equal(FirewalldFirewall{}.ParseRules(rendered, "public"), []FirewallRule{rule}) {
+			t.Errorf("rich rule %q doesn't parse back to %v", rendered, rule)
+		}
+	}
+}
+
+func Test_NftablesParseRules(t *testing.T) {
+	output := `table inet anvil {
+	chain input {
+		type filter hook input priority filter; policy drop;
+		ct state established,related accept
+		tcp dport 22 accept
+		ip saddr 10.0.0.0/8 tcp dport 5432 accept
+		ip6 saddr 2001:db8::/32 udp dport 53 drop
+	}
+}
+`
+	expected := []FirewallRule{
+		{Policy: FirewallAllow, Port: 22, Protocol: "tcp"},
+		{Policy: FirewallAllow, Port: 5432, Protocol: "tcp", Source: "10.0.0.0/8"},
+		{Policy: FirewallDeny, Port: 53, Protocol: "udp", Source: "2001:db8::/32"},
+	}
+	rules := (NftablesFirewall{}).ParseRules(output, "")
+	if !slices.Equal(rules, expected) {
+		t.Errorf("expected %v, got %v", expected, rules)
+	}
+	for _, rule := range rules {
+		if rendered := (NftablesFirewall{}).rule(rule); !slices.Equal(NftablesFirewall{}.ParseRules(rendered, ""), []FirewallRule{rule}) {
+			t.Errorf("rule %q doesn't parse back to %v", rendered, rule)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Group describes a local group. A nil GID leaves it to the system.
+type Group struct {
+	Name   string
+	GID    *int
+	System bool
+}
+
+// shadowGroupManager provides the shadow-utils group management commands
+// shared by the supported distributions
+type shadowGroupManager struct{}
+
+func (gm shadowGroupManager) CreateGroup(group Group) string {
+	args := []string{"groupadd"}
+	if group.System {
+		args = append(args, "-r")
+	}
+	if group.GID != nil {
+		args = append(args, "-g", strconv.Itoa(*group.GID))
+	}
+	args = append(args, ShellQuote(group.Name))
+	return strings.Join(args, " ")
+}
+
+func (gm shadowGroupManager) ModifyGroup(group Group) string {
+	args := []string{"groupmod"}
+	if group.GID != nil {
+		args = append(args, "-g", strconv.Itoa(*group.GID))
+	}
+	args = append(args, ShellQuote(group.Name))
+	return strings.Join(args, " ")
+}
+
+func (gm shadowGroupManager) RemoveGroup(name string) string {
+	return fmt.Sprintf("groupdel %s", ShellQuote(name))
+}
+
+// CheckGroup prints the group's entry, or fails if there is none
+func (gm shadowGroupManager) CheckGroup(name string) string {
+	return fmt.Sprintf("getent group %s", ShellQuote(name))
+}
@@ -0,0 +1,134 @@
+package core
+
+import (
+	"context"
+	"reflect"
+)
+
+// Notifier runs its handlers when its action reports a changed result, e.g. to
+// restart a service after its configuration changed
+type Notifier struct {
+	Action   Action
+	Handlers []Action
+}
+
+// Notify wraps action so that handlers run if it changes anything. Within a
+// recipe the handlers are deferred until all of the recipe's actions have
+// succeeded, and each handler runs once however many actions notify it.
+// Handlers are told apart by identity, so share the same action value between
+// notifiers.
+func Notify(action Action, handlers ...Action) *Notifier {
+	return &Notifier{
+		Action:   action,
+		Handlers: handlers,
+	}
+}
+
+func (n Notifier) Handle(ctx context.Context, ex Executor, os OS, observer ActionObserver) error {
+	changes := &changeObserver{observer: observer}
+	if err := n.Action.Handle(ctx, ex, os, changes); err != nil {
+		return err
+	}
+	if !changes.changed {
+		return nil
+	}
+
+	queue, deferred := ctx.Value(handlerQueueKey{}).(*handlerQueue)
+	for _, handler := range n.Handlers {
+		if deferred {
+			queue.add(handler)
+			continue
+		}
+		if err := handler.Handle(ctx, ex, os, observer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// changeObserver records whether any result passing through it was changed.
+// It forwards everything to observer, which may be nil.
+type changeObserver struct {
+	observer ActionObserver
+	changed  bool
+}
+
+func (o *changeObserver) OnExecutionStart(command string) error {
+	if o.observer == nil {
+		return nil
+	}
+	return o.observer.OnExecutionStart(command)
+}
+
+func (o *changeObserver) OnExecutionOutput(output string) error {
+	if o.observer == nil {
+		return nil
+	}
+	return o.observer.OnExecutionOutput(output)
+}
+
+func (o *changeObserver) OnExecutionEnd() error {
+	if o.observer == nil {
+		return nil
+	}
+	return o.observer.OnExecutionEnd()
+}
+
+func (o *changeObserver) OnActionStart() error {
+	if o.observer == nil {
+		return nil
+	}
+	return o.observer.OnActionStart()
+}
+
+func (o *changeObserver) OnActionEnd() error {
+	if o.observer == nil {
+		return nil
+	}
+	return o.observer.OnActionEnd()
+}
+
+func (o *changeObserver) OnActionResult(result ActionResult) error {
+	if result.Changed {
+		o.changed = true
+	}
+	return ReportResult(o.observer, result)
+}
+
+type handlerQueueKey struct{}
+
+// handlerQueue collects notified handlers in the order they were first
+// notified
+type handlerQueue struct {
+	handlers []Action
+}
+
+func (q *handlerQueue) add(handler Action) {
+	if reflect.TypeOf(handler).Comparable() {
+		for _, queued := range q.handlers {
+			if queued == handler {
+				return
+			}
+		}
+	}
+	q.handlers = append(q.handlers, handler)
+}
+
+// withHandlerQueue returns a context in which notified handlers are queued
+// instead of run immediately
+func withHandlerQueue(ctx context.Context) (context.Context, *handlerQueue) {
+	queue := &handlerQueue{}
+	return context.WithValue(ctx, handlerQueueKey{}, queue), queue
+}
+
+// run runs the queued handlers, including any they notify in turn
+func (q *handlerQueue) run(ctx context.Context, ex Executor, os OS, observer ActionObserver) error {
+	for i := 0; i < len(q.handlers); i++ {
+		if err := q.handlers[i].Handle(ctx, ex, os, observer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var _ Action = (*Notifier)(nil)
@@ -0,0 +1,73 @@
+package core_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+	"github.com/johnnyfreeman/anvil/internal/testutil"
+)
+
+func Test_Notify_RunsHandlersOnChange(t *testing.T) {
+	ex := &core.FakeExecutor{}
+	handler := &batchAction{items: []string{"restart"}}
+
+	unchanged := core.Notify(&unchangedAction{}, handler)
+	if err := unchanged.Handle(t.Context(), ex, &testutil.MockOS{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ex.Executed("echo restart") {
+		t.Fatal("should not run handlers when nothing changed")
+	}
+
+	changed := core.Notify(&reportingAction{id: "config"}, handler)
+	if err := changed.Handle(t.Context(), ex, &testutil.MockOS{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !ex.Executed("echo restart") {
+		t.Error("did not run handler after a change")
+	}
+}
+
+func Test_Notify_DeferredInRecipe(t *testing.T) {
+	ex := &core.FakeExecutor{}
+	handler := &batchAction{items: []string{"restart"}}
+	recipe := core.NewBaseRecipe("test", "", []core.Action{
+		core.Notify(&reportingAction{id: "a"}, handler),
+		core.Notify(&reportingAction{id: "b"}, handler),
+		&batchAction{items: []string{"last"}},
+	})
+
+	if err := recipe.Execute(t.Context(), ex, &testutil.MockOS{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{"echo last", "echo restart"}
+	if len(ex.History) != len(expected) || ex.History[0] != expected[0] || ex.History[1] != expected[1] {
+		t.Errorf("expected handler to run once after all actions, got %v", ex.History)
+	}
+}
+
+func Test_Notify_NotRunAfterFailure(t *testing.T) {
+	ex := &core.FakeExecutor{}
+	handler := &batchAction{items: []string{"restart"}}
+	recipe := core.NewBaseRecipe("test", "", []core.Action{
+		core.Notify(&reportingAction{id: "a"}, handler),
+		&TestAction{name: "fails", err: context.Canceled},
+	})
+
+	if err := recipe.Execute(t.Context(), ex, &testutil.MockOS{}, nil); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if ex.Executed("echo restart") {
+		t.Error("should not run handlers after a failed action")
+	}
+}
+
+// unchangedAction reports an unchanged result
+type unchangedAction struct{}
+
+func (a *unchangedAction) Handle(ctx context.Context, ex core.Executor, os core.OS, observer core.ActionObserver) error {
+	return core.ReportResult(observer, core.ActionResult{ID: "unchanged", Changed: false})
+}
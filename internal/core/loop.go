@@ -0,0 +1,225 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"slices"
+)
+
+// Batchable is implemented by actions that can be merged with other actions of
+// the same kind so they run as a single command on the target, e.g. one package
+// manager invocation for several packages.
+type Batchable interface {
+	Action
+	// Batch merges the action with others, reporting false if any of them
+	// can't be merged. The merged action reports the results of the actions
+	// it was merged from in the same order.
+	Batch(others []Action) (Action, bool)
+	// BatchResults is the number of results the action reports, so that
+	// the results of a merged action can be told apart
+	BatchResults() int
+}
+
+// LoopItem is a single element a Loop is expanded over. For lists Key and
+// Value are both the element, for maps they hold the entry.
+type LoopItem struct {
+	Key   string
+	Value string
+}
+
+// Loop expands one action template over a list or map of items
+type Loop struct {
+	Name     string
+	Items    []LoopItem
+	Template func(LoopItem) Action
+}
+
+// ForEach expands template once for every item in the list
+func ForEach(name string, items []string, template func(item string) Action) *Loop {
+	loopItems := make([]LoopItem, 0, len(items))
+	for _, item := range items {
+		loopItems = append(loopItems, LoopItem{Key: item, Value: item})
+	}
+	return &Loop{
+		Name:  name,
+		Items: loopItems,
+		Template: func(item LoopItem) Action {
+			return template(item.Value)
+		},
+	}
+}
+
+// ForEachMap expands template once for every entry in the map, in key order
+func ForEachMap(name string, items map[string]string, template func(key, value string) Action) *Loop {
+	keys := make([]string, 0, len(items))
+	for key := range items {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	loopItems := make([]LoopItem, 0, len(items))
+	for _, key := range keys {
+		loopItems = append(loopItems, LoopItem{Key: key, Value: items[key]})
+	}
+	return &Loop{
+		Name:  name,
+		Items: loopItems,
+		Template: func(item LoopItem) Action {
+			return template(item.Key, item.Value)
+		},
+	}
+}
+
+// Expand returns the action produced by the template for each item
+func (l Loop) Expand() []Action {
+	actions := make([]Action, 0, len(l.Items))
+	for _, item := range l.Items {
+		actions = append(actions, l.Template(item))
+	}
+	return actions
+}
+
+// ItemID returns the identity an expansion is reported under
+func (l Loop) ItemID(item LoopItem) string {
+	return fmt.Sprintf("%s[%s]", l.Name, item.Key)
+}
+
+func (l Loop) Handle(ctx context.Context, ex Executor, os OS, observer ActionObserver) error {
+	return WithObserver(observer, func() error {
+		actions := l.Expand()
+		if len(actions) == 0 {
+			return nil
+		}
+
+		flattened, scopes := l.flatten(actions)
+		if batched, ok := batchFlattened(flattened); ok {
+			return batched.Handle(ctx, ex, os, sequenceObserver(observer, scopes, l.Name))
+		}
+
+		for i, action := range actions {
+			id := l.ItemID(l.Items[i])
+			if err := action.Handle(ctx, ex, os, scopeObserver(observer, id)); err != nil {
+				return fmt.Errorf("%s: %w", id, err)
+			}
+		}
+		return nil
+	})
+}
+
+// flatten flattens the loop's expansions, scoping their results under the
+// item each came from
+func (l Loop) flatten(actions []Action) ([]Action, []string) {
+	var flattened []Action
+	var scopes []string
+	for i, action := range actions {
+		id := l.ItemID(l.Items[i])
+		expanded, expandedScopes := flatten([]Action{action})
+		flattened = append(flattened, expanded...)
+		for _, scope := range expandedScopes {
+			if scope != "" {
+				scope = id + "/" + scope
+			} else {
+				scope = id
+			}
+			scopes = append(scopes, scope)
+		}
+	}
+	return flattened, scopes
+}
+
+// flatten expands the loops among actions so that their expansions can be
+// merged with neighbouring actions. It also returns the scope of every result
+// the flattened actions report, which is empty for actions outside loops, so
+// that batched results are reported the same way as unbatched ones.
+func flatten(actions []Action) ([]Action, []string) {
+	var flattened []Action
+	var scopes []string
+	for _, action := range actions {
+		if loop, ok := action.(*Loop); ok {
+			expanded, expandedScopes := loop.flatten(loop.Expand())
+			flattened = append(flattened, expanded...)
+			scopes = append(scopes, expandedScopes...)
+			continue
+		}
+		flattened = append(flattened, action)
+		count := 1
+		if batchable, ok := action.(Batchable); ok {
+			count = batchable.BatchResults()
+		}
+		for range count {
+			scopes = append(scopes, "")
+		}
+	}
+	return flattened, scopes
+}
+
+// BatchActions merges actions into a single action when all of them can be
+// batched together. Loops are expanded so that their expansions can be merged
+// with neighbouring actions.
+func BatchActions(actions []Action) (Action, bool) {
+	flattened, _ := flatten(actions)
+	return batchFlattened(flattened)
+}
+
+// batchFlattened merges actions that have already been flattened
+func batchFlattened(flattened []Action) (Action, bool) {
+	if len(flattened) < 2 {
+		return nil, false
+	}
+	first, ok := flattened[0].(Batchable)
+	if !ok {
+		return nil, false
+	}
+	return first.Batch(flattened[1:])
+}
+
+// scopedObserver prefixes the IDs of reported results so that each loop
+// expansion keeps its own identity.
+type scopedObserver struct {
+	ActionObserver
+	scope string
+}
+
+func scopeObserver(observer ActionObserver, scope string) ActionObserver {
+	if observer == nil {
+		return nil
+	}
+	return scopedObserver{ActionObserver: observer, scope: scope}
+}
+
+func (o scopedObserver) OnActionResult(result ActionResult) error {
+	result.ID = o.scope + "/" + result.ID
+	return ReportResult(o.ActionObserver, result)
+}
+
+// sequencedObserver scopes the results of a batched action, which reports
+// the results of the merged actions in order, under the identity of the
+// action each came from. Results beyond those fall back to the loop's scope,
+// and an empty scope leaves the result's ID as it is.
+type sequencedObserver struct {
+	ActionObserver
+	scopes   []string
+	fallback string
+	next     int
+}
+
+func sequenceObserver(observer ActionObserver, scopes []string, fallback string) ActionObserver {
+	if observer == nil {
+		return nil
+	}
+	return &sequencedObserver{ActionObserver: observer, scopes: scopes, fallback: fallback}
+}
+
+func (o *sequencedObserver) OnActionResult(result ActionResult) error {
+	scope := o.fallback
+	if o.next < len(o.scopes) {
+		scope = o.scopes[o.next]
+	}
+	o.next++
+	if scope != "" {
+		result.ID = scope + "/" + result.ID
+	}
+	return ReportResult(o.ActionObserver, result)
+}
+
+var _ Action = (*Loop)(nil)
@@ -0,0 +1,189 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
+func Test_ForEach_Expand(t *testing.T) {
+	loop := core.ForEach("things", []string{"a", "b", "c"}, func(item string) core.Action {
+		return &TestAction{name: item}
+	})
+
+	actions := loop.Expand()
+	if len(actions) != 3 {
+		t.Fatalf("Expected 3 expansions, got %d", len(actions))
+	}
+
+	for i, name := range []string{"a", "b", "c"} {
+		if actions[i].(*TestAction).name != name {
+			t.Fatalf("Expected expansion %d to be '%s', got '%s'", i, name, actions[i].(*TestAction).name)
+		}
+	}
+}
+
+func Test_ForEachMap_SortedKeys(t *testing.T) {
+	var seen []string
+	loop := core.ForEachMap("settings", map[string]string{"b": "2", "a": "1", "c": "3"}, func(key, value string) core.Action {
+		seen = append(seen, key+"="+value)
+		return &TestAction{name: key}
+	})
+	loop.Expand()
+
+	expected := []string{"a=1", "b=2", "c=3"}
+	if !slices.Equal(seen, expected) {
+		t.Fatalf("Expected expansions %v, got %v", expected, seen)
+	}
+}
+
+func Test_Loop_ReportsPerItemIdentity(t *testing.T) {
+	loop := core.ForEach("users", []string{"alice", "bob"}, func(item string) core.Action {
+		return &reportingAction{id: "user " + item}
+	})
+	observer := &core.TestObserver{}
+
+	if err := loop.Handle(context.Background(), &core.FakeExecutor{}, core.Ubuntu{}, observer); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := []string{"users[alice]/user alice", "users[bob]/user bob"}
+	if len(observer.Results) != len(expected) {
+		t.Fatalf("Expected %d results, got %d", len(expected), len(observer.Results))
+	}
+	for i, id := range expected {
+		if observer.Results[i].ID != id {
+			t.Fatalf("Expected result ID '%s', got '%s'", id, observer.Results[i].ID)
+		}
+	}
+}
+
+func Test_Loop_StopsOnError(t *testing.T) {
+	second := &TestAction{name: "b", err: errors.New("boom")}
+	third := &TestAction{name: "c"}
+	expansions := map[string]*TestAction{"a": {name: "a"}, "b": second, "c": third}
+	loop := core.ForEach("things", []string{"a", "b", "c"}, func(item string) core.Action {
+		return expansions[item]
+	})
+
+	err := loop.Handle(context.Background(), &core.FakeExecutor{}, core.Ubuntu{}, nil)
+	if err == nil || err.Error() != "things[b]: boom" {
+		t.Fatalf("Expected error from second expansion, got %v", err)
+	}
+	if third.executed {
+		t.Fatal("Expected loop to stop after failing expansion")
+	}
+}
+
+func Test_Loop_Batches(t *testing.T) {
+	loop := core.ForEach("words", []string{"a", "b", "c"}, func(item string) core.Action {
+		return &batchAction{items: []string{item}}
+	})
+	ex := &core.FakeExecutor{}
+
+	if err := loop.Handle(context.Background(), ex, core.Ubuntu{}, nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(ex.History) != 1 || ex.History[0] != "echo a b c" {
+		t.Fatalf("Expected a single batched command, got %v", ex.History)
+	}
+}
+
+func Test_Loop_BatchedReportsPerItemIdentity(t *testing.T) {
+	loop := core.ForEach("words", []string{"a", "b"}, func(item string) core.Action {
+		return &batchAction{items: []string{item}}
+	})
+	observer := &core.TestObserver{}
+
+	if err := loop.Handle(context.Background(), &core.FakeExecutor{}, core.Ubuntu{}, observer); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := []string{"words[a]/word a", "words[b]/word b"}
+	if len(observer.Results) != len(expected) {
+		t.Fatalf("Expected %d results, got %d", len(expected), len(observer.Results))
+	}
+	for i, id := range expected {
+		if observer.Results[i].ID != id {
+			t.Fatalf("Expected result ID '%s', got '%s'", id, observer.Results[i].ID)
+		}
+	}
+}
+
+// reportingAction reports a result with a fixed ID
+type reportingAction struct {
+	id string
+}
+
+func (a *reportingAction) Handle(ctx context.Context, ex core.Executor, os core.OS, observer core.ActionObserver) error {
+	return core.ReportResult(observer, core.ActionResult{ID: a.id, Changed: true})
+}
+
+// batchAction echoes its items and can be merged with other batchActions
+type batchAction struct {
+	items []string
+}
+
+func (a *batchAction) Handle(ctx context.Context, ex core.Executor, os core.OS, observer core.ActionObserver) error {
+	command := "echo"
+	for _, item := range a.items {
+		command += " " + item
+	}
+	if _, err := ex.Execute(ctx, command, observer); err != nil {
+		return err
+	}
+	for _, item := range a.items {
+		if err := core.ReportResult(observer, core.ActionResult{ID: "word " + item}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *batchAction) Batch(others []core.Action) (core.Action, bool) {
+	merged := &batchAction{items: a.items}
+	for _, other := range others {
+		b, ok := other.(*batchAction)
+		if !ok {
+			return nil, false
+		}
+		merged.items = append(merged.items, b.items...)
+	}
+	return merged, true
+}
+
+func (a *batchAction) BatchResults() int {
+	return len(a.items)
+}
+
+func Test_Recipe_BatchedLoopReportsPerItemIdentity(t *testing.T) {
+	recipe := core.NewBaseRecipe("words", "", []core.Action{
+		&batchAction{items: []string{"a"}},
+		core.ForEach("tools", []string{"b", "c"}, func(item string) core.Action {
+			return &batchAction{items: []string{item}}
+		}),
+	})
+	ex := &core.FakeExecutor{}
+	observer := &core.TestObserver{}
+
+	if err := recipe.Execute(context.Background(), ex, core.Ubuntu{}, observer); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(ex.History) != 1 || ex.History[0] != "echo a b c" {
+		t.Fatalf("Expected a single batched command, got %v", ex.History)
+	}
+	expected := []string{"word a", "tools[b]/word b", "tools[c]/word c"}
+	if len(observer.Results) != len(expected) {
+		t.Fatalf("Expected %d results, got %d", len(expected), len(observer.Results))
+	}
+	for i, id := range expected {
+		if observer.Results[i].ID != id {
+			t.Fatalf("Expected result ID '%s', got '%s'", id, observer.Results[i].ID)
+		}
+	}
+}
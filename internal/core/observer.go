@@ -5,3 +5,27 @@ type ExecutionObserver interface {
 	OnExecutionOutput(output string) error
 	OnExecutionEnd() error
 }
+
+// ResultObserver is an optional extension of ActionObserver for observers that
+// want to know the outcome of each unit of work. Actions report through
+// ReportResult, which ignores observers that don't implement it.
+type ResultObserver interface {
+	OnActionResult(result ActionResult) error
+}
+
+// ActionResult describes the outcome of a single unit of work on the target.
+type ActionResult struct {
+	ID      string
+	Changed bool
+	// Before and After optionally describe what changed, e.g. the old and
+	// new commit of a checkout
+	Before string
+	After  string
+}
+
+func ReportResult(observer ExecutionObserver, result ActionResult) error {
+	if r, ok := observer.(ResultObserver); ok {
+		return r.OnActionResult(result)
+	}
+	return nil
+}
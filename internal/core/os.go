@@ -2,6 +2,8 @@ package core
 
 import (
 	"fmt"
+	"regexp"
+	"strings"
 )
 
 // systemdServiceManager provides common systemctl-based service management
@@ -23,43 +25,276 @@ func (sm systemdServiceManager) RestartService(serviceName string) string {
 	return fmt.Sprintf("systemctl restart %s", serviceName)
 }
 
+func (sm systemdServiceManager) DisableService(serviceName string) string {
+	return fmt.Sprintf("systemctl disable %s", serviceName)
+}
+
+func (sm systemdServiceManager) MaskService(serviceName string) string {
+	return fmt.Sprintf("systemctl mask %s", serviceName)
+}
+
+func (sm systemdServiceManager) UnmaskService(serviceName string) string {
+	return fmt.Sprintf("systemctl unmask %s", serviceName)
+}
+
+// ServiceActive prints the service's active state, e.g. active or failed. It
+// exits non-zero unless the service is active.
+func (sm systemdServiceManager) ServiceActive(serviceName string) string {
+	return fmt.Sprintf("systemctl is-active %s", serviceName)
+}
+
+// ServiceEnabled prints the service's enablement state, e.g. enabled, disabled
+// or masked. It exits non-zero unless the service is enabled.
+func (sm systemdServiceManager) ServiceEnabled(serviceName string) string {
+	return fmt.Sprintf("systemctl is-enabled %s", serviceName)
+}
+
+// ServiceLogs prints the last lines of the service's journal
+func (sm systemdServiceManager) ServiceLogs(serviceName string, lines int) string {
+	return fmt.Sprintf("journalctl -u %s -n %d --no-pager", serviceName, lines)
+}
+
+// ServiceUnitPath returns where a locally authored unit file is installed
+func (sm systemdServiceManager) ServiceUnitPath(unitName string) string {
+	return fmt.Sprintf("/etc/systemd/system/%s", unitName)
+}
+
+// ReloadServices makes the service manager pick up changed unit files
+func (sm systemdServiceManager) ReloadServices() string {
+	return "systemctl daemon-reload"
+}
+
+// UpgradeMode selects how far a package upgrade is allowed to go
+type UpgradeMode int
+
+const (
+	// UpgradeSafe upgrades installed packages without removing any or
+	// installing new dependencies
+	UpgradeSafe UpgradeMode = iota
+	// UpgradeDist also installs and removes packages as dependencies change
+	UpgradeDist
+)
+
 type OS interface {
-	CreateUser(username string) string
+	CreateUser(user User) string
+	ModifyUser(user User) string
+	RemoveUser(username string, removeHome bool) string
+	LockUser(username string) string
+	UnlockUser(username string) string
 	CheckUser(username string) string
+	CheckUserGroups(username string) string
+	CheckUserPassword(username string) string
 	GroupUser(username string, group string) string
+	CreateGroup(group Group) string
+	ModifyGroup(group Group) string
+	RemoveGroup(name string) string
+	CheckGroup(name string) string
 	InstallPackage(packageName string) string
+	InstallPackages(packageNames ...string) string
+	CheckPackage(packageName string) string
+	PackageSpec(packageName string, version string) string
+	HoldPackages(packageNames ...string) string
+	UnholdPackages(packageNames ...string) string
+	HeldPackages() string
 	RemovePackage(packageName string) string
-	UpdatePackages() string
+	RefreshPackageCache() string
+	PackageCacheAge() string
+	UpgradePackages(mode UpgradeMode, heldPackages ...string) string
+	RepositoryPath(name string) string
+	RepositoryKeyPath(name string) string
+	RenderRepository(repo PackageRepository) string
+	ValidateRepository(repo PackageRepository) error
+	SELinuxEnabled() string
+	FileContext(path string) string
+	SetFileContext(path string, contextType string, recursive bool) string
 	StartService(serviceName string) string
 	StopService(serviceName string) string
 	EnableService(serviceName string) string
 	RestartService(serviceName string) string
+	DisableService(serviceName string) string
+	MaskService(serviceName string) string
+	UnmaskService(serviceName string) string
+	ServiceActive(serviceName string) string
+	ServiceEnabled(serviceName string) string
+	ServiceLogs(serviceName string, lines int) string
+	ServiceUnitPath(unitName string) string
+	ReloadServices() string
+	Firewall() Firewall
+	Hostname() string
+	SetHostname(name string) string
+	Timezone() string
+	SetTimezone(timezone string) string
+	Locale() string
+	LocaleAvailable(locale string) string
+	GenerateLocale(locale string) string
+	SetLocale(locale string) string
+	WebServer(kind WebServerKind) WebServer
 }
 
 type DebianFamily struct{}
 
-func (os DebianFamily) CreateUser(username string) string {
-	return fmt.Sprintf("adduser %s", username)
+func (os DebianFamily) CreateUser(user User) string {
+	return shadowUserManager{}.CreateUser(user)
+}
+
+func (os DebianFamily) ModifyUser(user User) string {
+	return shadowUserManager{}.ModifyUser(user)
+}
+
+func (os DebianFamily) RemoveUser(username string, removeHome bool) string {
+	return shadowUserManager{}.RemoveUser(username, removeHome)
+}
+
+func (os DebianFamily) LockUser(username string) string {
+	return shadowUserManager{}.LockUser(username)
+}
+
+func (os DebianFamily) UnlockUser(username string) string {
+	return shadowUserManager{}.UnlockUser(username)
 }
 
 func (os DebianFamily) CheckUser(username string) string {
-	return fmt.Sprintf("id -u %s", username)
+	return shadowUserManager{}.CheckUser(username)
+}
+
+func (os DebianFamily) CheckUserGroups(username string) string {
+	return shadowUserManager{}.CheckUserGroups(username)
+}
+
+func (os DebianFamily) CheckUserPassword(username string) string {
+	return shadowUserManager{}.CheckUserPassword(username)
 }
 
 func (os DebianFamily) GroupUser(username string, group string) string {
 	return fmt.Sprintf("usermod -aG %s %s", group, username)
 }
 
+func (os DebianFamily) CreateGroup(group Group) string {
+	return shadowGroupManager{}.CreateGroup(group)
+}
+
+func (os DebianFamily) ModifyGroup(group Group) string {
+	return shadowGroupManager{}.ModifyGroup(group)
+}
+
+func (os DebianFamily) RemoveGroup(name string) string {
+	return shadowGroupManager{}.RemoveGroup(name)
+}
+
+func (os DebianFamily) CheckGroup(name string) string {
+	return shadowGroupManager{}.CheckGroup(name)
+}
+
 func (os DebianFamily) InstallPackage(packageName string) string {
-	return fmt.Sprintf("apt-get install -y %s", packageName)
+	return os.InstallPackages(packageName)
+}
+
+// InstallPackages installs the packages, which may be version specs from
+// PackageSpec. A pinned version older than the installed one is downgraded
+// to, which apt refuses without --allow-downgrades.
+func (os DebianFamily) InstallPackages(packageNames ...string) string {
+	for _, name := range packageNames {
+		if strings.Contains(name, "=") {
+			return fmt.Sprintf("apt-get install -y --allow-downgrades %s", strings.Join(packageNames, " "))
+		}
+	}
+	return fmt.Sprintf("apt-get install -y %s", strings.Join(packageNames, " "))
+}
+
+// CheckPackage prints the installed version of the package, or nothing if it
+// isn't installed
+func (os DebianFamily) CheckPackage(packageName string) string {
+	return fmt.Sprintf("dpkg-query -W -f='${db:Status-Abbrev} ${Version}\\n' %s 2>/dev/null | awk '/^ii/ {print $2}'", packageName)
+}
+
+// PackageSpec returns the argument that selects a version of the package, e.g.
+// 'nginx=1.24.*', quoted so the shell doesn't expand the wildcard
+func (os DebianFamily) PackageSpec(packageName string, version string) string {
+	if version == "" {
+		return ShellQuote(packageName)
+	}
+	return ShellQuote(packageName + "=" + version)
+}
+
+func (os DebianFamily) HoldPackages(packageNames ...string) string {
+	return fmt.Sprintf("apt-mark hold %s", strings.Join(packageNames, " "))
+}
+
+func (os DebianFamily) UnholdPackages(packageNames ...string) string {
+	return fmt.Sprintf("apt-mark unhold %s", strings.Join(packageNames, " "))
+}
+
+// HeldPackages prints the names of held packages, one per line
+func (os DebianFamily) HeldPackages() string {
+	return "apt-mark showhold"
 }
 
 func (os DebianFamily) RemovePackage(packageName string) string {
 	return fmt.Sprintf("apt-get remove -y %s", packageName)
 }
 
-func (os DebianFamily) UpdatePackages() string {
-	return "apt-get update && apt-get upgrade -y"
+func (os DebianFamily) RefreshPackageCache() string {
+	return "apt-get update"
+}
+
+// PackageCacheAge prints the number of seconds since the package lists were
+// last refreshed. apt-get update rebuilds pkgcache.bin and, with
+// update-notifier-common, touches the periodic stamp even when no list
+// changed, which the lists directory's mtime doesn't reflect.
+func (os DebianFamily) PackageCacheAge() string {
+	return newestFileAge("/var/lib/apt/periodic/update-success-stamp", "/var/cache/apt/pkgcache.bin")
+}
+
+// UpgradePackages upgrades installed packages. Held packages are put on hold
+// for the duration of the upgrade only, and packages that were already on
+// hold before it, e.g. through InstallPackage's hold, stay on hold.
+func (os DebianFamily) UpgradePackages(mode UpgradeMode, heldPackages ...string) string {
+	command := "apt-get upgrade -y"
+	if mode == UpgradeDist {
+		command = "apt-get dist-upgrade -y"
+	}
+	if len(heldPackages) == 0 {
+		return command
+	}
+
+	quoted := make([]string, len(heldPackages))
+	for i, name := range heldPackages {
+		quoted[i] = ShellQuote(name)
+	}
+	held := strings.Join(quoted, " ")
+	return fmt.Sprintf("release=$(for p in %s; do apt-mark showhold | grep -qxF \"$p\" || echo \"$p\"; done); apt-mark hold %s && %s; status=$?; [ -z \"$release\" ] || apt-mark unhold $release; exit $status", held, held, command)
+}
+
+func (os DebianFamily) RepositoryPath(name string) string {
+	return fmt.Sprintf("/etc/apt/sources.list.d/%s.sources", name)
+}
+
+func (os DebianFamily) RepositoryKeyPath(name string) string {
+	return fmt.Sprintf("/etc/apt/keyrings/%s.asc", name)
+}
+
+func (os DebianFamily) RenderRepository(repo PackageRepository) string {
+	return renderDeb822Source(repo)
+}
+
+func (os DebianFamily) ValidateRepository(repo PackageRepository) error {
+	return validateDeb822Source(repo)
+}
+
+// SELinuxEnabled returns no command, as SELinux isn't used on Debian-family
+// hosts
+func (os DebianFamily) SELinuxEnabled() string {
+	return ""
+}
+
+// FileContext returns no command, as SELinux isn't used on Debian-family
+// hosts
+func (os DebianFamily) FileContext(path string) string {
+	return ""
+}
+
+func (os DebianFamily) SetFileContext(path string, contextType string, recursive bool) string {
+	return ""
 }
 
 func (os DebianFamily) StartService(serviceName string) string {
@@ -78,33 +313,262 @@ func (os DebianFamily) RestartService(serviceName string) string {
 	return systemdServiceManager{}.RestartService(serviceName)
 }
 
+func (os DebianFamily) DisableService(serviceName string) string {
+	return systemdServiceManager{}.DisableService(serviceName)
+}
+
+func (os DebianFamily) MaskService(serviceName string) string {
+	return systemdServiceManager{}.MaskService(serviceName)
+}
+
+func (os DebianFamily) UnmaskService(serviceName string) string {
+	return systemdServiceManager{}.UnmaskService(serviceName)
+}
+
+func (os DebianFamily) ServiceActive(serviceName string) string {
+	return systemdServiceManager{}.ServiceActive(serviceName)
+}
+
+func (os DebianFamily) ServiceEnabled(serviceName string) string {
+	return systemdServiceManager{}.ServiceEnabled(serviceName)
+}
+
+func (os DebianFamily) ServiceLogs(serviceName string, lines int) string {
+	return systemdServiceManager{}.ServiceLogs(serviceName, lines)
+}
+
+func (os DebianFamily) ServiceUnitPath(unitName string) string {
+	return systemdServiceManager{}.ServiceUnitPath(unitName)
+}
+
+func (os DebianFamily) ReloadServices() string {
+	return systemdServiceManager{}.ReloadServices()
+}
+
+func (os DebianFamily) Firewall() Firewall {
+	return UfwFirewall{}
+}
+
+func (os DebianFamily) Hostname() string {
+	return systemSettingsManager{}.Hostname()
+}
+
+func (os DebianFamily) SetHostname(name string) string {
+	return systemSettingsManager{}.SetHostname(name)
+}
+
+func (os DebianFamily) Timezone() string {
+	return systemSettingsManager{}.Timezone()
+}
+
+// SetTimezone also writes /etc/timezone without systemd, which Debian keeps
+// in step with /etc/localtime
+func (os DebianFamily) SetTimezone(timezone string) string {
+	return systemSettingsManager{}.setTimezone(timezone, fmt.Sprintf("echo %s > /etc/timezone", ShellQuote(timezone)))
+}
+
+// Locale prints the system locale, e.g. en_US.UTF-8
+func (os DebianFamily) Locale() string {
+	return systemSettingsManager{}.localeSetting("/etc/default/locale")
+}
+
+func (os DebianFamily) LocaleAvailable(locale string) string {
+	return systemSettingsManager{}.LocaleAvailable(locale)
+}
+
+// GenerateLocale adds the locale to /etc/locale.gen and compiles it, which
+// needs the locales package
+func (os DebianFamily) GenerateLocale(locale string) string {
+	charset := "ISO-8859-1"
+	if _, c, found := strings.Cut(locale, "."); found {
+		charset = c
+	}
+	return fmt.Sprintf("(grep -q %s /etc/locale.gen || echo %s >> /etc/locale.gen) && locale-gen",
+		ShellQuote("^"+locale+" "), ShellQuote(locale+" "+charset))
+}
+
+func (os DebianFamily) SetLocale(locale string) string {
+	setting := ShellQuote("LANG=" + locale)
+	return withSystemd("localectl set-locale "+setting, "update-locale "+setting)
+}
+
+func (os DebianFamily) WebServer(kind WebServerKind) WebServer {
+	if kind == Apache {
+		return WebServer{Kind: Apache, Service: "apache2", SitesDir: "/etc/apache2/sites-available", EnabledDir: "/etc/apache2/sites-enabled"}
+	}
+	return WebServer{Kind: Nginx, Service: "nginx", SitesDir: "/etc/nginx/sites-available", EnabledDir: "/etc/nginx/sites-enabled"}
+}
+
+// newestFileAge prints the number of seconds since the newest of the files,
+// which may be globs, was modified. It fails if none of them exists.
+func newestFileAge(paths ...string) string {
+	return fmt.Sprintf("echo $(( $(date +%%s) - $(stat -c %%Y %s 2>/dev/null | sort -n | tail -1) ))", strings.Join(paths, " "))
+}
+
 type Ubuntu struct{ DebianFamily }
 type Debian struct{ DebianFamily }
 
 type FedoraFamily struct{}
 
-func (os FedoraFamily) CreateUser(username string) string {
-	return fmt.Sprintf("useradd %s", username)
+func (os FedoraFamily) CreateUser(user User) string {
+	return shadowUserManager{}.CreateUser(user)
+}
+
+func (os FedoraFamily) ModifyUser(user User) string {
+	return shadowUserManager{}.ModifyUser(user)
+}
+
+func (os FedoraFamily) RemoveUser(username string, removeHome bool) string {
+	return shadowUserManager{}.RemoveUser(username, removeHome)
+}
+
+func (os FedoraFamily) LockUser(username string) string {
+	return shadowUserManager{}.LockUser(username)
+}
+
+func (os FedoraFamily) UnlockUser(username string) string {
+	return shadowUserManager{}.UnlockUser(username)
 }
 
 func (os FedoraFamily) CheckUser(username string) string {
-	return fmt.Sprintf("id -u %s", username)
+	return shadowUserManager{}.CheckUser(username)
+}
+
+func (os FedoraFamily) CheckUserGroups(username string) string {
+	return shadowUserManager{}.CheckUserGroups(username)
+}
+
+func (os FedoraFamily) CheckUserPassword(username string) string {
+	return shadowUserManager{}.CheckUserPassword(username)
 }
 
 func (os FedoraFamily) GroupUser(username string, group string) string {
 	return fmt.Sprintf("usermod -aG %s %s", group, username)
 }
 
+func (os FedoraFamily) CreateGroup(group Group) string {
+	return shadowGroupManager{}.CreateGroup(group)
+}
+
+func (os FedoraFamily) ModifyGroup(group Group) string {
+	return shadowGroupManager{}.ModifyGroup(group)
+}
+
+func (os FedoraFamily) RemoveGroup(name string) string {
+	return shadowGroupManager{}.RemoveGroup(name)
+}
+
+func (os FedoraFamily) CheckGroup(name string) string {
+	return shadowGroupManager{}.CheckGroup(name)
+}
+
 func (os FedoraFamily) InstallPackage(packageName string) string {
-	return fmt.Sprintf("dnf install -y %s", packageName)
+	return os.InstallPackages(packageName)
+}
+
+func (os FedoraFamily) InstallPackages(packageNames ...string) string {
+	return fmt.Sprintf("dnf install -y %s", strings.Join(packageNames, " "))
+}
+
+// CheckPackage prints the installed version of the package, or fails if it
+// isn't installed
+func (os FedoraFamily) CheckPackage(packageName string) string {
+	return fmt.Sprintf("rpm -q --qf '%%{VERSION}-%%{RELEASE}\\n' %s", packageName)
+}
+
+// PackageSpec returns the argument that selects a version of the package, e.g.
+// nginx-1.24.0
+func (os FedoraFamily) PackageSpec(packageName string, version string) string {
+	if version == "" {
+		return ShellQuote(packageName)
+	}
+	return ShellQuote(packageName + "-" + version)
+}
+
+// HoldPackages locks the packages at their installed version. It needs the
+// dnf versionlock plugin.
+func (os FedoraFamily) HoldPackages(packageNames ...string) string {
+	return fmt.Sprintf("dnf versionlock add %s", strings.Join(packageNames, " "))
+}
+
+func (os FedoraFamily) UnholdPackages(packageNames ...string) string {
+	return fmt.Sprintf("dnf versionlock delete %s", strings.Join(packageNames, " "))
+}
+
+// HeldPackages prints the locked packages, one per line, as name-epoch:version
+func (os FedoraFamily) HeldPackages() string {
+	return "dnf versionlock list"
 }
 
 func (os FedoraFamily) RemovePackage(packageName string) string {
 	return fmt.Sprintf("dnf remove -y %s", packageName)
 }
 
-func (os FedoraFamily) UpdatePackages() string {
-	return "dnf update -y"
+func (os FedoraFamily) RefreshPackageCache() string {
+	return "dnf makecache"
+}
+
+// PackageCacheAge prints the number of seconds since the package metadata was
+// last refreshed, going by the newest repository metadata of dnf or dnf5
+func (os FedoraFamily) PackageCacheAge() string {
+	return newestFileAge("/var/cache/dnf/*/repodata/repomd.xml", "/var/cache/libdnf5/*/repodata/repomd.xml")
+}
+
+// UpgradePackages upgrades installed packages, excluding held packages from
+// the transaction
+func (os FedoraFamily) UpgradePackages(mode UpgradeMode, heldPackages ...string) string {
+	command := "dnf upgrade -y"
+	if mode == UpgradeDist {
+		command = "dnf distro-sync -y"
+	}
+	for _, name := range heldPackages {
+		command += " --exclude=" + name
+	}
+	return command
+}
+
+func (os FedoraFamily) RepositoryPath(name string) string {
+	return fmt.Sprintf("/etc/yum.repos.d/%s.repo", name)
+}
+
+func (os FedoraFamily) RepositoryKeyPath(name string) string {
+	return fmt.Sprintf("/etc/pki/rpm-gpg/RPM-GPG-KEY-%s", name)
+}
+
+func (os FedoraFamily) RenderRepository(repo PackageRepository) string {
+	return renderDnfRepo(repo)
+}
+
+// ValidateRepository accepts any repository with URIs, as DNF doesn't use
+// suites or components
+func (os FedoraFamily) ValidateRepository(repo PackageRepository) error {
+	return nil
+}
+
+// SELinuxEnabled fails unless SELinux is enabled. With it disabled, file
+// contexts read as ? and semanage can't change them.
+func (os FedoraFamily) SELinuxEnabled() string {
+	return "selinuxenabled"
+}
+
+// FileContext prints the SELinux context of path, e.g.
+// system_u:object_r:httpd_sys_content_t:s0
+func (os FedoraFamily) FileContext(path string) string {
+	return fmt.Sprintf("stat -c %%C %s", ShellQuote(path))
+}
+
+// SetFileContext records the SELinux type of path in the local file context
+// policy and relabels it, so the type survives a relabel of the file system.
+// An existing rule for the path is modified instead. It needs semanage from
+// policycoreutils-python-utils, which matches rules as regular expressions, so
+// the path is escaped.
+func (os FedoraFamily) SetFileContext(path string, contextType string, recursive bool) string {
+	spec, restorecon := regexp.QuoteMeta(path), "restorecon"
+	if recursive {
+		spec, restorecon = spec+"(/.*)?", "restorecon -R"
+	}
+	rule := fmt.Sprintf("-t %s %s", ShellQuote(contextType), ShellQuote(spec))
+	return fmt.Sprintf("{ semanage fcontext -a %s 2>/dev/null || semanage fcontext -m %s; } && %s %s", rule, rule, restorecon, ShellQuote(path))
 }
 
 func (os FedoraFamily) StartService(serviceName string) string {
@@ -123,5 +587,86 @@ func (os FedoraFamily) RestartService(serviceName string) string {
 	return systemdServiceManager{}.RestartService(serviceName)
 }
 
+func (os FedoraFamily) DisableService(serviceName string) string {
+	return systemdServiceManager{}.DisableService(serviceName)
+}
+
+func (os FedoraFamily) MaskService(serviceName string) string {
+	return systemdServiceManager{}.MaskService(serviceName)
+}
+
+func (os FedoraFamily) UnmaskService(serviceName string) string {
+	return systemdServiceManager{}.UnmaskService(serviceName)
+}
+
+func (os FedoraFamily) ServiceActive(serviceName string) string {
+	return systemdServiceManager{}.ServiceActive(serviceName)
+}
+
+func (os FedoraFamily) ServiceEnabled(serviceName string) string {
+	return systemdServiceManager{}.ServiceEnabled(serviceName)
+}
+
+func (os FedoraFamily) ServiceLogs(serviceName string, lines int) string {
+	return systemdServiceManager{}.ServiceLogs(serviceName, lines)
+}
+
+func (os FedoraFamily) ServiceUnitPath(unitName string) string {
+	return systemdServiceManager{}.ServiceUnitPath(unitName)
+}
+
+func (os FedoraFamily) ReloadServices() string {
+	return systemdServiceManager{}.ReloadServices()
+}
+
+func (os FedoraFamily) Firewall() Firewall {
+	return FirewalldFirewall{}
+}
+
+func (os FedoraFamily) Hostname() string {
+	return systemSettingsManager{}.Hostname()
+}
+
+func (os FedoraFamily) SetHostname(name string) string {
+	return systemSettingsManager{}.SetHostname(name)
+}
+
+func (os FedoraFamily) Timezone() string {
+	return systemSettingsManager{}.Timezone()
+}
+
+func (os FedoraFamily) SetTimezone(timezone string) string {
+	return systemSettingsManager{}.setTimezone(timezone, "")
+}
+
+// Locale prints the system locale, e.g. en_US.UTF-8
+func (os FedoraFamily) Locale() string {
+	return systemSettingsManager{}.localeSetting("/etc/locale.conf")
+}
+
+func (os FedoraFamily) LocaleAvailable(locale string) string {
+	return systemSettingsManager{}.LocaleAvailable(locale)
+}
+
+// GenerateLocale installs the language pack with the locale, as Fedora ships
+// locales precompiled
+func (os FedoraFamily) GenerateLocale(locale string) string {
+	language, _, _ := strings.Cut(locale, "_")
+	language, _, _ = strings.Cut(language, ".")
+	return os.InstallPackages("glibc-langpack-" + strings.ToLower(language))
+}
+
+func (os FedoraFamily) SetLocale(locale string) string {
+	setting := ShellQuote("LANG=" + locale)
+	return withSystemd("localectl set-locale "+setting, "echo "+setting+" > /etc/locale.conf")
+}
+
+func (os FedoraFamily) WebServer(kind WebServerKind) WebServer {
+	if kind == Apache {
+		return WebServer{Kind: Apache, Service: "httpd", SitesDir: "/etc/httpd/conf.d"}
+	}
+	return WebServer{Kind: Nginx, Service: "nginx", SitesDir: "/etc/nginx/conf.d"}
+}
+
 type Fedora struct{ FedoraFamily }
 type RedHat struct{ FedoraFamily }
@@ -4,32 +4,175 @@ import "testing"
 
 func Test_UbuntuCreateUser(t *testing.T) {
 	os := Ubuntu{}
-	command := os.CreateUser("john")
-	if command != "adduser john" {
+	command := os.CreateUser(User{Name: "john"})
+	if command != "useradd -m john" {
 		t.Fatalf("malformed command: %v", os)
 	}
 }
 
 func Test_DebianCreateUser(t *testing.T) {
 	os := Debian{}
-	command := os.CreateUser("john")
-	if command != "adduser john" {
+	command := os.CreateUser(User{Name: "john"})
+	if command != "useradd -m john" {
 		t.Fatalf("malformed command: %v", os)
 	}
 }
 
 func Test_FedoraCreateUser(t *testing.T) {
 	os := Fedora{}
-	command := os.CreateUser("john")
-	if command != "useradd john" {
+	command := os.CreateUser(User{Name: "john"})
+	if command != "useradd -m john" {
 		t.Fatalf("malformed command: %v", os)
 	}
 }
 
 func Test_RedHatCreateUser(t *testing.T) {
 	os := RedHat{}
-	command := os.CreateUser("john")
-	if command != "useradd john" {
+	command := os.CreateUser(User{Name: "john"})
+	if command != "useradd -m john" {
 		t.Fatalf("malformed command: %v", os)
 	}
 }
+
+func Test_DebianUpgradePackages(t *testing.T) {
+	os := Debian{}
+	command := os.UpgradePackages(UpgradeDist, "nginx", "mysql-server")
+	expected := `release=$(for p in nginx mysql-server; do apt-mark showhold | grep -qxF "$p" || echo "$p"; done); apt-mark hold nginx mysql-server && apt-get dist-upgrade -y; status=$?; [ -z "$release" ] || apt-mark unhold $release; exit $status`
+	if command != expected {
+		t.Fatalf("malformed command: %s", command)
+	}
+}
+
+func Test_FedoraUpgradePackages(t *testing.T) {
+	os := Fedora{}
+	command := os.UpgradePackages(UpgradeSafe, "nginx")
+	if command != "dnf upgrade -y --exclude=nginx" {
+		t.Fatalf("malformed command: %s", command)
+	}
+}
+
+func Test_DebianRenderRepository(t *testing.T) {
+	os := Debian{}
+	repo := PackageRepository{
+		Name:       "pgdg",
+		URIs:       []string{"https://apt.postgresql.org/pub/repos/apt"},
+		Suites:     []string{"bookworm-pgdg"},
+		Components: []string{"main"},
+		KeyPath:    os.RepositoryKeyPath("pgdg"),
+	}
+	expected := "Types: deb\nURIs: https://apt.postgresql.org/pub/repos/apt\nSuites: bookworm-pgdg\nComponents: main\nSigned-By: /etc/apt/keyrings/pgdg.asc\n"
+	if content := os.RenderRepository(repo); content != expected {
+		t.Fatalf("malformed repository:\n%s", content)
+	}
+}
+
+func Test_FedoraRenderRepository(t *testing.T) {
+	os := Fedora{}
+	repo := PackageRepository{
+		Name:    "nodesource",
+		URIs:    []string{"https://rpm.nodesource.com/pub_20.x/nodistro/nodejs/$basearch"},
+		KeyPath: os.RepositoryKeyPath("nodesource"),
+	}
+	expected := "[nodesource]\nname=nodesource\nbaseurl=https://rpm.nodesource.com/pub_20.x/nodistro/nodejs/$basearch\nenabled=1\ngpgcheck=1\ngpgkey=file:///etc/pki/rpm-gpg/RPM-GPG-KEY-nodesource\n"
+	if content := os.RenderRepository(repo); content != expected {
+		t.Fatalf("malformed repository:\n%s", content)
+	}
+}
+
+func Test_PackageSpec(t *testing.T) {
+	if spec := (Debian{}).PackageSpec("nginx", "1.24.*"); spec != "'nginx=1.24.*'" {
+		t.Fatalf("malformed package spec: %s", spec)
+	}
+	if spec := (Fedora{}).PackageSpec("nginx", "1.24.0"); spec != "nginx-1.24.0" {
+		t.Fatalf("malformed package spec: %s", spec)
+	}
+	if spec := (Fedora{}).PackageSpec("nginx", "1.24.*"); spec != "'nginx-1.24.*'" {
+		t.Fatalf("package spec should be quoted: %s", spec)
+	}
+}
+
+func Test_SetFileContext(t *testing.T) {
+	expected := "{ semanage fcontext -a -t httpd_sys_content_t '/srv/www(/.*)?' 2>/dev/null || semanage fcontext -m -t httpd_sys_content_t '/srv/www(/.*)?'; } && restorecon -R /srv/www"
+	if command := (Fedora{}).SetFileContext("/srv/www", "httpd_sys_content_t", true); command != expected {
+		t.Fatalf("unexpected command: %s", command)
+	}
+	expected = "{ semanage fcontext -a -t httpd_sys_content_t '/srv/www\\.example\\.com' 2>/dev/null || semanage fcontext -m -t httpd_sys_content_t '/srv/www\\.example\\.com'; } && restorecon /srv/www.example.com"
+	if command := (Fedora{}).SetFileContext("/srv/www.example.com", "httpd_sys_content_t", false); command != expected {
+		t.Fatalf("path should be escaped for semanage: %s", command)
+	}
+	if command := (Debian{}).SetFileContext("/srv/www", "httpd_sys_content_t", true); command != "" {
+		t.Fatalf("should not label files without SELinux: %s", command)
+	}
+}
+
+func Test_CreateUserOptions(t *testing.T) {
+	os := Debian{}
+	uid := 1500
+	command := os.CreateUser(User{
+		Name:    "deploy",
+		UID:     &uid,
+		Group:   "deploy",
+		Groups:  []string{"www-data", "adm"},
+		Shell:   "/bin/bash",
+		Comment: "Deploy User",
+		Expires: "never",
+	})
+	expected := "useradd -m -u 1500 -g deploy -G www-data,adm -s /bin/bash -c 'Deploy User' -e '' deploy"
+	if command != expected {
+		t.Fatalf("malformed command: %s", command)
+	}
+}
+
+func Test_ModifyUserAppendGroups(t *testing.T) {
+	os := Fedora{}
+	command := os.ModifyUser(User{Name: "deploy", Groups: []string{"wheel"}, AppendGroups: true})
+	if command != "usermod -a -G wheel deploy" {
+		t.Fatalf("malformed command: %s", command)
+	}
+}
+
+func Test_ServiceUnitPath(t *testing.T) {
+	for _, os := range []OS{Ubuntu{}, Fedora{}} {
+		if path := os.ServiceUnitPath("app.service"); path != "/etc/systemd/system/app.service" {
+			t.Errorf("unexpected unit path: %s", path)
+		}
+		if command := os.ReloadServices(); command != "systemctl daemon-reload" {
+			t.Errorf("unexpected reload command: %s", command)
+		}
+	}
+}
+
+func Test_SystemSettingsFallBackWithoutSystemd(t *testing.T) {
+	tests := map[string]string{
+		Debian{}.SetTimezone("Europe/Berlin"):   "if [ -d /run/systemd/system ]; then timedatectl set-timezone Europe/Berlin; else test -f /usr/share/zoneinfo/Europe/Berlin && ln -sf /usr/share/zoneinfo/Europe/Berlin /etc/localtime && echo Europe/Berlin > /etc/timezone; fi",
+		Ubuntu{}.Hostname():                     "if [ -d /run/systemd/system ]; then hostnamectl --static; else cat /etc/hostname 2>/dev/null || true; fi",
+		Fedora{}.SetLocale("en_US.UTF-8"):       "if [ -d /run/systemd/system ]; then localectl set-locale LANG=en_US.UTF-8; else echo LANG=en_US.UTF-8 > /etc/locale.conf; fi",
+		Debian{}.GenerateLocale("de_DE.UTF-8"):  "(grep -q '^de_DE.UTF-8 ' /etc/locale.gen || echo 'de_DE.UTF-8 UTF-8' >> /etc/locale.gen) && locale-gen",
+		Fedora{}.GenerateLocale("de_DE.UTF-8"):  "dnf install -y glibc-langpack-de",
+		Ubuntu{}.LocaleAvailable("en_US.UTF-8"): "locale -a | grep -qixF en_US.utf8",
+	}
+	for command, expected := range tests {
+		if command != expected {
+			t.Errorf("expected %q, got %q", expected, command)
+		}
+	}
+}
+
+func Test_WebServerLayout(t *testing.T) {
+	tests := []struct{ command, expected string }{
+		{Ubuntu{}.WebServer(Nginx).SitePath("app"), "/etc/nginx/sites-available/app.conf"},
+		{Ubuntu{}.WebServer(Nginx).EnableSite("app"), "ln -sfn /etc/nginx/sites-available/app.conf /etc/nginx/sites-enabled/app.conf"},
+		{Debian{}.WebServer(Apache).EnableSite("app"), "a2ensite -q app"},
+		{Debian{}.WebServer(Apache).EnableModules("ssl"), "a2enmod -q ssl"},
+		{Fedora{}.WebServer(Apache).SitePath("app"), "/etc/httpd/conf.d/app.conf"},
+		{Fedora{}.WebServer(Apache).EnableSite("app"), ""},
+		{Fedora{}.WebServer(Apache).EnableModules("ssl"), ""},
+		{Fedora{}.WebServer(Apache).Reload(), "systemctl reload httpd"},
+		{RedHat{}.WebServer(Nginx).SitePath("app"), "/etc/nginx/conf.d/app.conf"},
+	}
+	for _, test := range tests {
+		if test.command != test.expected {
+			t.Errorf("expected %q, got %q", test.expected, test.command)
+		}
+	}
+}
@@ -39,13 +39,44 @@ func (r BaseRecipe) Actions() []Action {
 	return r.actions
 }
 
+// Execute runs the recipe's actions in order. Consecutive actions that can be
+// batched together, such as package installs, are coalesced into one. Handlers
+// notified along the way run once all actions have succeeded.
 func (r BaseRecipe) Execute(ctx context.Context, ex Executor, os OS, observer ActionObserver) error {
-	for _, action := range r.actions {
-		if err := action.Handle(ctx, ex, os, observer); err != nil {
+	ctx, handlers := withHandlerQueue(ctx)
+	for i := 0; i < len(r.actions); {
+		action, scopes, n := r.coalesce(i)
+		actionObserver := observer
+		if n > 1 {
+			// Loop expansions merged into the batch keep their identity
+			actionObserver = sequenceObserver(observer, scopes, "")
+		}
+		if err := action.Handle(ctx, ex, os, actionObserver); err != nil {
 			return err
 		}
+		i += n
+	}
+	return handlers.run(ctx, ex, os, observer)
+}
+
+// coalesce returns the action to run at position i, the scopes of the results
+// it reports when it is a batch, and how many of the recipe's actions it
+// covers. Each action is flattened once as the batch grows.
+func (r BaseRecipe) coalesce(i int) (Action, []string, int) {
+	action, n := r.actions[i], 1
+	var batchScopes []string
+	flattened, scopes := flatten(r.actions[i : i+1])
+	for j := i + 1; j < len(r.actions); j++ {
+		next, nextScopes := flatten(r.actions[j : j+1])
+		flattened = append(flattened, next...)
+		scopes = append(scopes, nextScopes...)
+		batched, ok := batchFlattened(flattened)
+		if !ok {
+			break
+		}
+		action, batchScopes, n = batched, scopes, j-i+1
 	}
-	return nil
+	return action, batchScopes, n
 }
 
 // RecipeRegistry manages available recipes
@@ -1,20 +1,21 @@
-package core
+package core_test
 
 import (
 	"context"
 	"testing"
 
+	"github.com/johnnyfreeman/anvil/internal/core"
 	"github.com/johnnyfreeman/anvil/internal/testutil"
 )
 
 func Test_RecipeRegistry(t *testing.T) {
-	registry := NewRecipeRegistry()
+	registry := core.NewRecipeRegistry()
 	
 	// Create a test recipe
-	testRecipe := NewBaseRecipe(
+	testRecipe := core.NewBaseRecipe(
 		"test-recipe",
 		"Test recipe for testing",
-		[]Action{},
+		[]core.Action{},
 	)
 	
 	// Test registration
@@ -50,12 +51,12 @@ func Test_RecipeRegistry(t *testing.T) {
 }
 
 func Test_BaseRecipe(t *testing.T) {
-	actions := []Action{
+	actions := []core.Action{
 		&TestAction{name: "action1"},
 		&TestAction{name: "action2"},
 	}
 	
-	recipe := NewBaseRecipe(
+	recipe := core.NewBaseRecipe(
 		"test-recipe",
 		"Test description",
 		actions,
@@ -82,19 +83,19 @@ func Test_BaseRecipe_Execute(t *testing.T) {
 		{name: "action3"},
 	}
 	
-	actions := make([]Action, len(testActions))
+	actions := make([]core.Action, len(testActions))
 	for i, action := range testActions {
 		actions[i] = action
 	}
 	
-	recipe := NewBaseRecipe(
+	recipe := core.NewBaseRecipe(
 		"test-recipe",
 		"Test description",
 		actions,
 	)
 	
-	executor := &FakeExecutor{
-		Responses: make(map[string]FakeResponse),
+	executor := &core.FakeExecutor{
+		Responses: make(map[string]core.FakeResponse),
 	}
 	
 	os := &testutil.MockOS{}
@@ -121,7 +122,7 @@ type TestAction struct {
 	err      error
 }
 
-func (a *TestAction) Handle(ctx context.Context, ex Executor, os OS, observer ActionObserver) error {
+func (a *TestAction) Handle(ctx context.Context, ex core.Executor, os core.OS, observer core.ActionObserver) error {
 	a.executed = true
 	return a.err
 }
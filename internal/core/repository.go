@@ -0,0 +1,65 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PackageRepository describes a third-party package repository
+type PackageRepository struct {
+	Name        string
+	Description string
+	URIs        []string
+	// Suites and Components are only used by APT repositories
+	Suites     []string
+	Components []string
+	// KeyPath is the path of the repository's signing key on the target
+	KeyPath string
+}
+
+// renderDeb822Source renders an APT source in the deb822 format
+func renderDeb822Source(repo PackageRepository) string {
+	var b strings.Builder
+	if repo.Description != "" {
+		fmt.Fprintf(&b, "# %s\n", repo.Description)
+	}
+	b.WriteString("Types: deb\n")
+	fmt.Fprintf(&b, "URIs: %s\n", strings.Join(repo.URIs, " "))
+	fmt.Fprintf(&b, "Suites: %s\n", strings.Join(repo.Suites, " "))
+	if len(repo.Components) > 0 {
+		fmt.Fprintf(&b, "Components: %s\n", strings.Join(repo.Components, " "))
+	}
+	if repo.KeyPath != "" {
+		fmt.Fprintf(&b, "Signed-By: %s\n", repo.KeyPath)
+	}
+	return b.String()
+}
+
+// validateDeb822Source rejects sources APT would refuse to load
+func validateDeb822Source(repo PackageRepository) error {
+	if len(repo.Suites) == 0 {
+		return fmt.Errorf("APT repository '%s' needs at least one suite", repo.Name)
+	}
+	return nil
+}
+
+// renderDnfRepo renders a DNF .repo file
+func renderDnfRepo(repo PackageRepository) string {
+	description := repo.Description
+	if description == "" {
+		description = repo.Name
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%s]\n", repo.Name)
+	fmt.Fprintf(&b, "name=%s\n", description)
+	fmt.Fprintf(&b, "baseurl=%s\n", strings.Join(repo.URIs, " "))
+	b.WriteString("enabled=1\n")
+	if repo.KeyPath != "" {
+		b.WriteString("gpgcheck=1\n")
+		fmt.Fprintf(&b, "gpgkey=file://%s\n", repo.KeyPath)
+	} else {
+		b.WriteString("gpgcheck=0\n")
+	}
+	return b.String()
+}
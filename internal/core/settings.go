@@ -0,0 +1,66 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// withSystemd runs the systemd command on hosts booted with systemd and the
+// fallback elsewhere, e.g. in containers, where the *ctl tools can't reach
+// their daemons
+func withSystemd(systemd string, fallback string) string {
+	return fmt.Sprintf("if [ -d /run/systemd/system ]; then %s; else %s; fi", systemd, fallback)
+}
+
+// systemSettingsManager provides the hostname and timezone commands shared by
+// the supported distributions
+type systemSettingsManager struct{}
+
+// Hostname prints the static hostname. The transient one that hostname
+// prints may have been set by cloud-init or DHCP and not survive a reboot.
+func (sm systemSettingsManager) Hostname() string {
+	return withSystemd("hostnamectl --static", "cat /etc/hostname 2>/dev/null || true")
+}
+
+func (sm systemSettingsManager) SetHostname(name string) string {
+	name = ShellQuote(name)
+	return withSystemd(
+		fmt.Sprintf("hostnamectl set-hostname %s", name),
+		fmt.Sprintf("echo %s > /etc/hostname && hostname %s", name, name),
+	)
+}
+
+// Timezone prints the timezone, e.g. Europe/Berlin
+func (sm systemSettingsManager) Timezone() string {
+	return withSystemd(
+		"timedatectl show -p Timezone --value",
+		"readlink /etc/localtime | sed 's|.*/zoneinfo/||'",
+	)
+}
+
+// setTimezone sets the timezone, running fallback as well as linking
+// /etc/localtime on hosts without systemd. The zone is checked first, as a
+// link to a missing zone would still read back as the timezone.
+func (sm systemSettingsManager) setTimezone(timezone string, fallback string) string {
+	zone := ShellQuote("/usr/share/zoneinfo/" + timezone)
+	command := fmt.Sprintf("test -f %s && ln -sf %s /etc/localtime", zone, zone)
+	if fallback != "" {
+		command += " && " + fallback
+	}
+	return withSystemd(fmt.Sprintf("timedatectl set-timezone %s", ShellQuote(timezone)), command)
+}
+
+// LocaleAvailable succeeds if the locale is generated or installed. locale -a
+// lists charsets in lower case without dashes, e.g. en_US.utf8.
+func (sm systemSettingsManager) LocaleAvailable(locale string) string {
+	name, charset, found := strings.Cut(locale, ".")
+	if found {
+		name += "." + strings.ReplaceAll(strings.ToLower(charset), "-", "")
+	}
+	return fmt.Sprintf("locale -a | grep -qixF %s", ShellQuote(name))
+}
+
+// localeSetting prints the LANG set in a locale configuration file
+func (sm systemSettingsManager) localeSetting(file string) string {
+	return fmt.Sprintf(`sed -n 's/^LANG=//p' %s | tr -d '"'`, file)
+}
@@ -0,0 +1,280 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// FileTransferer is implemented by executors that can copy files to and from
+// the target. Uploads replace the destination atomically and downloads of
+// missing files return an error wrapping fs.ErrNotExist.
+type FileTransferer interface {
+	Upload(ctx context.Context, content []byte, path string, mode fs.FileMode, observer ExecutionObserver) error
+	Download(ctx context.Context, path string, observer ExecutionObserver) ([]byte, error)
+}
+
+// Upload writes content to path on the target
+func Upload(ctx context.Context, ex Executor, content []byte, path string, mode fs.FileMode, observer ExecutionObserver) error {
+	ft, ok := ex.(FileTransferer)
+	if !ok {
+		return fmt.Errorf("executor %T does not support file transfer", ex)
+	}
+	return ft.Upload(ctx, content, path, mode, observer)
+}
+
+// Download reads the file at path on the target
+func Download(ctx context.Context, ex Executor, path string, observer ExecutionObserver) ([]byte, error) {
+	ft, ok := ex.(FileTransferer)
+	if !ok {
+		return nil, fmt.Errorf("executor %T does not support file transfer", ex)
+	}
+	return ft.Download(ctx, path, observer)
+}
+
+// ShellQuote quotes s so that the shell on the target treats it as a single
+// word
+func ShellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, needsQuoting) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func needsQuoting(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return false
+	case strings.ContainsRune("-_./:=@%+,", r):
+		return false
+	}
+	return true
+}
+
+func notifyTransfer(observer ExecutionObserver, description string) (func(), error) {
+	if observer == nil {
+		return func() {}, nil
+	}
+	if err := observer.OnExecutionStart(description); err != nil {
+		return nil, err
+	}
+	return func() {
+		if err := observer.OnExecutionEnd(); err != nil {
+			// Log error but don't fail transfer
+		}
+	}, nil
+}
+
+func uploadDescription(content []byte, path string) string {
+	return fmt.Sprintf("upload %d bytes to %s", len(content), path)
+}
+
+func downloadDescription(path string) string {
+	return fmt.Sprintf("download %s", path)
+}
+
+func (e LocalExecutor) Upload(ctx context.Context, content []byte, path string, mode fs.FileMode, observer ExecutionObserver) error {
+	done, err := notifyTransfer(observer, uploadDescription(content, path))
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".anvil-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (e LocalExecutor) Download(ctx context.Context, path string, observer ExecutionObserver) ([]byte, error) {
+	done, err := notifyTransfer(observer, downloadDescription(path))
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	return os.ReadFile(path)
+}
+
+// missingFileStatus is the exit status the remote download command uses to
+// signal that the file does not exist
+const missingFileStatus = 44
+
+func (e SshExecutor) Upload(ctx context.Context, content []byte, path string, mode fs.FileMode, observer ExecutionObserver) error {
+	done, err := notifyTransfer(observer, uploadDescription(content, path))
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	tmp := ShellQuote(path + ".anvil-tmp")
+	command := fmt.Sprintf("cat > %s && chmod %o %s && mv -f %s %s", tmp, mode.Perm(), tmp, tmp, ShellQuote(path))
+	cmd := exec.CommandContext(ctx, "ssh", e.target(), command)
+	cmd.Stdin = bytes.NewReader(content)
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("upload to %s failed: %w: %s", path, err, output)
+	}
+	return nil
+}
+
+func (e SshExecutor) Download(ctx context.Context, path string, observer ExecutionObserver) ([]byte, error) {
+	done, err := notifyTransfer(observer, downloadDescription(path))
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	command := fmt.Sprintf("[ -e %s ] || exit %d; cat %s", ShellQuote(path), missingFileStatus, ShellQuote(path))
+	cmd := exec.CommandContext(ctx, "ssh", e.target(), command)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == missingFileStatus {
+			return nil, fmt.Errorf("download %s: %w", path, fs.ErrNotExist)
+		}
+		return nil, fmt.Errorf("download %s failed: %w: %s", path, err, stderr.String())
+	}
+	return output, nil
+}
+
+func (e ParallelSshExecutor) Upload(ctx context.Context, content []byte, path string, mode fs.FileMode, observer ExecutionObserver) error {
+	done, err := notifyTransfer(observer, uploadDescription(content, path))
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	var errs []error
+	for _, host := range e.Hosts {
+		executor := SshExecutor{Host: host.Host, User: host.User}
+		if err := executor.Upload(ctx, content, path, mode, nil); err != nil {
+			errs = append(errs, fmt.Errorf("[%s] %w", host.Host, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Download reads the file from every host. Actions compare it with the content
+// they want, so it fails unless all hosts have the same file, or none has it.
+func (e ParallelSshExecutor) Download(ctx context.Context, path string, observer ExecutionObserver) ([]byte, error) {
+	done, err := notifyTransfer(observer, downloadDescription(path))
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	var content []byte
+	var first string
+	var missing []string
+	for _, host := range e.Hosts {
+		executor := SshExecutor{Host: host.Host, User: host.User}
+		hostContent, err := executor.Download(ctx, path, nil)
+		if errors.Is(err, fs.ErrNotExist) {
+			missing = append(missing, host.Host)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("[%s] %w", host.Host, err)
+		}
+		if first == "" {
+			content, first = hostContent, host.Host
+		} else if !bytes.Equal(hostContent, content) {
+			return nil, fmt.Errorf("download %s: the file differs between %s and %s", path, first, host.Host)
+		}
+	}
+
+	switch {
+	case len(missing) == len(e.Hosts):
+		return nil, fmt.Errorf("download %s: %w", path, fs.ErrNotExist)
+	case len(missing) > 0:
+		return nil, fmt.Errorf("download %s: the file is missing on %s", path, strings.Join(missing, ", "))
+	}
+	return content, nil
+}
+
+func (e *FakeExecutor) Upload(ctx context.Context, content []byte, path string, mode fs.FileMode, observer ExecutionObserver) error {
+	done, err := notifyTransfer(observer, uploadDescription(content, path))
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	e.History = append(e.History, uploadDescription(content, path))
+	if e.Files == nil {
+		e.Files = make(map[string][]byte)
+	}
+	e.Files[path] = content
+	return nil
+}
+
+func (e *FakeExecutor) Download(ctx context.Context, path string, observer ExecutionObserver) ([]byte, error) {
+	done, err := notifyTransfer(observer, downloadDescription(path))
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	content, ok := e.Files[path]
+	if !ok {
+		return nil, fmt.Errorf("download %s: %w", path, fs.ErrNotExist)
+	}
+	return content, nil
+}
+
+func (e *FakeExecutor) Uploaded(path string) bool {
+	_, ok := e.Files[path]
+	return ok
+}
+
+// Upload records the upload without touching the target
+func (e *DryRunExecutor) Upload(ctx context.Context, content []byte, path string, mode fs.FileMode, observer ExecutionObserver) error {
+	done, err := notifyTransfer(observer, uploadDescription(content, path))
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	e.Commands = append(e.Commands, uploadDescription(content, path))
+	return nil
+}
+
+// Download reads the file from the local machine, which is the target of dry
+// runs, so that actions can still show what they would change
+func (e *DryRunExecutor) Download(ctx context.Context, path string, observer ExecutionObserver) ([]byte, error) {
+	done, err := notifyTransfer(observer, downloadDescription(path))
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	return os.ReadFile(path)
+}
+
+var _ FileTransferer = LocalExecutor{}
+var _ FileTransferer = SshExecutor{}
+var _ FileTransferer = ParallelSshExecutor{}
+var _ FileTransferer = (*FakeExecutor)(nil)
+var _ FileTransferer = (*DryRunExecutor)(nil)
@@ -0,0 +1,59 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_LocalExecutor_Transfer(t *testing.T) {
+	ex := LocalExecutor{}
+	path := filepath.Join(t.TempDir(), "file.txt")
+
+	if err := Upload(context.Background(), ex, []byte("hello\n"), path, 0o600, nil); err != nil {
+		t.Fatalf("Expected no error uploading, got %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Expected uploaded file to exist, got %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Fatalf("Expected mode 0600, got %o", info.Mode().Perm())
+	}
+
+	content, err := Download(context.Background(), ex, path, nil)
+	if err != nil {
+		t.Fatalf("Expected no error downloading, got %v", err)
+	}
+	if string(content) != "hello\n" {
+		t.Fatalf("Expected downloaded content to match, got %q", content)
+	}
+}
+
+func Test_FakeExecutor_DownloadMissing(t *testing.T) {
+	ex := &FakeExecutor{}
+	_, err := Download(context.Background(), ex, "/does/not/exist", nil)
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("Expected fs.ErrNotExist, got %v", err)
+	}
+}
+
+func Test_ShellQuote(t *testing.T) {
+	cases := map[string]string{
+		"/etc/hosts":   "/etc/hosts",
+		"":             "''",
+		"two words":    "'two words'",
+		"it's":         `'it'\''s'`,
+		"$(rm -rf /)":  "'$(rm -rf /)'",
+		"user@host:22": "user@host:22",
+	}
+	for input, expected := range cases {
+		if quoted := ShellQuote(input); quoted != expected {
+			t.Fatalf("Expected %q to be quoted as %q, got %q", input, expected, quoted)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// User describes a local user account. Empty fields are left to the system
+// defaults when creating a user and left untouched when modifying one.
+type User struct {
+	Name string
+	UID  *int
+	// Group is the primary group
+	Group string
+	// Groups are the supplementary groups. They replace the user's current
+	// supplementary groups unless AppendGroups is set.
+	Groups       []string
+	AppendGroups bool
+	Shell        string
+	Home         string
+	System       bool
+	Comment      string
+	// Password is an already hashed password, as found in /etc/shadow
+	Password string
+	// Expires is the date the account expires on as YYYY-MM-DD, or "never"
+	Expires string
+}
+
+// shadowUserManager provides the non-interactive shadow-utils user management
+// commands shared by the supported distributions
+type shadowUserManager struct{}
+
+func (um shadowUserManager) CreateUser(user User) string {
+	args := []string{"useradd"}
+	if user.System {
+		args = append(args, "-r")
+	}
+	if !user.System || user.Home != "" {
+		args = append(args, "-m")
+	}
+	args = append(args, um.userFlags(user)...)
+	args = append(args, ShellQuote(user.Name))
+	return strings.Join(args, " ")
+}
+
+func (um shadowUserManager) ModifyUser(user User) string {
+	args := []string{"usermod"}
+	if user.AppendGroups && len(user.Groups) > 0 {
+		args = append(args, "-a")
+	}
+	if user.Home != "" {
+		args = append(args, "-m")
+	}
+	args = append(args, um.userFlags(user)...)
+	args = append(args, ShellQuote(user.Name))
+	return strings.Join(args, " ")
+}
+
+func (um shadowUserManager) userFlags(user User) []string {
+	var flags []string
+	if user.UID != nil {
+		flags = append(flags, "-u", strconv.Itoa(*user.UID))
+	}
+	if user.Group != "" {
+		flags = append(flags, "-g", ShellQuote(user.Group))
+	}
+	if len(user.Groups) > 0 {
+		flags = append(flags, "-G", ShellQuote(strings.Join(user.Groups, ",")))
+	}
+	if user.Shell != "" {
+		flags = append(flags, "-s", ShellQuote(user.Shell))
+	}
+	if user.Home != "" {
+		flags = append(flags, "-d", ShellQuote(user.Home))
+	}
+	if user.Comment != "" {
+		flags = append(flags, "-c", ShellQuote(user.Comment))
+	}
+	if user.Password != "" {
+		flags = append(flags, "-p", ShellQuote(user.Password))
+	}
+	switch user.Expires {
+	case "":
+	case "never":
+		flags = append(flags, "-e", "''")
+	default:
+		flags = append(flags, "-e", ShellQuote(user.Expires))
+	}
+	return flags
+}
+
+func (um shadowUserManager) RemoveUser(username string, removeHome bool) string {
+	if removeHome {
+		return fmt.Sprintf("userdel -r %s", ShellQuote(username))
+	}
+	return fmt.Sprintf("userdel %s", ShellQuote(username))
+}
+
+func (um shadowUserManager) LockUser(username string) string {
+	return fmt.Sprintf("usermod -L %s", ShellQuote(username))
+}
+
+func (um shadowUserManager) UnlockUser(username string) string {
+	return fmt.Sprintf("usermod -U %s", ShellQuote(username))
+}
+
+// CheckUser prints the user's passwd entry, or fails if there is none
+func (um shadowUserManager) CheckUser(username string) string {
+	return fmt.Sprintf("getent passwd %s", ShellQuote(username))
+}
+
+// CheckUserGroups prints the user's primary group on the first line and all
+// of its groups on the second
+func (um shadowUserManager) CheckUserGroups(username string) string {
+	return fmt.Sprintf("id -gn %s && id -Gn %s", ShellQuote(username), ShellQuote(username))
+}
+
+// CheckUserPassword prints the user's shadow entry, or fails if there is none
+func (um shadowUserManager) CheckUserPassword(username string) string {
+	return fmt.Sprintf("getent shadow %s", ShellQuote(username))
+}
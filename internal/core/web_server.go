@@ -0,0 +1,102 @@
+package core
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// WebServerKind is an HTTP server sites can be configured for
+type WebServerKind int
+
+const (
+	Nginx WebServerKind = iota
+	Apache
+)
+
+func (k WebServerKind) String() string {
+	if k == Apache {
+		return "apache"
+	}
+	return "nginx"
+}
+
+// WebServer is how a distribution lays out a web server's site
+// configuration. Debian keeps sites in sites-available and enables them
+// through links in sites-enabled, Fedora loads every file in conf.d.
+type WebServer struct {
+	Kind WebServerKind
+	// Service is the service unit, e.g. apache2 or httpd
+	Service string
+	// SitesDir is where site configuration files are written
+	SitesDir string
+	// EnabledDir holds the links that enable sites. Empty when every file in
+	// SitesDir is loaded.
+	EnabledDir string
+}
+
+// SitePath is the configuration file of the site
+func (w WebServer) SitePath(name string) string {
+	return path.Join(w.SitesDir, name+".conf")
+}
+
+// EnabledPath is the link that enables the site, or "" if the site's file is
+// loaded as it is
+func (w WebServer) EnabledPath(name string) string {
+	if w.EnabledDir == "" {
+		return ""
+	}
+	return path.Join(w.EnabledDir, name+".conf")
+}
+
+// EnableSite links the site into EnabledDir, through a2ensite for Apache
+func (w WebServer) EnableSite(name string) string {
+	switch {
+	case w.EnabledDir == "":
+		return ""
+	case w.Kind == Apache:
+		return fmt.Sprintf("a2ensite -q %s", ShellQuote(name))
+	default:
+		return fmt.Sprintf("ln -sfn %s %s", ShellQuote(w.SitePath(name)), ShellQuote(w.EnabledPath(name)))
+	}
+}
+
+func (w WebServer) DisableSite(name string) string {
+	switch {
+	case w.EnabledDir == "":
+		return ""
+	case w.Kind == Apache:
+		return fmt.Sprintf("a2dissite -q %s", ShellQuote(name))
+	default:
+		return fmt.Sprintf("rm -f %s", ShellQuote(w.EnabledPath(name)))
+	}
+}
+
+// EnableModules enables Apache modules on distributions that load them
+// through a2enmod. Elsewhere the modules sites use are loaded by default and
+// it returns "".
+func (w WebServer) EnableModules(modules ...string) string {
+	if w.Kind != Apache || w.EnabledDir == "" || len(modules) == 0 {
+		return ""
+	}
+	quoted := make([]string, len(modules))
+	for i, module := range modules {
+		quoted[i] = ShellQuote(module)
+	}
+	return "a2enmod -q " + strings.Join(quoted, " ")
+}
+
+// ConfigTest checks the whole configuration of the web server, failing with
+// the reason if it wouldn't load
+func (w WebServer) ConfigTest() string {
+	if w.Kind == Apache {
+		return "apachectl configtest"
+	}
+	return "nginx -t"
+}
+
+// Reload makes the running web server load its configuration without
+// dropping connections
+func (w WebServer) Reload() string {
+	return fmt.Sprintf("systemctl reload %s", w.Service)
+}
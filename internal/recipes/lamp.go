@@ -2,6 +2,7 @@ package recipes
 
 import (
 	"context"
+	"time"
 
 	"github.com/johnnyfreeman/anvil/internal/actions"
 	"github.com/johnnyfreeman/anvil/internal/core"
@@ -12,34 +13,38 @@ type LAMPServer struct {
 	core.BaseRecipe
 }
 
-func NewLAMPServer() *LAMPServer {
+// NewLAMPServer sets up the stack and serves the given Apache sites, e.g.
+// actions.NewApacheSite("example.com", actions.WithDocumentRoot("/var/www/app"))
+func NewLAMPServer(sites ...*actions.Site) *LAMPServer {
+	restartApache := actions.NewRestartService("apache2")
+
 	lampActions := []core.Action{
-		// Update package list first
-		actions.NewInstallPackage("", actions.WithUpdate()),
+		// Refresh package lists first
+		actions.NewRefreshPackageCache(actions.WithCacheValidFor(time.Hour)),
 		
 		// Install Apache web server
 		actions.NewInstallPackage("apache2"),
-		actions.NewEnableService("apache2"),
-		actions.NewStartService("apache2"),
+		actions.NewService("apache2", actions.WithServiceEnabled(true), actions.WithServiceRunning(true)),
+		
+		// Open the firewall for HTTP and HTTPS
+		actions.NewFirewall(actions.WithAllowPort(80, "tcp"), actions.WithAllowPort(443, "tcp")),
 		
 		// Install MySQL database server
 		actions.NewInstallPackage("mysql-server"),
-		actions.NewEnableService("mysql"),
-		actions.NewStartService("mysql"),
+		actions.NewService("mysql", actions.WithServiceEnabled(true), actions.WithServiceRunning(true)),
+		actions.NewMySQLSecureInstallation(),
 		
-		// Install PHP and common modules
+		// Install PHP and common modules, restarting Apache to load them
 		actions.NewInstallPackage("php"),
-		actions.NewInstallPackage("libapache2-mod-php"),
-		actions.NewInstallPackage("php-mysql"),
-		actions.NewInstallPackage("php-cli"),
-		actions.NewInstallPackage("php-curl"),
-		actions.NewInstallPackage("php-gd"),
-		actions.NewInstallPackage("php-mbstring"),
-		actions.NewInstallPackage("php-xml"),
-		actions.NewInstallPackage("php-zip"),
-		
-		// Restart Apache to load PHP module
-		actions.NewRestartService("apache2"),
+		core.Notify(actions.NewInstallPackage("libapache2-mod-php"), restartApache),
+		core.Notify(core.ForEach("php-modules", []string{"mysql", "cli", "curl", "gd", "mbstring", "xml", "zip"}, func(module string) core.Action {
+			return actions.NewInstallPackage("php-" + module)
+		}), restartApache),
+	}
+
+	// Serve the application sites once PHP is loaded
+	for _, site := range sites {
+		lampActions = append(lampActions, site)
 	}
 
 	baseRecipe := core.NewBaseRecipe(
@@ -5,6 +5,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/johnnyfreeman/anvil/internal/actions"
 	"github.com/johnnyfreeman/anvil/internal/core"
 	"github.com/johnnyfreeman/anvil/internal/testutil"
 )
@@ -28,9 +29,9 @@ func Test_LAMPServer_Recipe(t *testing.T) {
 	}
 	
 	// We expect actions for: update, apache2, mysql, php packages, services
-	// At minimum: update + apache2 + mysql + php + several php modules + service actions
-	if len(actions) < 10 {
-		t.Fatalf("Expected at least 10 actions for LAMP setup, got %d", len(actions))
+	// At minimum: update + apache2 + mysql + php + php modules + service actions
+	if len(actions) < 8 {
+		t.Fatalf("Expected at least 8 actions for LAMP setup, got %d", len(actions))
 	}
 }
 
@@ -81,6 +82,32 @@ func Test_LAMPServer_Execute(t *testing.T) {
 	if !hasPHP {
 		t.Error("Expected PHP installation commands")
 	}
+
+	restarts := 0
+	for _, cmd := range executor.History {
+		if cmd == "restart apache2" {
+			restarts++
+		}
+	}
+	if restarts != 1 {
+		t.Errorf("Expected Apache to be restarted once after PHP changes, got %d restarts", restarts)
+	}
+}
+
+func Test_LAMPServer_Sites(t *testing.T) {
+	recipe := NewLAMPServer(actions.NewApacheSite("example.com", actions.WithDocumentRoot("/var/www/app")))
+	executor := &core.FakeExecutor{}
+
+	if err := recipe.Execute(context.Background(), executor, &testutil.MockOS{}, &testutil.MockObserver{}); err != nil {
+		t.Fatalf("Expected no error executing LAMP recipe, got %v", err)
+	}
+
+	if !strings.Contains(string(executor.Files["/sites/example.com.conf"]), "DocumentRoot /var/www/app") {
+		t.Errorf("Expected the site to be written, got %v", executor.Files)
+	}
+	if !executor.Executed("apachectl configtest") {
+		t.Errorf("Expected the Apache configuration to be tested: %v", executor.History)
+	}
 }
 
 func Test_BasicWebServer_Recipe(t *testing.T) {
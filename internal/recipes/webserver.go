@@ -1,6 +1,8 @@
 package recipes
 
 import (
+	"time"
+
 	"github.com/johnnyfreeman/anvil/internal/actions"
 	"github.com/johnnyfreeman/anvil/internal/core"
 )
@@ -12,13 +14,15 @@ type BasicWebServer struct {
 
 func NewBasicWebServer() *BasicWebServer {
 	webActions := []core.Action{
-		// Update packages
-		actions.NewInstallPackage("", actions.WithUpdate()),
+		// Refresh package lists
+		actions.NewRefreshPackageCache(actions.WithCacheValidFor(time.Hour)),
 		
 		// Install and configure Apache
 		actions.NewInstallPackage("apache2"),
-		actions.NewEnableService("apache2"),
-		actions.NewStartService("apache2"),
+		actions.NewService("apache2", actions.WithServiceEnabled(true), actions.WithServiceRunning(true)),
+		
+		// Open the firewall for HTTP and HTTPS
+		actions.NewFirewall(actions.WithAllowPort(80, "tcp"), actions.WithAllowPort(443, "tcp")),
 		
 		// Install common utilities
 		actions.NewInstallPackage("curl"),
@@ -43,20 +47,27 @@ type NginxWebServer struct {
 	core.BaseRecipe
 }
 
-func NewNginxWebServer() *NginxWebServer {
+// NewNginxWebServer sets up nginx and serves the given sites, e.g.
+// actions.NewNginxSite("example.com", actions.WithProxyPass("http://127.0.0.1:3000"))
+func NewNginxWebServer(sites ...*actions.Site) *NginxWebServer {
 	nginxActions := []core.Action{
-		// Update packages
-		actions.NewInstallPackage("", actions.WithUpdate()),
+		// Refresh package lists
+		actions.NewRefreshPackageCache(actions.WithCacheValidFor(time.Hour)),
 		
 		// Install and configure Nginx
 		actions.NewInstallPackage("nginx"),
-		actions.NewEnableService("nginx"),
-		actions.NewStartService("nginx"),
+		actions.NewService("nginx", actions.WithServiceEnabled(true), actions.WithServiceRunning(true)),
+		
+		// Open the firewall for HTTP and HTTPS
+		actions.NewFirewall(actions.WithAllowPort(80, "tcp"), actions.WithAllowPort(443, "tcp")),
 		
 		// Install common utilities
 		actions.NewInstallPackage("curl"),
 		actions.NewInstallPackage("wget"),
 	}
+	for _, site := range sites {
+		nginxActions = append(nginxActions, site)
+	}
 
 	baseRecipe := core.NewBaseRecipe(
 		"nginx-webserver",
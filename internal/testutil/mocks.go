@@ -1,30 +1,139 @@
 package testutil
 
+import (
+	"strings"
+
+	"github.com/johnnyfreeman/anvil/internal/core"
+)
+
 // MockOS is a test implementation of core.OS
 type MockOS struct{}
 
-func (o *MockOS) CreateUser(username string) string {
-	return "create-user " + username
+func (o *MockOS) CreateUser(user core.User) string {
+	return "create-user " + user.Name
+}
+
+func (o *MockOS) ModifyUser(user core.User) string {
+	return "modify-user " + user.Name
+}
+
+func (o *MockOS) RemoveUser(username string, removeHome bool) string {
+	return "remove-user " + username
+}
+
+func (o *MockOS) LockUser(username string) string {
+	return "lock-user " + username
+}
+
+func (o *MockOS) UnlockUser(username string) string {
+	return "unlock-user " + username
 }
 
 func (o *MockOS) CheckUser(username string) string {
 	return "check-user " + username
 }
 
+func (o *MockOS) CheckUserGroups(username string) string {
+	return "check-user-groups " + username
+}
+
+func (o *MockOS) CheckUserPassword(username string) string {
+	return "check-user-password " + username
+}
+
 func (o *MockOS) GroupUser(username string, group string) string {
 	return "group-user " + username + " " + group
 }
 
+func (o *MockOS) CreateGroup(group core.Group) string {
+	return "create-group " + group.Name
+}
+
+func (o *MockOS) ModifyGroup(group core.Group) string {
+	return "modify-group " + group.Name
+}
+
+func (o *MockOS) RemoveGroup(name string) string {
+	return "remove-group " + name
+}
+
+func (o *MockOS) CheckGroup(name string) string {
+	return "check-group " + name
+}
+
 func (o *MockOS) InstallPackage(packageName string) string {
 	return "install " + packageName
 }
 
+func (o *MockOS) InstallPackages(packageNames ...string) string {
+	return "install " + strings.Join(packageNames, " ")
+}
+
+func (o *MockOS) CheckPackage(packageName string) string {
+	return "check-package " + packageName
+}
+
+func (o *MockOS) PackageSpec(packageName string, version string) string {
+	if version == "" {
+		return packageName
+	}
+	return packageName + "@" + version
+}
+
+func (o *MockOS) HoldPackages(packageNames ...string) string {
+	return "hold " + strings.Join(packageNames, " ")
+}
+
+func (o *MockOS) UnholdPackages(packageNames ...string) string {
+	return "unhold " + strings.Join(packageNames, " ")
+}
+
+func (o *MockOS) HeldPackages() string {
+	return "held-packages"
+}
+
 func (o *MockOS) RemovePackage(packageName string) string {
 	return "remove " + packageName
 }
 
-func (o *MockOS) UpdatePackages() string {
-	return "update-packages"
+func (o *MockOS) RefreshPackageCache() string {
+	return "refresh-package-cache"
+}
+
+func (o *MockOS) PackageCacheAge() string {
+	return "package-cache-age"
+}
+
+func (o *MockOS) UpgradePackages(mode core.UpgradeMode, heldPackages ...string) string {
+	return strings.TrimSpace("upgrade-packages " + strings.Join(heldPackages, " "))
+}
+
+func (o *MockOS) RepositoryPath(name string) string {
+	return "/repos/" + name
+}
+
+func (o *MockOS) RepositoryKeyPath(name string) string {
+	return "/keys/" + name
+}
+
+func (o *MockOS) RenderRepository(repo core.PackageRepository) string {
+	return repo.Name + " " + strings.Join(repo.URIs, " ") + "\n"
+}
+
+func (o *MockOS) ValidateRepository(repo core.PackageRepository) error {
+	return nil
+}
+
+func (o *MockOS) SELinuxEnabled() string {
+	return "selinux-enabled"
+}
+
+func (o *MockOS) FileContext(path string) string {
+	return "file-context " + path
+}
+
+func (o *MockOS) SetFileContext(path string, contextType string, recursive bool) string {
+	return "set-file-context " + path + " " + contextType
 }
 
 func (o *MockOS) StartService(serviceName string) string {
@@ -43,6 +152,118 @@ func (o *MockOS) RestartService(serviceName string) string {
 	return "restart " + serviceName
 }
 
+func (o *MockOS) DisableService(serviceName string) string {
+	return "disable " + serviceName
+}
+
+func (o *MockOS) MaskService(serviceName string) string {
+	return "mask " + serviceName
+}
+
+func (o *MockOS) UnmaskService(serviceName string) string {
+	return "unmask " + serviceName
+}
+
+func (o *MockOS) ServiceActive(serviceName string) string {
+	return "is-active " + serviceName
+}
+
+func (o *MockOS) ServiceEnabled(serviceName string) string {
+	return "is-enabled " + serviceName
+}
+
+func (o *MockOS) ServiceLogs(serviceName string, lines int) string {
+	return "logs " + serviceName
+}
+
+func (o *MockOS) ServiceUnitPath(unitName string) string {
+	return "/units/" + unitName
+}
+
+func (o *MockOS) ReloadServices() string {
+	return "reload-services"
+}
+
+func (o *MockOS) Firewall() core.Firewall {
+	return &MockFirewall{}
+}
+
+func (o *MockOS) Hostname() string {
+	return "hostname"
+}
+
+func (o *MockOS) SetHostname(name string) string {
+	return "set-hostname " + name
+}
+
+func (o *MockOS) Timezone() string {
+	return "timezone"
+}
+
+func (o *MockOS) SetTimezone(timezone string) string {
+	return "set-timezone " + timezone
+}
+
+func (o *MockOS) Locale() string {
+	return "locale"
+}
+
+func (o *MockOS) LocaleAvailable(locale string) string {
+	return "locale-available " + locale
+}
+
+func (o *MockOS) GenerateLocale(locale string) string {
+	return "generate-locale " + locale
+}
+
+func (o *MockOS) SetLocale(locale string) string {
+	return "set-locale " + locale
+}
+
+func (o *MockOS) WebServer(kind core.WebServerKind) core.WebServer {
+	return core.WebServer{Kind: kind, Service: "webserver", SitesDir: "/sites"}
+}
+
+// MockFirewall is a test implementation of core.Firewall with no existing
+// rules
+type MockFirewall struct{}
+
+func (f *MockFirewall) Name() string {
+	return "mock"
+}
+
+func (f *MockFirewall) Installed() string {
+	return "firewall-installed"
+}
+
+func (f *MockFirewall) Active() string {
+	return "firewall-active"
+}
+
+func (f *MockFirewall) Enable() string {
+	return "firewall-enable"
+}
+
+func (f *MockFirewall) ListRules(zone string) string {
+	return "firewall-rules " + zone
+}
+
+func (f *MockFirewall) ParseRules(output string, zone string) []core.FirewallRule {
+	return nil
+}
+
+func (f *MockFirewall) AddRule(rule core.FirewallRule) string {
+	return "firewall-add " + rule.String()
+}
+
+func (f *MockFirewall) RemoveRule(rule core.FirewallRule) string {
+	return "firewall-remove " + rule.String()
+}
+
+func (f *MockFirewall) Apply() string {
+	return "firewall-apply"
+}
+
 // MockObserver is a test implementation of core.ActionObserver
 type MockObserver struct {
 	StartCalled       bool
@@ -14,8 +14,9 @@ func main() {
 	if len(os.Args) < 2 {
 		fmt.Println("Usage: anvil [--dry-run] <command> [args]")
 		fmt.Println("Commands:")
-		fmt.Println("  create-user [--group <group>] <username>")
-		fmt.Println("  install-package [--update] <package>")
+		fmt.Println("  create-user [--group <group>] [--shell <shell>] [--home <dir>] [--uid <uid>] [--system] [--remove] <username>")
+		fmt.Println("  create-group [--gid <gid>] [--system] [--remove] <group>")
+		fmt.Println("  install-package [--update] <package>...")
 		fmt.Println("  recipe <recipe-name>")
 		fmt.Println("  recipe --list")
 		fmt.Println("  detect-os")
@@ -50,6 +51,8 @@ func main() {
 	switch args[0] {
 	case "create-user":
 		cli.CreateUserCommand(ctx, executor, args[1:])
+	case "create-group":
+		cli.CreateGroupCommand(ctx, executor, args[1:])
 	case "install-package":
 		cli.InstallPackageCommand(ctx, executor, args[1:])
 	case "recipe":